@@ -10,20 +10,45 @@ import (
 	"github.com/ysodiqakanni/trustank-api/internal/business"
 	"github.com/ysodiqakanni/trustank-api/internal/businessCategory"
 	"github.com/ysodiqakanni/trustank-api/internal/config"
+	"github.com/ysodiqakanni/trustank-api/internal/healthcheck"
+	"github.com/ysodiqakanni/trustank-api/internal/invitation"
+	"github.com/ysodiqakanni/trustank-api/internal/job"
+	"github.com/ysodiqakanni/trustank-api/internal/notification"
+	"github.com/ysodiqakanni/trustank-api/internal/search"
+	"github.com/ysodiqakanni/trustank-api/internal/suggestion"
 	"github.com/ysodiqakanni/trustank-api/internal/user"
+	"github.com/ysodiqakanni/trustank-api/internal/webhook"
 	"github.com/ysodiqakanni/trustank-api/pkg/dbcontext"
+	"github.com/ysodiqakanni/trustank-api/pkg/events"
+	"github.com/ysodiqakanni/trustank-api/pkg/geocode"
+	"github.com/ysodiqakanni/trustank-api/pkg/jobs"
+	"github.com/ysodiqakanni/trustank-api/pkg/lifecycle"
 	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/mailer"
+	"github.com/ysodiqakanni/trustank-api/pkg/metrics"
+	"github.com/ysodiqakanni/trustank-api/pkg/storage"
+	"github.com/ysodiqakanni/trustank-api/pkg/textfilter"
+	"github.com/ysodiqakanni/trustank-api/pkg/tracing"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 // Version indicates the current version of the application.
 var Version = "1.0.0"
 
+// Commit is the git commit the application was built from. Set with -ldflags "-X main.Commit=...".
+var Commit = "unknown"
+
 var flagConfig = flag.String("config", "./config/local.yml", "path to the config file")
 
 func main() {
@@ -47,20 +72,71 @@ func main() {
 		os.Exit(-1)
 	}
 
-	defer db.Client().Disconnect(context.Background())
-
 	// build HTTP server
 	address := fmt.Sprintf(":%v", cfg.ServerPort)
+	lc := lifecycle.New(logger)
+	// started first so that it is stopped last, exporting the spans of the other workers
+	provider, err := newTracerProvider(cfg)
+	if err != nil {
+		logger.Error(err)
+		os.Exit(-1)
+	}
+	if provider != nil {
+		otel.SetTracerProvider(provider)
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+			logger.Errorf("failed to export traces: %s", err)
+		}))
+		lc.Go("trace exporter", func(ctx context.Context) {
+			<-ctx.Done()
+			if err := provider.Shutdown(context.Background()); err != nil {
+				logger.Errorf("failed to flush traces: %s", err)
+			}
+		})
+	}
 	hs := &http.Server{
-		Addr:    address,
-		Handler: buildHandler(logger, dbcontext.New(db), cfg),
+		Addr:         address,
+		Handler:      buildHandler(logger, dbcontext.New(db), cfg, lc),
+		ReadTimeout:  time.Duration(cfg.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(cfg.WriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(cfg.IdleTimeout) * time.Second,
 	}
 
 	// start the HTTP server with graceful shutdown
-	// go routing.GracefulShutdown(hs, 10*time.Second, logger.Infof)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- hs.ListenAndServe()
+	}()
+	lc.SetReady(true)
 	logger.Infof("server %v is running at %v", Version, address)
-	if err := hs.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	delay := time.Duration(cfg.ShutdownDelay) * time.Second
+	failed := false
+	select {
+	case err := <-serverErr:
+		// the workers are still stopped gracefully, but there are no requests to drain
 		logger.Error(err)
+		delay = 0
+		failed = true
+	case sig := <-quit:
+		logger.Infof("received %s, shutting down", sig)
+	}
+	// a second signal stops the server immediately
+	signal.Stop(quit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancel()
+	if err := lc.Shutdown(ctx, hs, delay); err != nil {
+		logger.Errorf("failed to shut down gracefully: %s", err)
+	}
+	// the workers using the database are stopped, or given up on
+	if err := db.Client().Disconnect(context.Background()); err != nil {
+		logger.Errorf("failed to disconnect from the database: %s", err)
+	}
+	logger.Info("server stopped")
+	if failed {
+		cancel()
 		os.Exit(-1)
 	}
 }
@@ -69,7 +145,11 @@ func NewMongoDB(connStr, dbName string) (*mongo.Database, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connStr))
+	// the commands and the connection pool are recorded in the metrics, the commands run within a span are traced
+	monitor := metrics.NewMongo(metrics.Default)
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connStr).
+		SetMonitor(tracing.MongoMonitor(monitor.CommandMonitor())).
+		SetPoolMonitor(monitor.PoolMonitor()))
 	if err != nil {
 		return nil, err
 	}
@@ -85,23 +165,171 @@ func NewMongoDB(connStr, dbName string) (*mongo.Database, error) {
 	return client.Database(dbName), nil
 }
 
-func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config) http.Handler {
+// newTracerProvider creates the tracer provider exporting traces as selected in the configuration,
+// or nil if tracing is disabled.
+func newTracerProvider(cfg *config.Config) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.TraceExporter {
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.TraceOTLPEndpoint))
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tracing.NewProvider(exporter, cfg.TraceSampleRatio, "trustank-api", Version), nil
+}
+
+// newStorage creates the blob storage selected in the configuration.
+func newStorage(cfg *config.Config) storage.Storage {
+	if cfg.StorageDriver == "s3" {
+		return storage.NewS3(storage.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PublicURL: cfg.S3PublicURL,
+		}, nil)
+	}
+	return storage.NewLocal(cfg.StorageLocalDir)
+}
+
+// newGeocoder creates the geocoder resolving business addresses from the configured fixtures.
+func newGeocoder(cfg *config.Config, logger log.Logger) geocode.Geocoder {
+	if cfg.GeocodeFixtures == "" {
+		return geocode.NewStatic()
+	}
+	geocoder, err := geocode.LoadStatic(cfg.GeocodeFixtures)
+	if err != nil {
+		logger.Errorf("failed to load geocode fixtures: %s", err)
+		return geocode.NewStatic()
+	}
+	return geocoder
+}
+
+// newMailer creates the mailer selected in the configuration.
+func newMailer(cfg *config.Config, logger log.Logger) mailer.Mailer {
+	switch cfg.MailDriver {
+	case "smtp":
+		return mailer.NewSMTP(mailer.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		})
+	case "mbox":
+		return mailer.NewMbox(cfg.MailMboxFile, cfg.MailFrom)
+	}
+	return mailer.NewLog(logger)
+}
+
+// newTemplates loads the email templates. Emails cannot be rendered if they fail to load.
+func newTemplates(cfg *config.Config, logger log.Logger) *mailer.Templates {
+	templates, err := mailer.LoadTemplates(cfg.MailTemplates, "en")
+	if err != nil {
+		logger.Errorf("failed to load email templates: %s", err)
+		return &mailer.Templates{}
+	}
+	return templates
+}
+
+// newTextFilter creates the profanity and PII filter from the built-in word lists and the configured ones.
+func newTextFilter(cfg *config.Config, logger log.Logger) *textfilter.Filter {
+	lists := textfilter.DefaultWordLists()
+	if cfg.TextFilterWordLists != "" {
+		extra, err := textfilter.LoadWordLists(cfg.TextFilterWordLists)
+		if err != nil {
+			logger.Errorf("failed to load text filter word lists: %s", err)
+		}
+		for locale, words := range extra {
+			lists[locale] = append(lists[locale], words...)
+		}
+	}
+	return textfilter.New(lists)
+}
+
+func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config, lc *lifecycle.Manager) http.Handler {
 	r := mux.NewRouter()
-	business.RegisterBusinessHandlers(r,
-		business.NewService(business.NewRepository(db, logger), user.NewRepository(db, logger), logger),
-		logger,
-		cfg.JWTSigningKey)
+	r.Use(log.Middleware, tracing.Middleware)
+	metrics.NewHTTP(metrics.Default).Instrument(r)
+	r.Handle("/metrics", metrics.Default.Handler()).Methods("GET")
+
+	healthcheck.RegisterHandlers(r, Version, Commit, map[string]healthcheck.Check{
+		"mongo": func(ctx context.Context) error {
+			return db.DB().Client().Ping(ctx, nil)
+		},
+		"server":  lc.CheckServer,
+		"workers": lc.CheckWorkers,
+	}, logger)
+
+	suggestionService := suggestion.NewService(suggestion.NewRepository(db, logger), logger)
+	lc.Go("suggestion index", func(ctx context.Context) {
+		suggestionService.Run(ctx, time.Duration(cfg.SuggestRefreshInterval)*time.Minute)
+	})
+	suggestion.RegisterHandlers(r, suggestionService, logger)
+
+	// domain events are written to the outbox with the changes they describe, then dispatched by the relay
+	outbox := events.NewMongoStore(db, logger)
+	relay := events.NewRelay(outbox, logger)
+	lc.Go("outbox relay", func(ctx context.Context) { relay.Run(ctx, time.Second) })
+
+	// background jobs are stored in the database and run by the workers of every instance
+	jobStore := jobs.NewMongoStore(db, logger)
+	jobQueue := jobs.NewQueue(jobStore)
+	jobRunner := jobs.NewRunner(jobStore, logger)
+	lc.Go("job runner", func(ctx context.Context) { jobRunner.Run(ctx, cfg.JobWorkers, time.Second) })
+	job.RegisterHandlers(r, job.NewService(jobQueue, logger), logger, cfg.JWTSigningKey)
+
+	// emails are sent by the job runner so that requests never wait for the mail server
+	suppressions := mailer.NewMongoSuppressions(db, logger)
+	jobRunner.Handle(mailer.JobSend, mailer.SendJob(newMailer(cfg, logger), suppressions, logger), time.Minute)
+	mail := mailer.NewQueued(jobQueue, suppressions)
+	templates := newTemplates(cfg, logger)
 
-	business.RegisterHandlers(r,
-		business.NewService(business.NewRepository(db, logger), user.NewRepository(db, logger), logger),
+	notificationService := notification.NewService(notification.NewRepository(db, logger), user.NewRepository(db, logger), mail, templates, cfg.AppBaseURL, logger)
+	relay.Subscribe(business.EventRegistered, notificationService.HandleEvent)
+	jobRunner.Handle(notification.JobDigest, func(ctx context.Context, _ jobs.Job) error {
+		return notificationService.SendDigests(ctx)
+	}, 30*time.Minute)
+	if err := jobRunner.Schedule("0 8 * * *", notification.JobDigest, nil); err != nil {
+		logger.Errorf("failed to schedule the notification digest: %s", err)
+	}
+	notification.RegisterHandlers(r, notificationService, logger, cfg.JWTSigningKey)
+
+	businessService := business.NewService(business.NewRepository(db, logger), user.NewRepository(db, logger), newGeocoder(cfg, logger), suggestionService, newTextFilter(cfg, logger), events.NewOutbox(outbox), logger)
+	business.RegisterBusinessHandlers(r, businessService, logger, cfg.JWTSigningKey)
+	business.RegisterHandlers(r, businessService, logger, cfg.JWTSigningKey)
+
+	webhookService := webhook.NewService(webhook.NewRepository(db, logger), businessService,
+		webhook.NewHTTPClient(cfg.WebhookAllowPrivate), cfg.WebhookMaxAttempts, logger)
+	lc.Go("webhook deliveries", func(ctx context.Context) { webhookService.Run(ctx, time.Second) })
+	webhook.RegisterHandlers(r, webhookService, businessService.AuthenticateAPIKey, logger, cfg.JWTSigningKey)
+
+	invitationService := invitation.NewService(invitation.NewRepository(db, logger), businessService, webhookService, mail, templates,
+		newStorage(cfg), jobQueue, cfg.InvitationSigningKey, cfg.AppBaseURL, time.Duration(cfg.InvitationExpiry)*24*time.Hour,
+		time.Duration(cfg.InvitationSendDelay)*time.Millisecond, logger)
+	jobRunner.Handle(invitation.JobImport, invitation.ImportJob(invitationService), invitation.ImportTimeout)
+	invitation.RegisterHandlers(r,
+		invitationService,
+		businessService.AuthenticateAPIKey,
 		logger,
 		cfg.JWTSigningKey)
 
 	businessCategory.RegisterHandlers(r,
-		businessCategory.NewService(businessCategory.NewRepository(db, logger), logger),
+		businessCategory.NewService(businessCategory.NewRepository(db, logger), newStorage(cfg), suggestionService, logger),
 		logger,
 		cfg.JWTSigningKey)
 
+	search.RegisterHandlers(r,
+		search.NewService(search.NewRepository(db, logger), logger),
+		logger)
+
 	auth.RegisterHandlers(r,
 		auth.NewService(cfg.JWTSigningKey, cfg.JWTExpiration, logger, user.NewRepository(db, logger)),
 		logger)
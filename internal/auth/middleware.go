@@ -60,6 +60,29 @@ func AuthenticateMiddleware(next http.Handler, jwtSecret string) http.Handler {
 		// Add user information to the request context
 		ctx := context.WithValue(r.Context(), "name", claims["name"].(string))
 		ctx = context.WithValue(ctx, "role", rolesSlice) //  claims["role"].([]interface{})
+		if id, ok := claims["id"].(string); ok {
+			ctx = context.WithValue(ctx, "id", id)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// APIKeyMiddleware authenticates requests carrying an X-API-Key header with lookup, which returns the ID of the
+// business owning the key. Requests without an API key are authenticated with AuthenticateMiddleware.
+func APIKeyMiddleware(next http.Handler, jwtSecret string, lookup func(ctx context.Context, key string) (primitive.ObjectID, error)) http.Handler {
+	jwtAuth := AuthenticateMiddleware(next, jwtSecret)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if key == "" {
+			jwtAuth.ServeHTTP(w, r)
+			return
+		}
+		businessId, err := lookup(r.Context(), key)
+		if err != nil {
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		ctx := context.WithValue(r.Context(), "business_id", businessId)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -78,6 +101,33 @@ func RoleMiddleware(next http.Handler, requiredRole string) http.Handler {
 	})
 }
 
+// CurrentUserID returns the ID of the user authenticated by AuthenticateMiddleware.
+// False is returned if the request is not authenticated.
+func CurrentUserID(ctx context.Context) (primitive.ObjectID, bool) {
+	id, ok := ctx.Value("id").(string)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, false
+	}
+	return objectId, true
+}
+
+// CurrentBusinessID returns the ID of the business authenticated by APIKeyMiddleware.
+// False is returned if the request is not authenticated with an API key.
+func CurrentBusinessID(ctx context.Context) (primitive.ObjectID, bool) {
+	id, ok := ctx.Value("business_id").(primitive.ObjectID)
+	return id, ok
+}
+
+// HasRole reports whether the user authenticated by AuthenticateMiddleware has the given role.
+func HasRole(ctx context.Context, role string) bool {
+	roles, ok := ctx.Value("role").([]string)
+	return ok && containsRole(roles, role)
+}
+
 func containsRole(roles []string, role string) bool {
 	for _, r := range roles {
 		if r == role {
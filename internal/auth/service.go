@@ -7,11 +7,16 @@ import (
 	"github.com/ysodiqakanni/trustank-api/internal/errors"
 	"github.com/ysodiqakanni/trustank-api/internal/user"
 	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/metrics"
+	"github.com/ysodiqakanni/trustank-api/pkg/tracing"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 	"time"
 )
 
+// loginsTotal counts the login attempts by result, "succeeded" or "failed".
+var loginsTotal = metrics.NewCounter("trustank_logins_total", "Number of login attempts by result.", "result")
+
 // Service encapsulates the authentication logic.
 type Service interface {
 	// authenticate authenticates a user using username and password.
@@ -57,9 +62,13 @@ func NewService(signingKey string, tokenExpiration int, logger log.Logger, userR
 // Login authenticates a user and generates a JWT token if authentication succeeds.
 // Otherwise, an error is returned.
 func (s service) Login(ctx context.Context, username, password string) (string, error) {
+	ctx, span := tracing.Start(ctx, "auth.Login")
+	defer span.End()
 	if identity := s.authenticate(ctx, username, password); identity != nil {
+		loginsTotal.Inc("succeeded")
 		return s.generateJWT(identity)
 	}
+	loginsTotal.Inc("failed")
 	return "", errors.Unauthorized("")
 }
 
@@ -76,7 +85,9 @@ func (s service) authenticate(ctx context.Context, username, password string) Id
 	}
 
 	logger.Infof("user found by email")
+	_, span := tracing.Start(ctx, "bcrypt.CompareHashAndPassword")
 	err = bcrypt.CompareHashAndPassword(usr.HashedPassword, []byte(password))
+	span.End()
 	if err != nil {
 		logger.Errorf("authentication failed due to password", err)
 		return nil
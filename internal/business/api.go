@@ -5,9 +5,14 @@ import (
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/ysodiqakanni/trustank-api/internal/auth"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	"github.com/ysodiqakanni/trustank-api/internal/errors"
 	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/pagination"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 /*
@@ -57,13 +62,24 @@ func RegisterBusinessHandlers(r *mux.Router, service Service, logger log.Logger,
 func RegisterHandlers(r *mux.Router, service Service, logger log.Logger, secret string) {
 	res := resource{service, logger}
 
+	// must be registered before /businesses/{id} so that "nearby" is not taken as an ID
+	r.HandleFunc("/api/v1/businesses/nearby", res.nearbyHandler).Methods("GET")
 	r.HandleFunc("/api/v1/businesses/{id}", res.getByIdHandler).Methods("GET")
+	r.HandleFunc("/api/v1/businesses/{id}/locations/{locationId}", res.getLocationHandler).Methods("GET")
 
 	// Protected Endpoint
 	r.Handle("/api/v1/businesses", auth.AuthenticateMiddleware(http.HandlerFunc(res.getByNameHandler), secret)).Methods("GET")
 
 	r.Handle("/api/v1/businesses", auth.AuthenticateMiddleware(auth.RoleMiddleware(http.HandlerFunc(res.create), "admin"), secret)).Methods("POST")
 
+	// Owner-scoped Endpoints: ownership is checked by the service
+	r.Handle("/api/v1/businesses/{id}/api-key", auth.AuthenticateMiddleware(http.HandlerFunc(res.createAPIKeyHandler), secret)).Methods("POST")
+	r.Handle("/api/v1/businesses/{id}/locations", auth.AuthenticateMiddleware(http.HandlerFunc(res.addLocationHandler), secret)).Methods("POST")
+	r.Handle("/api/v1/businesses/{id}/locations/{locationId}", auth.AuthenticateMiddleware(http.HandlerFunc(res.updateLocationHandler), secret)).Methods("PUT")
+	r.Handle("/api/v1/businesses/{id}/locations/{locationId}", auth.AuthenticateMiddleware(http.HandlerFunc(res.deleteLocationHandler), secret)).Methods("DELETE")
+	r.Handle("/api/v1/businesses/{id}/locations/{locationId}/hours", auth.AuthenticateMiddleware(http.HandlerFunc(res.setLocationHoursHandler), secret)).Methods("PUT")
+	r.Handle("/api/v1/businesses/{id}/locations/{locationId}/hours", auth.AuthenticateMiddleware(http.HandlerFunc(res.deleteLocationHoursHandler), secret)).Methods("DELETE")
+
 	//
 	//r.HandleFunc("/api/v1/businesses/{id}", res.getByIdHandler).Methods("GET")
 	////r.Handle("/api/v1/businesses", authMiddleware(res.getByNameHandler)).Methods("GET")
@@ -118,10 +134,163 @@ func (r resource) create(w http.ResponseWriter, req *http.Request) {
 	business, err := r.service.Register(req.Context(), input)
 	if err != nil {
 		r.logger.With(req.Context()).Info(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		errors.Write(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(business)
 }
+
+func (r resource) createAPIKeyHandler(w http.ResponseWriter, req *http.Request) {
+	key, err := r.service.CreateAPIKey(req.Context(), mux.Vars(req)["id"])
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"api_key": key})
+}
+
+func (r resource) addLocationHandler(w http.ResponseWriter, req *http.Request) {
+	var input LocationRequest
+
+	err := json.NewDecoder(req.Body).Decode(&input)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	location, err := r.service.AddLocation(req.Context(), mux.Vars(req)["id"], input)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(location)
+}
+
+func (r resource) updateLocationHandler(w http.ResponseWriter, req *http.Request) {
+	var input LocationRequest
+
+	err := json.NewDecoder(req.Body).Decode(&input)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(req)
+	location, err := r.service.UpdateLocation(req.Context(), vars["id"], vars["locationId"], input)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(location)
+}
+
+func (r resource) deleteLocationHandler(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	if err := r.service.DeleteLocation(req.Context(), vars["id"], vars["locationId"]); err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// get a location with its opening hours, whether it is open now and when it opens next
+func (r resource) getLocationHandler(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	location, err := r.service.GetLocation(req.Context(), vars["id"], vars["locationId"])
+	if err != nil {
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(location)
+}
+
+func (r resource) setLocationHoursHandler(w http.ResponseWriter, req *http.Request) {
+	var input entity.OpeningHours
+
+	err := json.NewDecoder(req.Body).Decode(&input)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(req)
+	location, err := r.service.SetLocationHours(req.Context(), vars["id"], vars["locationId"], &input)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(location)
+}
+
+func (r resource) deleteLocationHoursHandler(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	if _, err := r.service.SetLocationHours(req.Context(), vars["id"], vars["locationId"], nil); err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// search businesses around a point: ?lat=&lng=&radius=(meters)&category=(ID, repeatable). Paginated
+func (r resource) nearbyHandler(w http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+	lat, latErr := strconv.ParseFloat(params.Get("lat"), 64)
+	lng, lngErr := strconv.ParseFloat(params.Get("lng"), 64)
+	if latErr != nil || lngErr != nil {
+		http.Error(w, "Valid lat and lng query parameters are required", http.StatusBadRequest)
+		return
+	}
+	query := NearbyQuery{Lat: lat, Lng: lng}
+	if radius := params.Get("radius"); radius != "" {
+		var err error
+		if query.Radius, err = strconv.ParseFloat(radius, 64); err != nil || query.Radius <= 0 {
+			http.Error(w, "The radius must be a positive number of meters", http.StatusBadRequest)
+			return
+		}
+	}
+	for _, value := range params["category"] {
+		for _, id := range strings.Split(value, ",") {
+			categoryId, err := primitive.ObjectIDFromHex(strings.TrimSpace(id))
+			if err != nil {
+				http.Error(w, "Invalid category ID: "+id, http.StatusBadRequest)
+				return
+			}
+			query.CategoryIDs = append(query.CategoryIDs, categoryId)
+		}
+	}
+
+	pages := pagination.NewFromRequest(req, -1)
+	results, err := r.service.Nearby(req.Context(), query, pages.Offset(), pages.Limit())
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+	pages.Items = results
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(pages)
+}
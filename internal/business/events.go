@@ -0,0 +1,19 @@
+package business
+
+// EventRegistered is the type of the event published when a business signs up.
+const EventRegistered = "business.registered"
+
+// Registered is published in the transaction creating a business and its owner account.
+type Registered struct {
+	BusinessID string `json:"business_id"`
+	OwnerID    string `json:"owner_id"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	OwnerName  string `json:"owner_name"`
+}
+
+// EventType returns the type of the event.
+func (e Registered) EventType() string { return EventRegistered }
+
+// AggregateID returns the ID of the business.
+func (e Registered) AggregateID() string { return e.BusinessID }
@@ -9,6 +9,9 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"time"
 )
 
 // Repository encapsulates the logic to access categories from the data source.
@@ -18,6 +21,20 @@ type Repository interface {
 	GetByEmail(ctx context.Context, email string) (entity.Business, error)
 	Create(ctx context.Context, business entity.Business) (*primitive.ObjectID, error)
 	StartSession() (mongo.Session, error)
+	// AddLocation appends a location to the business with the specified ID.
+	AddLocation(ctx context.Context, businessId primitive.ObjectID, location entity.Location) error
+	// UpdateLocation replaces the location with the same ID in the business with the specified ID.
+	UpdateLocation(ctx context.Context, businessId primitive.ObjectID, location entity.Location) error
+	// SetLocationHours sets the opening hours of a location. Nil hours remove them.
+	SetLocationHours(ctx context.Context, businessId, locationId primitive.ObjectID, hours *entity.OpeningHours) error
+	// DeleteLocation removes a location from the business with the specified ID.
+	DeleteLocation(ctx context.Context, businessId, locationId primitive.ObjectID) error
+	// Nearby returns the businesses having a location within the query radius, nearest first.
+	Nearby(ctx context.Context, query NearbyQuery, offset, limit int) ([]NearbyBusiness, error)
+	// SetAPIKeyHash replaces the API key hash of the business with the specified ID.
+	SetAPIKeyHash(ctx context.Context, id primitive.ObjectID, hash string) error
+	// GetByAPIKeyHash returns the business whose API key has the given hash.
+	GetByAPIKeyHash(ctx context.Context, hash string) (entity.Business, error)
 }
 
 // repository persists albums in database
@@ -28,7 +45,26 @@ type repository struct {
 
 func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
 	col := db.DB().Collection("businesses")
-	return repository{col, logger}
+	r := repository{col, logger}
+	r.ensureIndexes()
+	return r
+}
+
+// ensureIndexes creates the indexes required by the repository queries if they do not exist yet.
+func (r repository) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"locations.point": "2dsphere"}},
+		{
+			Keys:    bson.D{{Key: "name", Value: "text"}, {Key: "description", Value: "text"}},
+			Options: options.Index().SetName("text_search").SetWeights(bson.M{"name": 10, "description": 2}),
+		},
+		{Keys: bson.M{"api_key_hash": 1}, Options: options.Index().SetUnique(true).SetSparse(true)},
+	})
+	if err != nil {
+		r.logger.Errorf("failed to create business indexes: %v", err)
+	}
 }
 
 func (r repository) StartSession() (mongo.Session, error) {
@@ -44,7 +80,7 @@ func (r repository) Get(ctx context.Context, id primitive.ObjectID) (entity.Busi
 }
 
 func (r repository) GetByEmail(ctx context.Context, email string) (entity.Business, error) {
-	filter := bson.M{"email": bson.M{"$regex": primitive.Regex{Pattern: "^" + email + "$", Options: "i"}}}
+	filter := bson.M{"email": bson.M{"$regex": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(email) + "$", Options: "i"}}}
 	var business entity.Business
 	err := r.collection.FindOne(ctx, filter).Decode(&business)
 
@@ -61,3 +97,101 @@ func (r repository) Create(ctx context.Context, category entity.Business) (*prim
 	id := result.InsertedID.(primitive.ObjectID)
 	return &id, err
 }
+
+func (r repository) AddLocation(ctx context.Context, businessId primitive.ObjectID, location entity.Location) error {
+	filter := bson.M{"_id": businessId}
+	update := bson.M{"$push": bson.M{"locations": location}}
+	return r.updateOne(ctx, filter, update)
+}
+
+func (r repository) UpdateLocation(ctx context.Context, businessId primitive.ObjectID, location entity.Location) error {
+	filter := bson.M{"_id": businessId, "locations._id": location.ID}
+	update := bson.M{"$set": bson.M{"locations.$": location}}
+	return r.updateOne(ctx, filter, update)
+}
+
+func (r repository) SetLocationHours(ctx context.Context, businessId, locationId primitive.ObjectID, hours *entity.OpeningHours) error {
+	filter := bson.M{"_id": businessId, "locations._id": locationId}
+	update := bson.M{"$set": bson.M{"locations.$.hours": hours}}
+	if hours == nil {
+		update = bson.M{"$unset": bson.M{"locations.$.hours": ""}}
+	}
+	return r.updateOne(ctx, filter, update)
+}
+
+func (r repository) DeleteLocation(ctx context.Context, businessId, locationId primitive.ObjectID) error {
+	filter := bson.M{"_id": businessId, "locations._id": locationId}
+	update := bson.M{"$pull": bson.M{"locations": bson.M{"_id": locationId}}}
+	return r.updateOne(ctx, filter, update)
+}
+
+func (r repository) SetAPIKeyHash(ctx context.Context, id primitive.ObjectID, hash string) error {
+	return r.updateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"api_key_hash": hash}})
+}
+
+func (r repository) GetByAPIKeyHash(ctx context.Context, hash string) (entity.Business, error) {
+	var business entity.Business
+	err := r.collection.FindOne(ctx, bson.M{"api_key_hash": hash}).Decode(&business)
+	return business, err
+}
+
+// updateOne applies the update to the document matching the filter and reports a missing document as mongo.ErrNoDocuments.
+func (r repository) updateOne(ctx context.Context, filter, update bson.M) error {
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r repository) Nearby(ctx context.Context, query NearbyQuery, offset, limit int) ([]NearbyBusiness, error) {
+	// businesses held for moderation are not listed
+	filter := bson.M{"moderation": nil}
+	if len(query.CategoryIDs) > 0 {
+		filter["category_id"] = bson.M{"$in": query.CategoryIDs}
+	}
+	// $geoNear returns every business once, using the distance of its nearest location
+	pipeline := []bson.M{
+		{"$geoNear": bson.M{
+			"near":          entity.NewGeoPoint(query.Lat, query.Lng),
+			"key":           "locations.point",
+			"spherical":     true,
+			"maxDistance":   query.Radius,
+			"distanceField": "distance",
+			"includeLocs":   "nearest_point",
+			"query":         filter,
+		}},
+		{"$skip": offset},
+		{"$limit": limit},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		entity.Business `bson:",inline"`
+		Distance        float64         `bson:"distance"`
+		NearestPoint    entity.GeoPoint `bson:"nearest_point"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	results := make([]NearbyBusiness, 0, len(docs))
+	for _, doc := range docs {
+		result := NearbyBusiness{Business: Business{doc.Business}, Distance: doc.Distance}
+		for _, location := range doc.Locations {
+			if location.Point.Lat() == doc.NearestPoint.Lat() && location.Point.Lng() == doc.NearestPoint.Lng() {
+				result.Location = location
+				break
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -2,18 +2,29 @@ package business
 
 import (
 	"context"
-	"errors"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/ysodiqakanni/trustank-api/internal/auth"
 	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	apperrors "github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/internal/suggestion"
 	"github.com/ysodiqakanni/trustank-api/internal/user"
+	"github.com/ysodiqakanni/trustank-api/pkg/events"
+	"github.com/ysodiqakanni/trustank-api/pkg/geocode"
 	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/textfilter"
+	"github.com/ysodiqakanni/trustank-api/pkg/tracing"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readconcern"
 	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"time"
 )
 
 // Service encapsulates use case logic for businesses.
@@ -21,6 +32,42 @@ type Service interface {
 	Get(ctx context.Context, id primitive.ObjectID) (Business, error)
 	Register(ctx context.Context, req CreateBusinessRequest) (Business, error)
 	GetByName(ctx context.Context, name string) (Business, error)
+	// AddLocation adds a physical location to a business owned by the current user.
+	AddLocation(ctx context.Context, businessId string, req LocationRequest) (entity.Location, error)
+	// UpdateLocation updates a location of a business owned by the current user.
+	UpdateLocation(ctx context.Context, businessId, locationId string, req LocationRequest) (entity.Location, error)
+	// GetLocation returns a location of a business with its current opening status.
+	GetLocation(ctx context.Context, businessId, locationId string) (entity.Location, error)
+	// SetLocationHours sets the opening hours of a location of a business owned by the current user.
+	// Nil hours remove them.
+	SetLocationHours(ctx context.Context, businessId, locationId string, hours *entity.OpeningHours) (entity.Location, error)
+	// DeleteLocation removes a location from a business owned by the current user.
+	DeleteLocation(ctx context.Context, businessId, locationId string) error
+	// Nearby returns the businesses having a location within the query radius, nearest first.
+	Nearby(ctx context.Context, query NearbyQuery, offset, limit int) ([]NearbyBusiness, error)
+	// GetOwned returns a business if the current user or API key is allowed to manage it.
+	GetOwned(ctx context.Context, businessId string) (Business, error)
+	// CreateAPIKey generates a new API key for a business owned by the current user, replacing the previous one.
+	// Only the hash of the key is stored, so it cannot be retrieved later.
+	CreateAPIKey(ctx context.Context, businessId string) (string, error)
+	// AuthenticateAPIKey returns the ID of the business owning an API key.
+	AuthenticateAPIKey(ctx context.Context, key string) (primitive.ObjectID, error)
+}
+
+const (
+	// DefaultNearbyRadius is the search radius in meters used when none is specified.
+	DefaultNearbyRadius = 5000
+	// MaxNearbyRadius is the largest search radius in meters that can be requested.
+	MaxNearbyRadius = 50000
+	// apiKeyPrefix starts every business API key so that keys are easy to recognize, e.g. by secret scanners.
+	apiKeyPrefix = "tk_"
+)
+
+// textPolicies tells how profanity and personal information found in the text fields of a business are handled.
+var textPolicies = map[string]textfilter.Policy{
+	"businessName": {Profanity: textfilter.Reject, PII: textfilter.Reject},
+	"description":  {Profanity: textfilter.Mask, PII: textfilter.Queue},
+	"locationName": {Profanity: textfilter.Reject, PII: textfilter.Reject},
 }
 
 // Business represents the data about a BusinessCategory.
@@ -30,7 +77,10 @@ type Business struct {
 
 // CreateBusinessCategoryRequest represents an category creation request.
 type CreateBusinessRequest struct {
-	BusinessName    string `json:"businessName,omitempty" validate:"required"`
+	BusinessName string `json:"businessName,omitempty" validate:"required"`
+	Description  string `json:"description,omitempty"`
+	// Locale selects the profanity word list used to check the text fields, e.g. "en". All lists are used when empty.
+	Locale          string `json:"locale,omitempty"`
 	Website         string `json:"website,omitempty" validate:"url"`
 	OwnerFullName   string `json:"ownerFullName,omitempty" validate:"required"`
 	OwnerJobTitle   string
@@ -44,6 +94,7 @@ type CreateBusinessRequest struct {
 func (m CreateBusinessRequest) Validate() error {
 	return validation.ValidateStruct(&m,
 		validation.Field(&m.BusinessName, validation.Required, validation.Length(2, 128)),
+		validation.Field(&m.Description, validation.Length(0, 2000)),
 		validation.Field(&m.OwnerFullName, validation.Required, validation.Length(5, 128)),
 		validation.Field(&m.WorkEmail, validation.Required, validation.Length(7, 128), is.Email),
 		validation.Field(&m.Password, validation.Required, validation.Length(4, 128)),
@@ -52,46 +103,120 @@ func (m CreateBusinessRequest) Validate() error {
 	)
 }
 
+// LocationRequest represents the data needed to create or update a business location.
+// The coordinates are looked up from the address when they are not provided.
+type LocationRequest struct {
+	Name    string         `json:"name"`
+	Address entity.Address `json:"address"`
+	Lat     *float64       `json:"lat"`
+	Lng     *float64       `json:"lng"`
+}
+
+// Validate validates the LocationRequest fields.
+func (m LocationRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.Length(0, 128)),
+		validation.Field(&m.Address, validation.By(validateAddress)),
+		validation.Field(&m.Lat, validation.Min(-90.0), validation.Max(90.0), validation.When(m.Lng != nil, validation.NotNil)),
+		validation.Field(&m.Lng, validation.Min(-180.0), validation.Max(180.0), validation.When(m.Lat != nil, validation.NotNil)),
+	)
+}
+
+func validateAddress(value interface{}) error {
+	a, _ := value.(entity.Address)
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Line1, validation.Required, validation.Length(0, 256)),
+		validation.Field(&a.Line2, validation.Length(0, 256)),
+		validation.Field(&a.City, validation.Required, validation.Length(0, 128)),
+		validation.Field(&a.Region, validation.Length(0, 128)),
+		validation.Field(&a.PostalCode, validation.Length(0, 32)),
+		validation.Field(&a.Country, validation.Required, is.CountryCode2),
+	)
+}
+
+// NearbyQuery represents a search for businesses around a point.
+type NearbyQuery struct {
+	Lat float64
+	Lng float64
+	// Radius is the search radius in meters.
+	Radius float64
+	// CategoryIDs optionally restricts the search to businesses in the given categories.
+	CategoryIDs []primitive.ObjectID
+}
+
+// Validate validates the NearbyQuery fields.
+func (m NearbyQuery) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Lat, validation.Min(-90.0), validation.Max(90.0)),
+		validation.Field(&m.Lng, validation.Min(-180.0), validation.Max(180.0)),
+		validation.Field(&m.Radius, validation.Min(0.0), validation.Max(float64(MaxNearbyRadius))),
+	)
+}
+
+// NearbyBusiness represents a business found by a nearby search together with its nearest location.
+type NearbyBusiness struct {
+	Business
+	// Distance is the distance in meters between the searched point and the nearest location.
+	Distance float64         `json:"distance"`
+	Location entity.Location `json:"location"`
+}
+
 type service struct {
-	repo     Repository
-	userRepo user.Repository
-	logger   log.Logger
+	repo        Repository
+	userRepo    user.Repository
+	geocoder    geocode.Geocoder
+	suggestions suggestion.Updater
+	textFilter  *textfilter.Filter
+	events      events.Publisher
+	logger      log.Logger
 }
 
 // NewService creates a new category service.
-func NewService(repo Repository, userRepo user.Repository, logger log.Logger) Service {
-	return service{repo, userRepo, logger}
+func NewService(repo Repository, userRepo user.Repository, geocoder geocode.Geocoder, suggestions suggestion.Updater, textFilter *textfilter.Filter, events events.Publisher, logger log.Logger) Service {
+	return service{repo, userRepo, geocoder, suggestions, textFilter, events, logger}
 }
 
 // Get returns the album with the specified the album ID.
 func (s service) Get(ctx context.Context, id primitive.ObjectID) (Business, error) {
+	ctx, span := tracing.Start(ctx, "business.Get")
+	defer span.End()
 	business, err := s.repo.Get(ctx, id)
 	if err != nil {
 		return Business{}, err
 	}
-	return Business{business}, nil
+	return Business{withOpeningStatus(business, time.Now())}, nil
 }
 
 func (s service) GetByName(ctx context.Context, name string) (Business, error) {
+	ctx, span := tracing.Start(ctx, "business.GetByName")
+	defer span.End()
 	business, err := s.repo.GetByEmail(ctx, name)
 	if err != nil {
 		return Business{}, err
 	}
-	return Business{business}, nil
+	return Business{withOpeningStatus(business, time.Now())}, nil
 }
 
 func (s service) Register(ctx context.Context, req CreateBusinessRequest) (Business, error) {
+	ctx, span := tracing.Start(ctx, "business.Register")
+	defer span.End()
 	if err := req.Validate(); err != nil {
 		return Business{}, err
 	}
+	moderation, err := s.filterText(&req)
+	if err != nil {
+		return Business{}, err
+	}
 	// check if a user with that name exists
 	existing, err := s.userRepo.GetByEmail(ctx, req.WorkEmail)
 	emptyId := primitive.ObjectID{}
 	if err == nil || existing.ID != emptyId {
-		return Business{}, errors.New("A business_ with this email already exists")
+		return Business{}, apperrors.BadRequest("A business_ with this email already exists")
 	}
 
+	_, hashing := tracing.Start(ctx, "bcrypt.GenerateFromPassword")
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), 12)
+	hashing.End()
 	if err != nil {
 		return Business{}, err
 	}
@@ -108,6 +233,7 @@ func (s service) Register(ctx context.Context, req CreateBusinessRequest) (Busin
 	defer session.EndSession(context.Background())
 
 	// Start the transaction
+	var business entity.Business
 	err = mongo.WithSession(context.Background(), session, func(sessionContext mongo.SessionContext) error {
 		err := session.StartTransaction(transactionOptions)
 		if err != nil {
@@ -121,24 +247,41 @@ func (s service) Register(ctx context.Context, req CreateBusinessRequest) (Busin
 			Role:           []string{"business_"},
 		}
 		// Insert the user document
-		_, err = s.userRepo.Create(sessionContext, user)
+		userId, err := s.userRepo.Create(sessionContext, user)
 		if err != nil {
 			session.AbortTransaction(sessionContext)
 			return err
 		}
+		user.ID = *userId
 
 		// Create a business_ object
-		business := entity.Business{
+		business = entity.Business{
 			Name:          req.BusinessName,
+			Description:   req.Description,
 			Email:         req.WorkEmail,
 			Website:       req.Website,
 			OwnerId:       user.ID,
 			OwnerName:     req.OwnerFullName,
 			OwnerJobTitle: req.OwnerJobTitle,
+			Moderation:    moderation,
 		}
 
 		// Insert the profile document
-		_, err = s.repo.Create(sessionContext, business)
+		businessId, err := s.repo.Create(sessionContext, business)
+		if err != nil {
+			session.AbortTransaction(sessionContext)
+			return err
+		}
+		business.ID = *businessId
+
+		// Publish the signup in the same transaction, so that its handlers run if and only if it is committed
+		err = s.events.Publish(sessionContext, Registered{
+			BusinessID: business.ID.Hex(),
+			OwnerID:    user.ID.Hex(),
+			Name:       business.Name,
+			Email:      business.Email,
+			OwnerName:  business.OwnerName,
+		})
 		if err != nil {
 			session.AbortTransaction(sessionContext)
 			return err
@@ -152,6 +295,286 @@ func (s service) Register(ctx context.Context, req CreateBusinessRequest) (Busin
 
 		return nil
 	})
+	if err != nil {
+		return Business{}, err
+	}
 
-	return Business{}, nil
+	s.suggestions.BusinessChanged(business)
+	return Business{business}, nil
+}
+
+func (s service) AddLocation(ctx context.Context, businessId string, req LocationRequest) (entity.Location, error) {
+	ctx, span := tracing.Start(ctx, "business.AddLocation")
+	defer span.End()
+	business, err := s.getOwned(ctx, businessId)
+	if err != nil {
+		return entity.Location{}, err
+	}
+	location, err := s.buildLocation(ctx, primitive.NewObjectID(), req)
+	if err != nil {
+		return entity.Location{}, err
+	}
+	if err := s.repo.AddLocation(ctx, business.ID, location); err != nil {
+		return entity.Location{}, err
+	}
+	return location, nil
+}
+
+func (s service) UpdateLocation(ctx context.Context, businessId, locationId string, req LocationRequest) (entity.Location, error) {
+	ctx, span := tracing.Start(ctx, "business.UpdateLocation")
+	defer span.End()
+	business, err := s.getOwned(ctx, businessId)
+	if err != nil {
+		return entity.Location{}, err
+	}
+	id, err := primitive.ObjectIDFromHex(locationId)
+	if err != nil {
+		return entity.Location{}, apperrors.NotFound("")
+	}
+	existing, ok := findLocation(business, id)
+	if !ok {
+		return entity.Location{}, apperrors.NotFound("")
+	}
+	location, err := s.buildLocation(ctx, id, req)
+	if err != nil {
+		return entity.Location{}, err
+	}
+	// opening hours are managed separately and must survive address changes
+	location.Hours = existing.Hours
+	if err := s.repo.UpdateLocation(ctx, business.ID, location); err != nil {
+		return entity.Location{}, err
+	}
+	location.SetOpeningStatus(time.Now())
+	return location, nil
+}
+
+func (s service) GetLocation(ctx context.Context, businessId, locationId string) (entity.Location, error) {
+	ctx, span := tracing.Start(ctx, "business.GetLocation")
+	defer span.End()
+	id, err := primitive.ObjectIDFromHex(businessId)
+	if err != nil {
+		return entity.Location{}, apperrors.NotFound("")
+	}
+	business, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return entity.Location{}, err
+	}
+	lid, err := primitive.ObjectIDFromHex(locationId)
+	if err != nil {
+		return entity.Location{}, apperrors.NotFound("")
+	}
+	location, ok := findLocation(business, lid)
+	if !ok {
+		return entity.Location{}, apperrors.NotFound("")
+	}
+	location.SetOpeningStatus(time.Now())
+	return location, nil
+}
+
+func (s service) SetLocationHours(ctx context.Context, businessId, locationId string, hours *entity.OpeningHours) (entity.Location, error) {
+	ctx, span := tracing.Start(ctx, "business.SetLocationHours")
+	defer span.End()
+	business, err := s.getOwned(ctx, businessId)
+	if err != nil {
+		return entity.Location{}, err
+	}
+	id, err := primitive.ObjectIDFromHex(locationId)
+	if err != nil {
+		return entity.Location{}, apperrors.NotFound("")
+	}
+	location, ok := findLocation(business, id)
+	if !ok {
+		return entity.Location{}, apperrors.NotFound("")
+	}
+	if hours != nil {
+		if err := hours.Validate(); err != nil {
+			return entity.Location{}, apperrors.BadRequest(err.Error())
+		}
+	}
+	if err := s.repo.SetLocationHours(ctx, business.ID, id, hours); err != nil {
+		return entity.Location{}, err
+	}
+	location.Hours = hours
+	location.SetOpeningStatus(time.Now())
+	return location, nil
+}
+
+func (s service) DeleteLocation(ctx context.Context, businessId, locationId string) error {
+	ctx, span := tracing.Start(ctx, "business.DeleteLocation")
+	defer span.End()
+	business, err := s.getOwned(ctx, businessId)
+	if err != nil {
+		return err
+	}
+	id, err := primitive.ObjectIDFromHex(locationId)
+	if err != nil {
+		return apperrors.NotFound("")
+	}
+	return s.repo.DeleteLocation(ctx, business.ID, id)
+}
+
+func (s service) Nearby(ctx context.Context, query NearbyQuery, offset, limit int) ([]NearbyBusiness, error) {
+	ctx, span := tracing.Start(ctx, "business.Nearby")
+	defer span.End()
+	if query.Radius == 0 {
+		query.Radius = DefaultNearbyRadius
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	results, err := s.repo.Nearby(ctx, query, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range results {
+		results[i].Business.Business = withOpeningStatus(results[i].Business.Business, now)
+		results[i].Location.SetOpeningStatus(now)
+	}
+	return results, nil
+}
+
+func (s service) GetOwned(ctx context.Context, businessId string) (Business, error) {
+	ctx, span := tracing.Start(ctx, "business.GetOwned")
+	defer span.End()
+	business, err := s.getOwned(ctx, businessId)
+	if err != nil {
+		return Business{}, err
+	}
+	return Business{business}, nil
+}
+
+func (s service) CreateAPIKey(ctx context.Context, businessId string) (string, error) {
+	ctx, span := tracing.Start(ctx, "business.CreateAPIKey")
+	defer span.End()
+	business, err := s.getOwned(ctx, businessId)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(b)
+	if err := s.repo.SetAPIKeyHash(ctx, business.ID, hashAPIKey(key)); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func (s service) AuthenticateAPIKey(ctx context.Context, key string) (primitive.ObjectID, error) {
+	ctx, span := tracing.Start(ctx, "business.AuthenticateAPIKey")
+	defer span.End()
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return primitive.NilObjectID, apperrors.Unauthorized("")
+	}
+	business, err := s.repo.GetByAPIKeyHash(ctx, hashAPIKey(key))
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return business.ID, nil
+}
+
+// hashAPIKey returns the hex-encoded SHA-256 hash of an API key.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// filterText checks the text fields of a registration against textPolicies, masking them in place.
+// A moderation record is returned if any field must be reviewed by a moderator.
+func (s service) filterText(req *CreateBusinessRequest) (*entity.Moderation, error) {
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"businessName", &req.BusinessName},
+		{"description", &req.Description},
+	}
+	var moderation *entity.Moderation
+	for _, field := range fields {
+		result, err := s.textFilter.Check(*field.value, req.Locale, textPolicies[field.name])
+		if err != nil {
+			return nil, validation.Errors{field.name: err}
+		}
+		*field.value = result.Text
+		if result.NeedsModeration {
+			if moderation == nil {
+				moderation = &entity.Moderation{Status: entity.ModerationPending, FlaggedAt: time.Now()}
+			}
+			moderation.Fields = append(moderation.Fields, field.name)
+			moderation.Reasons = append(moderation.Reasons, result.Reasons()...)
+		}
+	}
+	return moderation, nil
+}
+
+// getOwned returns the business with the given ID if the current user owns it or is an admin,
+// or if the request is authenticated with the business API key.
+func (s service) getOwned(ctx context.Context, businessId string) (entity.Business, error) {
+	id, err := primitive.ObjectIDFromHex(businessId)
+	if err != nil {
+		return entity.Business{}, apperrors.NotFound("")
+	}
+	business, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return entity.Business{}, err
+	}
+	if businessId, ok := auth.CurrentBusinessID(ctx); ok {
+		if businessId != business.ID {
+			return entity.Business{}, apperrors.Forbidden("")
+		}
+		return business, nil
+	}
+	if userId, ok := auth.CurrentUserID(ctx); (!ok || userId != business.OwnerId) && !auth.HasRole(ctx, "admin") {
+		return entity.Business{}, apperrors.Forbidden("")
+	}
+	return business, nil
+}
+
+// buildLocation validates a location request and geocodes its address if no coordinates are given.
+func (s service) buildLocation(ctx context.Context, id primitive.ObjectID, req LocationRequest) (entity.Location, error) {
+	if err := req.Validate(); err != nil {
+		return entity.Location{}, err
+	}
+	// location names are shown publicly next to the business name and follow the same rules
+	if _, err := s.textFilter.Check(req.Name, "", textPolicies["locationName"]); err != nil {
+		return entity.Location{}, validation.Errors{"name": err}
+	}
+	location := entity.Location{
+		ID:      id,
+		Name:    req.Name,
+		Address: req.Address,
+	}
+	if req.Lat != nil && req.Lng != nil {
+		location.Point = entity.NewGeoPoint(*req.Lat, *req.Lng)
+		return location, nil
+	}
+
+	coordinates, err := s.geocoder.Geocode(ctx, req.Address.String())
+	if err == geocode.ErrNotFound {
+		return entity.Location{}, apperrors.BadRequest("The address could not be located. Please provide its coordinates.")
+	} else if err != nil {
+		return entity.Location{}, err
+	}
+	location.Point = entity.NewGeoPoint(coordinates.Lat, coordinates.Lng)
+	return location, nil
+}
+
+// findLocation returns the location of the business with the given ID.
+func findLocation(business entity.Business, id primitive.ObjectID) (entity.Location, bool) {
+	for _, location := range business.Locations {
+		if location.ID == id {
+			return location, true
+		}
+	}
+	return entity.Location{}, false
+}
+
+// withOpeningStatus computes the opening status of every location of the business at the given instant.
+func withOpeningStatus(business entity.Business, now time.Time) entity.Business {
+	for i := range business.Locations {
+		business.Locations[i].SetOpeningStatus(now)
+	}
+	return business
 }
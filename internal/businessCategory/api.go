@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/ysodiqakanni/trustank-api/internal/auth"
+	"github.com/ysodiqakanni/trustank-api/internal/errors"
 	"github.com/ysodiqakanni/trustank-api/pkg/log"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
 	"net/http"
+	"strconv"
 )
 
 func RegisterHandlers(r *mux.Router, service Service, logger log.Logger, secret string) {
@@ -16,12 +19,14 @@ func RegisterHandlers(r *mux.Router, service Service, logger log.Logger, secret
 	r.HandleFunc("/api/v1/categories", res.getByNameHandler).Methods("GET")
 	r.HandleFunc("/api/v1/categories/search", res.searchCategoriesHandler).Methods("GET")
 	r.HandleFunc("/api/v1/categories/featured", res.getFeaturedCategoriesHandler).Methods("GET")
+	r.HandleFunc("/api/v1/categories/{id}/icon", res.getIconHandler).Methods("GET")
 
 	// Protected Endpoints
 	//r.Handle("/api/v1/categories", auth.AuthenticateMiddleware(http.HandlerFunc(res.create), secret)).Methods("POST")
 	r.Handle("/api/v1/categories", auth.AuthenticateMiddleware(auth.RoleMiddleware(http.HandlerFunc(res.create), "admin"), secret)).Methods("POST")
 	r.Handle("/api/v1/categories", auth.AuthenticateMiddleware(auth.RoleMiddleware(http.HandlerFunc(res.updateCategoryHandler), "admin"), secret)).Methods("PUT")
 	r.Handle("/api/v1/categories", auth.AuthenticateMiddleware(auth.RoleMiddleware(http.HandlerFunc(res.deleteCategoryHandler), "admin"), secret)).Methods("DELETE")
+	r.Handle("/api/v1/categories/{id}/icon", auth.AuthenticateMiddleware(auth.RoleMiddleware(http.HandlerFunc(res.uploadIconHandler), "admin"), secret)).Methods("POST")
 	r.Use()
 }
 
@@ -128,3 +133,49 @@ func (r resource) getFeaturedCategoriesHandler(w http.ResponseWriter, req *http.
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(results)
 }
+
+// upload the icon of a category. The image is expected in the "icon" field of a multipart form.
+func (r resource) uploadIconHandler(w http.ResponseWriter, req *http.Request) {
+	// leave some room for the multipart envelope around the image itself
+	req.Body = http.MaxBytesReader(w, req.Body, MaxIconSize+64<<10)
+	file, _, err := req.FormFile("icon")
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		http.Error(w, "A multipart form with an \"icon\" file no larger than 1 MB is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	category, err := r.service.UploadIcon(req.Context(), mux.Vars(req)["id"], file)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(category)
+}
+
+// serve the icon of a category, or redirect to it if the storage can serve it directly.
+func (r resource) getIconHandler(w http.ResponseWriter, req *http.Request) {
+	icon, url, err := r.service.GetIcon(req.Context(), mux.Vars(req)["id"])
+	if err != nil {
+		errors.Write(w, err)
+		return
+	}
+	if url != "" {
+		http.Redirect(w, req, url, http.StatusFound)
+		return
+	}
+	defer icon.Close()
+
+	w.Header().Set("Content-Type", icon.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if icon.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(icon.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, icon)
+}
@@ -9,6 +9,9 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"time"
 )
 
 // Repository encapsulates the logic to access categories from the data source.
@@ -18,6 +21,8 @@ type Repository interface {
 	GetByName(ctx context.Context, id string) (entity.BusinessCategory, error)
 	Create(ctx context.Context, category entity.BusinessCategory) (*primitive.ObjectID, error)
 	Update(ctx context.Context, category entity.BusinessCategory) (*primitive.ObjectID, error)
+	// UpdateIcon sets the storage key and URL of the icon of the category with the specified ID.
+	UpdateIcon(ctx context.Context, id primitive.ObjectID, key, url string) error
 	GetFeaturedList(ctx context.Context) []BusinessCategory
 	SearchCategories(ctx context.Context, keyword string) []BusinessCategory
 
@@ -33,7 +38,24 @@ type repository struct {
 func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
 	col := db.DB().Collection("business_categories")
 	logger.Infof("collection retrieved")
-	return repository{col, logger}
+	r := repository{col, logger}
+	r.ensureIndexes()
+	return r
+}
+
+// ensureIndexes creates the indexes required by the repository queries if they do not exist yet.
+func (r repository) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "name", Value: "text"}, {Key: "description", Value: "text"}},
+			Options: options.Index().SetName("text_search").SetWeights(bson.M{"name": 10, "description": 2}),
+		},
+	})
+	if err != nil {
+		r.logger.Errorf("failed to create business category indexes: %v", err)
+	}
 }
 
 func (r repository) StartSession() (mongo.Session, error) {
@@ -51,7 +73,7 @@ func (r repository) Get(ctx context.Context, id primitive.ObjectID) (entity.Busi
 
 func (r repository) GetByName(ctx context.Context, name string) (entity.BusinessCategory, error) {
 	fmt.Println("Getting category by name")
-	filter := bson.M{"name": bson.M{"$regex": primitive.Regex{Pattern: "^" + name + "$", Options: "i"}}}
+	filter := bson.M{"name": bson.M{"$regex": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(name) + "$", Options: "i"}}}
 	var category entity.BusinessCategory
 	err := r.collection.FindOne(ctx, filter).Decode(&category)
 
@@ -80,9 +102,24 @@ func (r repository) Update(ctx context.Context, category entity.BusinessCategory
 		return nil, err
 	}
 
+	if result.MatchedCount == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
 	fmt.Printf("document updated")
-	id := result.UpsertedID.(primitive.ObjectID)
-	return &id, err
+	return &category.ID, nil
+}
+
+func (r repository) UpdateIcon(ctx context.Context, id primitive.ObjectID, key, url string) error {
+	filter := bson.M{"_id": id}
+	update := bson.M{"$set": bson.M{"iconKey": key, "iconUrl": url, "updatedat": time.Now()}}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
 }
 
 func (r repository) GetFeaturedList(ctx context.Context) []BusinessCategory {
@@ -95,14 +132,20 @@ func (r repository) GetFeaturedList(ctx context.Context) []BusinessCategory {
 	}
 	defer cursor.Close(ctx)
 
-	categories := CursorToBusinessCategories(ctx, cursor)
+	categories, err := CursorToBusinessCategories(ctx, cursor)
+	if err != nil {
+		r.logger.Error(err)
+		return []BusinessCategory{}
+	}
 	return categories
 }
 func (r repository) SearchCategories(ctx context.Context, keyword string) []BusinessCategory {
+	// the keyword is matched literally: it must never be interpreted as a regular expression
+	pattern := regexp.QuoteMeta(keyword)
 	filter := bson.M{
 		"$or": []bson.M{
-			{"name": bson.M{"$regex": keyword, "$options": "i"}},
-			{"description": bson.M{"$regex": keyword, "$options": "i"}},
+			{"name": bson.M{"$regex": pattern, "$options": "i"}},
+			{"description": bson.M{"$regex": pattern, "$options": "i"}},
 		},
 	}
 	cursor, err := r.collection.Find(ctx, filter)
@@ -112,28 +155,29 @@ func (r repository) SearchCategories(ctx context.Context, keyword string) []Busi
 	}
 	defer cursor.Close(ctx)
 
-	categories := CursorToBusinessCategories(ctx, cursor)
+	categories, err := CursorToBusinessCategories(ctx, cursor)
+	if err != nil {
+		r.logger.Error(err)
+		return []BusinessCategory{}
+	}
 	return categories
 }
 
-func CursorToBusinessCategories(ctx context.Context, cursor *mongo.Cursor) []BusinessCategory {
+// CursorToBusinessCategories decodes every document of the cursor into a BusinessCategory.
+func CursorToBusinessCategories(ctx context.Context, cursor *mongo.Cursor) ([]BusinessCategory, error) {
 	var categories []BusinessCategory = []BusinessCategory{}
 
 	// Iterate through the cursor and unmarshal each document into a BusinessCategory struct
 	for cursor.Next(ctx) {
 		var category entity.BusinessCategory
-		err := cursor.Decode(&category)
-		if err != nil {
-			fmt.Errorf(err.Error())
-			return []BusinessCategory{}
+		if err := cursor.Decode(&category); err != nil {
+			return nil, err
 		}
 		categories = append(categories, BusinessCategory{category})
 	}
 
 	if err := cursor.Err(); err != nil {
-		// Handle any cursor error
-		fmt.Errorf(err.Error())
-		return []BusinessCategory{}
+		return nil, err
 	}
-	return categories
+	return categories, nil
 }
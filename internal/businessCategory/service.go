@@ -1,14 +1,23 @@
 package businessCategory
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
 	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	apperrors "github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/internal/suggestion"
+	"github.com/ysodiqakanni/trustank-api/pkg/imaging"
 	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/storage"
+	"github.com/ysodiqakanni/trustank-api/pkg/tracing"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"regexp"
 	"time"
 )
@@ -22,6 +31,24 @@ type Service interface {
 	GetFeatured(ctx context.Context) []BusinessCategory
 	Search(ctx context.Context, keyword string) []BusinessCategory
 	Delete(ctx context.Context, categoryId string) error
+	// UploadIcon validates the image read from r and stores it as the icon of the category, replacing any previous icon.
+	UploadIcon(ctx context.Context, categoryId string, r io.Reader) (BusinessCategory, error)
+	// GetIcon returns the icon of the category. If the storage can serve the icon directly,
+	// only the URL to redirect to is returned. Otherwise the caller must close the returned object.
+	GetIcon(ctx context.Context, categoryId string) (*storage.Object, string, error)
+}
+
+const (
+	// MaxIconSize is the maximum size in bytes of an uploaded category icon.
+	MaxIconSize = 1 << 20
+)
+
+// iconTypes lists the accepted icon MIME types and the file extensions they are stored with.
+var iconTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
 }
 
 // BusinessCategory represents the data about a BusinessCategory.
@@ -59,17 +86,21 @@ func (m UpdateBusinessCategoryRequest) Validate() error {
 }
 
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo        Repository
+	storage     storage.Storage
+	suggestions suggestion.Updater
+	logger      log.Logger
 }
 
 // NewService creates a new category service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+func NewService(repo Repository, storage storage.Storage, suggestions suggestion.Updater, logger log.Logger) Service {
+	return service{repo, storage, suggestions, logger}
 }
 
 // Get returns the album with the specified the album ID.
 func (s service) Get(ctx context.Context, id primitive.ObjectID) (BusinessCategory, error) {
+	ctx, span := tracing.Start(ctx, "businessCategory.Get")
+	defer span.End()
 	category, err := s.repo.Get(ctx, id)
 	if err != nil {
 		return BusinessCategory{}, err
@@ -78,6 +109,8 @@ func (s service) Get(ctx context.Context, id primitive.ObjectID) (BusinessCatego
 }
 
 func (s service) GetByName(ctx context.Context, name string) (*BusinessCategory, error) {
+	ctx, span := tracing.Start(ctx, "businessCategory.GetByName")
+	defer span.End()
 	category, err := s.repo.GetByName(ctx, name)
 	if err != nil {
 		return nil, err
@@ -85,6 +118,8 @@ func (s service) GetByName(ctx context.Context, name string) (*BusinessCategory,
 	return &BusinessCategory{category}, nil
 }
 func (s service) Create(ctx context.Context, req CreateBusinessCategoryRequest) (BusinessCategory, error) {
+	ctx, span := tracing.Start(ctx, "businessCategory.Create")
+	defer span.End()
 	if err := req.Validate(); err != nil {
 		return BusinessCategory{}, err
 	}
@@ -104,23 +139,44 @@ func (s service) Create(ctx context.Context, req CreateBusinessCategoryRequest)
 	if err != nil {
 		return BusinessCategory{}, err
 	}
-	return s.Get(ctx, *id)
+	category, err := s.Get(ctx, *id)
+	if err == nil {
+		s.suggestions.CategoryChanged(category.BusinessCategory)
+	}
+	return category, err
 }
 func (s service) Update(ctx context.Context, category UpdateBusinessCategoryRequest) (*entity.BusinessCategory, error) {
+	ctx, span := tracing.Start(ctx, "businessCategory.Update")
+	defer span.End()
 	objectId, _ := primitive.ObjectIDFromHex(category.Id)
 	existingCategory, err := s.repo.Get(ctx, objectId)
 	if err != nil {
 		return nil, err
 	}
+	// an icon URL set by hand replaces the uploaded icon, which is no longer referenced
+	orphanedIconKey := ""
+	if existingCategory.IconKey != "" && category.IconUrl != existingCategory.IconUrl {
+		orphanedIconKey = existingCategory.IconKey
+		existingCategory.IconKey = ""
+	}
 	existingCategory.Name = category.Name
 	existingCategory.IconUrl = category.IconUrl
 	existingCategory.UpdatedAt = time.Now()
 	fmt.Println("calling the repository layer for update")
 	_, err = s.repo.Update(ctx, existingCategory)
-	return &existingCategory, err
+	if err != nil {
+		return &existingCategory, err
+	}
+	if orphanedIconKey != "" {
+		s.deleteIcon(ctx, orphanedIconKey)
+	}
+	s.suggestions.CategoryChanged(existingCategory)
+	return &existingCategory, nil
 }
 
 func (s service) Delete(ctx context.Context, categoryId string) error {
+	ctx, span := tracing.Start(ctx, "businessCategory.Delete")
+	defer span.End()
 	objectId, _ := primitive.ObjectIDFromHex(categoryId)
 	existingCategory, err := s.repo.Get(ctx, objectId)
 	if err != nil {
@@ -129,15 +185,113 @@ func (s service) Delete(ctx context.Context, categoryId string) error {
 	existingCategory.IsDeleted = true
 	fmt.Println("calling the repository layer for update")
 	_, err = s.repo.Update(ctx, existingCategory)
+	if err == nil {
+		s.suggestions.CategoryRemoved(existingCategory.ID)
+	}
 	return err
 }
 
 func (s service) GetFeatured(ctx context.Context) []BusinessCategory {
+	ctx, span := tracing.Start(ctx, "businessCategory.GetFeatured")
+	defer span.End()
 	list := s.repo.GetFeaturedList(ctx)
 	return list
 }
 
 func (s service) Search(ctx context.Context, keyword string) []BusinessCategory {
+	ctx, span := tracing.Start(ctx, "businessCategory.Search")
+	defer span.End()
 	list := s.repo.SearchCategories(ctx, keyword)
 	return list
 }
+
+func (s service) UploadIcon(ctx context.Context, categoryId string, r io.Reader) (BusinessCategory, error) {
+	ctx, span := tracing.Start(ctx, "businessCategory.UploadIcon")
+	defer span.End()
+	objectId, err := primitive.ObjectIDFromHex(categoryId)
+	if err != nil {
+		return BusinessCategory{}, apperrors.NotFound("")
+	}
+	existingCategory, err := s.repo.Get(ctx, objectId)
+	if err != nil {
+		return BusinessCategory{}, err
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxIconSize+1))
+	if err != nil {
+		return BusinessCategory{}, err
+	}
+	if len(data) == 0 {
+		return BusinessCategory{}, apperrors.BadRequest("The icon file is empty.")
+	}
+	if len(data) > MaxIconSize {
+		return BusinessCategory{}, apperrors.BadRequest(fmt.Sprintf("The icon must not be larger than %d KB.", MaxIconSize>>10))
+	}
+	// never trust the client-provided content type: detect it from the content instead
+	contentType := http.DetectContentType(data)
+	ext, ok := iconTypes[contentType]
+	if !ok {
+		return BusinessCategory{}, apperrors.BadRequest("The icon must be a PNG, JPEG, GIF or WebP image.")
+	}
+	if data, err = imaging.StripMetadata(data); err == imaging.ErrTooLarge {
+		return BusinessCategory{}, apperrors.BadRequest("The icon dimensions are too large.")
+	} else if err != nil {
+		return BusinessCategory{}, apperrors.BadRequest("The icon is not a valid image.")
+	}
+
+	// every upload gets a new key so that the previous icon can be removed once the category points to the new one
+	key := fmt.Sprintf("categories/%s/icon-%d%s", objectId.Hex(), time.Now().UnixNano(), ext)
+	if err := s.storage.Put(ctx, key, bytes.NewReader(data), contentType); err != nil {
+		return BusinessCategory{}, err
+	}
+	if err := s.repo.UpdateIcon(ctx, objectId, key, iconURL(objectId)); err != nil {
+		s.deleteIcon(ctx, key)
+		return BusinessCategory{}, err
+	}
+	if existingCategory.IconKey != "" {
+		s.deleteIcon(ctx, existingCategory.IconKey)
+	}
+	return s.Get(ctx, objectId)
+}
+
+func (s service) GetIcon(ctx context.Context, categoryId string) (*storage.Object, string, error) {
+	ctx, span := tracing.Start(ctx, "businessCategory.GetIcon")
+	defer span.End()
+	objectId, err := primitive.ObjectIDFromHex(categoryId)
+	if err != nil {
+		return nil, "", apperrors.NotFound("")
+	}
+	category, err := s.repo.Get(ctx, objectId)
+	if err != nil {
+		return nil, "", err
+	}
+	if category.IconKey == "" {
+		return nil, "", apperrors.NotFound("This category has no uploaded icon.")
+	}
+
+	url, err := s.storage.URL(ctx, category.IconKey)
+	if err != nil {
+		return nil, "", err
+	}
+	if url != "" {
+		return nil, url, nil
+	}
+	icon, err := s.storage.Get(ctx, category.IconKey)
+	if err == storage.ErrNotFound {
+		return nil, "", apperrors.NotFound("")
+	}
+	return icon, "", err
+}
+
+// deleteIcon removes an icon that is no longer referenced by any category.
+// Failures are only logged since the category itself has already been updated.
+func (s service) deleteIcon(ctx context.Context, key string) {
+	if err := s.storage.Delete(ctx, key); err != nil {
+		s.logger.With(ctx, "key", key).Errorf("failed to delete orphaned category icon: %v", err)
+	}
+}
+
+// iconURL returns the stable URL from which the icon of the category is served.
+func iconURL(id primitive.ObjectID) string {
+	return "/api/v1/categories/" + id.Hex() + "/icon"
+}
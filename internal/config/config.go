@@ -2,6 +2,7 @@ package config
 
 import (
 	"github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
 	"github.com/qiangxue/go-env"
 	"github.com/ysodiqakanni/trustank-api/pkg/log"
 	"gopkg.in/yaml.v2"
@@ -10,13 +11,46 @@ import (
 
 const (
 	defaultServerPort         = 8080
+	defaultReadTimeout        = 15
+	defaultWriteTimeout       = 30
+	defaultIdleTimeout        = 60
+	defaultShutdownTimeout    = 30
+	defaultShutdownDelay      = 5
 	defaultJWTExpirationHours = 72
+	defaultStorageDriver      = "local"
+	defaultStorageLocalDir    = "./uploads"
+	defaultSuggestRefreshMins = 10
+	defaultAppBaseURL         = "http://localhost:3000"
+	defaultInvitationExpiry   = 30
+	defaultInvitationDelay    = 500
+	defaultWebhookMaxAttempts = 8
+	defaultJobWorkers         = 4
+	defaultMailDriver         = "log"
+	defaultMailFrom           = "Trustank <no-reply@localhost>"
+	defaultMailTemplates      = "./templates/mail"
+	defaultMailMboxFile       = "./mail.mbox"
+	defaultSMTPPort           = 587
+	defaultTraceExporter      = "none"
+	defaultTraceOTLPEndpoint  = "http://localhost:4318/v1/traces"
+	defaultTraceSampleRatio   = 1
 )
 
 // Config represents an application configuration.
 type Config struct {
 	// the server port. Defaults to 8080
 	ServerPort int `yaml:"server_port" env:"SERVER_PORT"`
+	// the longest time in seconds to read a request, including its body. Defaults to 15 seconds
+	ReadTimeout int `yaml:"read_timeout" env:"READ_TIMEOUT"`
+	// the longest time in seconds to write a response. Defaults to 30 seconds
+	WriteTimeout int `yaml:"write_timeout" env:"WRITE_TIMEOUT"`
+	// how long in seconds an idle keep-alive connection is kept open. Defaults to 60 seconds
+	IdleTimeout int `yaml:"idle_timeout" env:"IDLE_TIMEOUT"`
+	// the longest time in seconds to finish the requests and background work in progress on shutdown.
+	// Defaults to 30 seconds
+	ShutdownTimeout int `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// how long in seconds the server reports that it is not ready before it stops accepting connections,
+	// so that load balancers stop sending it requests. Defaults to 5 seconds
+	ShutdownDelay int `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
 	// the data source name (DSN) for connecting to the database. required.
 	DSN string `yaml:"dsn" env:"DSN,secret"`
 	// JWT signing key. required.
@@ -28,13 +62,97 @@ type Config struct {
 	DbName             string `yaml:"db_name" env:"DB_NAME"`
 
 	PasswordHashingCost int `yaml:"password_hashing_cost" env:"PASSWORD_HASHING_COST"`
+
+	// blob storage driver, either "local" or "s3". Defaults to "local"
+	StorageDriver string `yaml:"storage_driver" env:"STORAGE_DRIVER"`
+	// the directory used by the local storage driver. Defaults to ./uploads
+	StorageLocalDir string `yaml:"storage_local_dir" env:"STORAGE_LOCAL_DIR"`
+	// settings of the S3-compatible storage driver
+	S3Endpoint  string `yaml:"s3_endpoint" env:"S3_ENDPOINT"`
+	S3Region    string `yaml:"s3_region" env:"S3_REGION"`
+	S3Bucket    string `yaml:"s3_bucket" env:"S3_BUCKET"`
+	S3AccessKey string `yaml:"s3_access_key" env:"S3_ACCESS_KEY,secret"`
+	S3SecretKey string `yaml:"s3_secret_key" env:"S3_SECRET_KEY,secret"`
+	// optional public base URL (e.g. a CDN) of the S3 bucket. Presigned URLs are used when empty
+	S3PublicURL string `yaml:"s3_public_url" env:"S3_PUBLIC_URL"`
+
+	// path to a YAML file of known addresses used by the static geocoder. Optional
+	GeocodeFixtures string `yaml:"geocode_fixtures" env:"GEOCODE_FIXTURES"`
+
+	// interval in minutes between two full rebuilds of the autocomplete index. Defaults to 10 minutes
+	SuggestRefreshInterval int `yaml:"suggest_refresh_interval" env:"SUGGEST_REFRESH_INTERVAL"`
+
+	// directory of extra profanity word lists, one "<locale>.txt" file per locale. Optional
+	TextFilterWordLists string `yaml:"text_filter_word_lists" env:"TEXT_FILTER_WORD_LISTS"`
+
+	// base URL of the web application, used in the links sent by email. Defaults to http://localhost:3000
+	AppBaseURL string `yaml:"app_base_url" env:"APP_BASE_URL"`
+	// key signing the tokens of the links in review invitations. Must differ from the JWT signing key. required.
+	InvitationSigningKey string `yaml:"invitation_signing_key" env:"INVITATION_SIGNING_KEY,secret"`
+	// number of days a review invitation can be used. Defaults to 30 days
+	InvitationExpiry int `yaml:"invitation_expiry" env:"INVITATION_EXPIRY"`
+	// delay in milliseconds after each invitation sent by a CSV import. Defaults to 500 milliseconds
+	InvitationSendDelay int `yaml:"invitation_send_delay" env:"INVITATION_SEND_DELAY"`
+
+	// number of attempts after which a webhook delivery is given up. Defaults to 8
+	WebhookMaxAttempts int `yaml:"webhook_max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	// whether webhook endpoints may resolve to private or loopback addresses. Only meant for local development
+	WebhookAllowPrivate bool `yaml:"webhook_allow_private" env:"WEBHOOK_ALLOW_PRIVATE"`
+
+	// number of background jobs run at the same time by this instance. Defaults to 4
+	JobWorkers int `yaml:"job_workers" env:"JOB_WORKERS"`
+
+	// how emails are sent: "log" writes them to the log, "mbox" appends them to MailMboxFile and "smtp" sends them.
+	// Defaults to "log"
+	MailDriver string `yaml:"mail_driver" env:"MAIL_DRIVER"`
+	// sender of the emails. Defaults to "Trustank <no-reply@localhost>"
+	MailFrom string `yaml:"mail_from" env:"MAIL_FROM"`
+	// directory of the email templates, one subdirectory per locale. Defaults to ./templates/mail
+	MailTemplates string `yaml:"mail_templates" env:"MAIL_TEMPLATES"`
+	// the file written by the mbox mail driver. Defaults to ./mail.mbox
+	MailMboxFile string `yaml:"mail_mbox_file" env:"MAIL_MBOX_FILE"`
+	// settings of the smtp mail driver. The port defaults to 587
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD,secret"`
+
+	// where traces are exported: "otlp" posts them to TraceOTLPEndpoint, "stdout" writes them to the standard output
+	// and "none" disables tracing. Defaults to "none"
+	TraceExporter string `yaml:"trace_exporter" env:"TRACE_EXPORTER"`
+	// the OTLP/HTTP traces endpoint of the OpenTelemetry collector. Defaults to http://localhost:4318/v1/traces
+	TraceOTLPEndpoint string `yaml:"trace_otlp_endpoint" env:"TRACE_OTLP_ENDPOINT"`
+	// ratio of the traces started by this service which are recorded, from 0 to 1. Traces started by a caller are
+	// recorded if the caller records them. Defaults to 1
+	TraceSampleRatio float64 `yaml:"trace_sample_ratio" env:"TRACE_SAMPLE_RATIO"`
 }
 
 // Validate validates the application configuration.
 func (c Config) Validate() error {
 	return validation.ValidateStruct(&c,
 		validation.Field(&c.DSN, validation.Required),
+		validation.Field(&c.ReadTimeout, validation.Min(0)),
+		validation.Field(&c.WriteTimeout, validation.Min(0)),
+		validation.Field(&c.IdleTimeout, validation.Min(0)),
+		validation.Field(&c.ShutdownTimeout, validation.Min(1)),
+		validation.Field(&c.ShutdownDelay, validation.Min(0)),
 		validation.Field(&c.JWTSigningKey, validation.Required),
+		validation.Field(&c.StorageDriver, validation.In("local", "s3")),
+		validation.Field(&c.S3Endpoint, validation.When(c.StorageDriver == "s3", validation.Required)),
+		validation.Field(&c.S3Bucket, validation.When(c.StorageDriver == "s3", validation.Required)),
+		validation.Field(&c.SuggestRefreshInterval, validation.Min(1)),
+		validation.Field(&c.AppBaseURL, validation.Required, is.URL),
+		validation.Field(&c.InvitationSigningKey, validation.Required, validation.NotIn(c.JWTSigningKey).Error("must differ from the JWT signing key")),
+		validation.Field(&c.InvitationExpiry, validation.Min(1)),
+		validation.Field(&c.InvitationSendDelay, validation.Min(0)),
+		validation.Field(&c.WebhookMaxAttempts, validation.Min(1)),
+		validation.Field(&c.JobWorkers, validation.Min(1)),
+		validation.Field(&c.MailDriver, validation.In("log", "mbox", "smtp")),
+		validation.Field(&c.MailFrom, validation.Required),
+		validation.Field(&c.SMTPHost, validation.When(c.MailDriver == "smtp", validation.Required)),
+		validation.Field(&c.TraceExporter, validation.In("none", "stdout", "otlp")),
+		validation.Field(&c.TraceOTLPEndpoint, validation.When(c.TraceExporter == "otlp", validation.Required, is.URL)),
+		validation.Field(&c.TraceSampleRatio, validation.Min(0.0), validation.Max(1.0)),
 	)
 }
 
@@ -42,8 +160,30 @@ func (c Config) Validate() error {
 func Load(file string, logger log.Logger) (*Config, error) {
 	// default config
 	c := Config{
-		ServerPort:    defaultServerPort,
-		JWTExpiration: defaultJWTExpirationHours,
+		ServerPort:      defaultServerPort,
+		ReadTimeout:     defaultReadTimeout,
+		WriteTimeout:    defaultWriteTimeout,
+		IdleTimeout:     defaultIdleTimeout,
+		ShutdownTimeout: defaultShutdownTimeout,
+		ShutdownDelay:   defaultShutdownDelay,
+		JWTExpiration:   defaultJWTExpirationHours,
+		StorageDriver:   defaultStorageDriver,
+		StorageLocalDir: defaultStorageLocalDir,
+
+		SuggestRefreshInterval: defaultSuggestRefreshMins,
+		AppBaseURL:             defaultAppBaseURL,
+		InvitationExpiry:       defaultInvitationExpiry,
+		InvitationSendDelay:    defaultInvitationDelay,
+		WebhookMaxAttempts:     defaultWebhookMaxAttempts,
+		JobWorkers:             defaultJobWorkers,
+		MailDriver:             defaultMailDriver,
+		MailFrom:               defaultMailFrom,
+		MailTemplates:          defaultMailTemplates,
+		MailMboxFile:           defaultMailMboxFile,
+		SMTPPort:               defaultSMTPPort,
+		TraceExporter:          defaultTraceExporter,
+		TraceOTLPEndpoint:      defaultTraceOTLPEndpoint,
+		TraceSampleRatio:       defaultTraceSampleRatio,
 	}
 
 	// load from YAML config file
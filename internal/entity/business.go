@@ -14,5 +14,11 @@ type Business struct {
 	OwnerId       primitive.ObjectID
 	OwnerName     string
 	OwnerJobTitle string
+	Locations     []Location `bson:"locations,omitempty"`
+	// APIKeyHash is the SHA-256 hash of the API key the business uses to call the API from its own systems.
+	APIKeyHash string `json:"-" bson:"api_key_hash,omitempty"`
+	// Moderation is set when the business profile is held for moderation. Held businesses are left out of
+	// searches and suggestions, and the reasons are never sent to clients.
+	Moderation *Moderation `json:"-" bson:"moderation,omitempty"`
 	//Reviews       []Review
 }
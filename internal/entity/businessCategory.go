@@ -12,6 +12,7 @@ type BusinessCategory struct {
 	Description string             `json:"description,omitempty" bson:"description,omitempty"`
 	IsFeatured  bool               `json:"featured" bson:"isFeatured,omitempty"`
 	IconUrl     string             `json:"iconUrl" bson:"iconUrl"`
+	IconKey     string             `json:"-" bson:"iconKey,omitempty"`
 	CreatedAt   time.Time          `json:"created_at"`
 	UpdatedAt   time.Time          `json:"updated_at"`
 	IsDeleted   bool               `json:"is_deleted"`
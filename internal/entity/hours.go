@@ -0,0 +1,169 @@
+package entity
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxLookahead is the number of days searched for the next opening before giving up.
+const maxLookahead = 366
+
+// OpeningHours describes the weekly opening hours of a location and the days it is exceptionally closed.
+// All times are wall-clock times in the location's time zone, so they stay correct across DST changes.
+type OpeningHours struct {
+	// TimeZone is the IANA name of the location's time zone, e.g. "Africa/Lagos".
+	TimeZone string          `json:"time_zone" bson:"time_zone"`
+	Periods  []OpeningPeriod `json:"periods" bson:"periods"`
+	Closures []Closure       `json:"closures,omitempty" bson:"closures,omitempty"`
+}
+
+// OpeningPeriod is a weekly period during which a location is open.
+// A period whose closing time is not after its opening time ends on the following day,
+// and a closing time of "24:00" means midnight at the end of the day.
+type OpeningPeriod struct {
+	Day   time.Weekday `json:"day" bson:"day"`
+	Open  string       `json:"open" bson:"open"`
+	Close string       `json:"close" bson:"close"`
+}
+
+// Closure is a range of days, such as a public holiday, during which a location stays closed.
+// Periods starting on any day between From and To (inclusive, formatted as "2006-01-02") do not apply.
+type Closure struct {
+	From   string `json:"from" bson:"from"`
+	To     string `json:"to" bson:"to"`
+	Reason string `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// IsOpen reports whether the location is open at the given instant.
+func (h OpeningHours) IsOpen(t time.Time) (bool, error) {
+	loc, err := time.LoadLocation(h.TimeZone)
+	if err != nil {
+		return false, err
+	}
+	local := t.In(loc)
+	// periods starting on the previous day may still be running
+	for offset := -1; offset <= 0; offset++ {
+		for _, interval := range h.intervals(local, offset, loc) {
+			if !t.Before(interval[0]) && t.Before(interval[1]) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// NextOpen returns the first instant after t at which a closed location opens.
+// False is returned if the location does not open within the next year.
+func (h OpeningHours) NextOpen(t time.Time) (time.Time, bool, error) {
+	loc, err := time.LoadLocation(h.TimeZone)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	local := t.In(loc)
+	for offset := 0; offset <= maxLookahead; offset++ {
+		var next time.Time
+		for _, interval := range h.intervals(local, offset, loc) {
+			if interval[0].After(t) && (next.IsZero() || interval[0].Before(next)) {
+				next = interval[0]
+			}
+		}
+		if !next.IsZero() {
+			return next, true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+// Validate checks that the time zone can be loaded and that all times and dates are well formed.
+func (h OpeningHours) Validate() error {
+	if _, err := time.LoadLocation(h.TimeZone); err != nil || h.TimeZone == "" {
+		return fmt.Errorf("unknown time zone %q", h.TimeZone)
+	}
+	for _, p := range h.Periods {
+		if p.Day < time.Sunday || p.Day > time.Saturday {
+			return fmt.Errorf("invalid day %d", p.Day)
+		}
+		if _, err := parseClock(p.Open, false); err != nil {
+			return err
+		}
+		if _, err := parseClock(p.Close, true); err != nil {
+			return err
+		}
+	}
+	for _, c := range h.Closures {
+		from, err := time.Parse("2006-01-02", c.From)
+		if err != nil {
+			return fmt.Errorf("invalid closure date %q", c.From)
+		}
+		to, err := time.Parse("2006-01-02", c.To)
+		if err != nil {
+			return fmt.Errorf("invalid closure date %q", c.To)
+		}
+		if to.Before(from) {
+			return fmt.Errorf("closure ending on %s starts after it ends", c.To)
+		}
+	}
+	return nil
+}
+
+// intervals returns the [open, close) instants of the periods starting on the day that is offset days from local.
+func (h OpeningHours) intervals(local time.Time, offset int, loc *time.Location) [][2]time.Time {
+	year, month, day := local.Date()
+	date := time.Date(year, month, day+offset, 0, 0, 0, 0, loc)
+	if h.isClosed(date) {
+		return nil
+	}
+	var result [][2]time.Time
+	for _, p := range h.Periods {
+		if p.Day != date.Weekday() {
+			continue
+		}
+		open, err := parseClock(p.Open, false)
+		if err != nil {
+			continue
+		}
+		close, err := parseClock(p.Close, true)
+		if err != nil {
+			continue
+		}
+		// build both ends from wall-clock times so that a DST change in between is accounted for
+		y, m, d := date.Date()
+		start := time.Date(y, m, d, open/60, open%60, 0, 0, loc)
+		if close <= open {
+			d++
+		}
+		end := time.Date(y, m, d, close/60, close%60, 0, 0, loc)
+		result = append(result, [2]time.Time{start, end})
+	}
+	return result
+}
+
+// isClosed reports whether the given local date falls within a closure.
+func (h OpeningHours) isClosed(date time.Time) bool {
+	day := date.Format("2006-01-02")
+	for _, c := range h.Closures {
+		// dates in the "2006-01-02" format sort chronologically as strings
+		if c.From <= day && day <= c.To {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses a "15:04" wall-clock time into minutes after midnight. "24:00" is accepted if allowMidnight is true.
+func parseClock(s string, allowMidnight bool) (int, error) {
+	var hour, minute int
+	if len(s) != 5 || s[2] != ':' {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	if _, err := fmt.Sscanf(s, "%02d:%02d", &hour, &minute); err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	if allowMidnight && hour == 24 && minute == 0 {
+		return 24 * 60, nil
+	}
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return hour*60 + minute, nil
+}
@@ -0,0 +1,127 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func utc(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestOpeningHours_IsOpen(t *testing.T) {
+	h := OpeningHours{
+		TimeZone: "America/New_York",
+		Periods: []OpeningPeriod{
+			{time.Sunday, "09:00", "17:00"},
+			{time.Friday, "22:00", "02:00"},
+			{time.Saturday, "11:00", "15:00"},
+		},
+		Closures: []Closure{{From: "2021-12-25", To: "2021-12-26", Reason: "Christmas"}},
+	}
+	tests := []struct {
+		name string
+		at   string
+		want bool
+	}{
+		// 2021-10-31 is on EDT (UTC-4), 2021-11-07 is on EST (UTC-5) after the clocks went back
+		{"summer time opening", "2021-10-31T13:00:00Z", true},
+		{"summer time before opening", "2021-10-31T12:59:00Z", false},
+		{"winter time before opening", "2021-11-07T13:45:00Z", false},
+		{"winter time opening", "2021-11-07T14:00:00Z", true},
+		{"winter time closing", "2021-11-07T22:00:00Z", false},
+		{"overnight period after midnight", "2021-11-06T05:30:00Z", true},
+		{"overnight period ended", "2021-11-06T06:00:00Z", false},
+		// on 2021-03-13 clocks have not moved forward yet
+		{"standard time period", "2021-03-13T19:59:00Z", true},
+		{"standard time period end", "2021-03-13T20:00:00Z", false},
+		{"closure", "2021-12-26T15:00:00Z", false},
+		{"overnight period started before closure", "2021-12-25T06:30:00Z", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			open, err := h.IsOpen(utc(tc.at))
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, open)
+		})
+	}
+}
+
+func TestOpeningHours_IsOpen_SpringForward(t *testing.T) {
+	// on 2021-03-14 New York clocks jump from 02:00 to 03:00, so 01:00-05:00 lasts only 3 hours
+	h := OpeningHours{
+		TimeZone: "America/New_York",
+		Periods:  []OpeningPeriod{{time.Sunday, "01:00", "05:00"}},
+	}
+	open, _ := h.IsOpen(utc("2021-03-14T06:00:00Z")) // 01:00 EST
+	assert.True(t, open)
+	open, _ = h.IsOpen(utc("2021-03-14T08:59:00Z")) // 04:59 EDT
+	assert.True(t, open)
+	open, _ = h.IsOpen(utc("2021-03-14T09:00:00Z")) // 05:00 EDT
+	assert.False(t, open)
+}
+
+func TestOpeningHours_NextOpen(t *testing.T) {
+	h := OpeningHours{
+		TimeZone: "Europe/London",
+		Periods: []OpeningPeriod{
+			{time.Monday, "09:00", "17:00"},
+			{time.Sunday, "10:00", "16:00"},
+		},
+		Closures: []Closure{{From: "2021-04-05", To: "2021-04-05", Reason: "Easter Monday"}},
+	}
+	tests := []struct {
+		name string
+		at   string
+		want string
+	}{
+		// London moves from GMT to BST on 2021-03-28 at 01:00 UTC
+		{"across spring forward", "2021-03-27T12:00:00Z", "2021-03-28T09:00:00Z"},
+		{"before DST change", "2021-03-21T11:00:00Z", "2021-03-22T09:00:00Z"},
+		{"same day later", "2021-03-29T06:00:00Z", "2021-03-29T08:00:00Z"},
+		{"skips closure", "2021-04-04T16:00:00Z", "2021-04-11T09:00:00Z"},
+		// London moves back to GMT on 2021-10-31
+		{"across fall back", "2021-10-30T12:00:00Z", "2021-10-31T10:00:00Z"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			next, ok, err := h.NextOpen(utc(tc.at))
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, utc(tc.want), next.UTC())
+		})
+	}
+
+	_, ok, err := OpeningHours{TimeZone: "UTC"}.NextOpen(utc("2021-03-27T12:00:00Z"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestOpeningHours_Validate(t *testing.T) {
+	valid := OpeningHours{
+		TimeZone: "Africa/Lagos",
+		Periods:  []OpeningPeriod{{time.Monday, "00:00", "24:00"}},
+		Closures: []Closure{{From: "2021-01-01", To: "2021-01-02"}},
+	}
+	assert.Nil(t, valid.Validate())
+
+	invalid := []OpeningHours{
+		{TimeZone: ""},
+		{TimeZone: "Mars/Olympus"},
+		{TimeZone: "UTC", Periods: []OpeningPeriod{{7, "09:00", "17:00"}}},
+		{TimeZone: "UTC", Periods: []OpeningPeriod{{time.Monday, "9:00", "17:00"}}},
+		{TimeZone: "UTC", Periods: []OpeningPeriod{{time.Monday, "24:00", "17:00"}}},
+		{TimeZone: "UTC", Periods: []OpeningPeriod{{time.Monday, "09:00", "17:60"}}},
+		{TimeZone: "UTC", Closures: []Closure{{From: "2021-01-02", To: "2021-01-01"}}},
+		{TimeZone: "UTC", Closures: []Closure{{From: "tomorrow", To: "2021-01-01"}}},
+	}
+	for _, h := range invalid {
+		assert.NotNil(t, h.Validate(), h)
+	}
+}
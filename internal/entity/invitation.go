@@ -0,0 +1,78 @@
+package entity
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Statuses of a review invitation.
+const (
+	// InvitationPending is an invitation that has not been sent yet.
+	InvitationPending = "pending"
+	// InvitationSent is an invitation that was emailed to the customer.
+	InvitationSent = "sent"
+	// InvitationFailed is an invitation whose email could not be sent.
+	InvitationFailed = "failed"
+	// InvitationOpened is an invitation whose link was followed by the customer.
+	InvitationOpened = "opened"
+	// InvitationUnsubscribed is an invitation that was not sent because the customer unsubscribed.
+	InvitationUnsubscribed = "unsubscribed"
+)
+
+// Invitation is a request sent by a business to a customer to review a real purchase.
+// Reviews submitted through an invitation are verified.
+type Invitation struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	BusinessID    primitive.ObjectID `json:"business_id" bson:"business_id"`
+	CustomerEmail string             `json:"customer_email" bson:"customer_email"`
+	CustomerName  string             `json:"customer_name" bson:"customer_name"`
+	// OrderRef is the business reference of the purchase. A single invitation is sent per order.
+	OrderRef  string     `json:"order_ref" bson:"order_ref"`
+	OrderDate *time.Time `json:"order_date,omitempty" bson:"order_date,omitempty"`
+	// Locale is the language of the email, such as "en" or "fr-CA". The default language is used when empty.
+	Locale    string     `json:"locale,omitempty" bson:"locale,omitempty"`
+	Status    string     `json:"status" bson:"status"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" bson:"expires_at"`
+	SentAt    *time.Time `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+	OpenedAt  *time.Time `json:"opened_at,omitempty" bson:"opened_at,omitempty"`
+}
+
+// Statuses of an invitation import.
+const (
+	// ImportQueued is an import whose file is waiting to be processed.
+	ImportQueued = "queued"
+	// ImportProcessing is an import whose rows are being processed.
+	ImportProcessing = "processing"
+	// ImportCompleted is an import whose rows have all been processed.
+	ImportCompleted = "completed"
+	// ImportFailed is an import whose file could not be processed.
+	ImportFailed = "failed"
+)
+
+// InvitationImport tracks the progress of a CSV file of orders uploaded by a business to send invitations in bulk.
+type InvitationImport struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	BusinessID primitive.ObjectID `json:"business_id" bson:"business_id"`
+	Status     string             `json:"status" bson:"status"`
+	// Error explains why a failed import could not be processed.
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+	// Rows is the number of rows processed so far, excluding the header.
+	Rows int `json:"rows" bson:"rows"`
+	// Invited is the number of rows for which an invitation was created.
+	Invited int `json:"invited" bson:"invited"`
+	// Duplicates is the number of rows whose order was already invited.
+	Duplicates int `json:"duplicates" bson:"duplicates"`
+	// Invalid is the number of rows rejected by validation. Errors lists the first ones.
+	Invalid    int        `json:"invalid" bson:"invalid"`
+	Errors     []RowError `json:"errors,omitempty" bson:"errors,omitempty"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+}
+
+// RowError is a validation error of a row of an imported file.
+type RowError struct {
+	// Row is the 1-based line number of the row, the header being row 1.
+	Row   int    `json:"row" bson:"row"`
+	Error string `json:"error" bson:"error"`
+}
@@ -0,0 +1,90 @@
+package entity
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Address represents a structured postal address.
+type Address struct {
+	Line1      string `json:"line1" bson:"line1"`
+	Line2      string `json:"line2,omitempty" bson:"line2,omitempty"`
+	City       string `json:"city" bson:"city"`
+	Region     string `json:"region,omitempty" bson:"region,omitempty"`
+	PostalCode string `json:"postal_code,omitempty" bson:"postal_code,omitempty"`
+	// Country is the ISO 3166-1 alpha-2 country code.
+	Country string `json:"country" bson:"country"`
+}
+
+// String returns the address on a single line, as used for geocoding.
+func (a Address) String() string {
+	s := ""
+	for _, part := range []string{a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country} {
+		if part == "" {
+			continue
+		}
+		if s != "" {
+			s += ", "
+		}
+		s += part
+	}
+	return s
+}
+
+// GeoPoint represents a GeoJSON point. Coordinates are stored as [longitude, latitude].
+type GeoPoint struct {
+	Type        string    `json:"type" bson:"type"`
+	Coordinates []float64 `json:"coordinates" bson:"coordinates"`
+}
+
+// NewGeoPoint creates a GeoJSON point from a latitude and a longitude.
+func NewGeoPoint(lat, lng float64) GeoPoint {
+	return GeoPoint{Type: "Point", Coordinates: []float64{lng, lat}}
+}
+
+// Lat returns the latitude of the point.
+func (p GeoPoint) Lat() float64 {
+	if len(p.Coordinates) < 2 {
+		return 0
+	}
+	return p.Coordinates[1]
+}
+
+// Lng returns the longitude of the point.
+func (p GeoPoint) Lng() float64 {
+	if len(p.Coordinates) < 2 {
+		return 0
+	}
+	return p.Coordinates[0]
+}
+
+// Location represents a physical place (shop, office, branch) where a business operates.
+type Location struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id"`
+	Name    string             `json:"name,omitempty" bson:"name,omitempty"`
+	Address Address            `json:"address" bson:"address"`
+	Point   GeoPoint           `json:"point" bson:"point"`
+	Hours   *OpeningHours      `json:"hours,omitempty" bson:"hours,omitempty"`
+
+	// OpenNow and NextOpenAt are computed from Hours when the location is returned to clients.
+	OpenNow    *bool      `json:"open_now,omitempty" bson:"-"`
+	NextOpenAt *time.Time `json:"next_open_at,omitempty" bson:"-"`
+}
+
+// SetOpeningStatus computes OpenNow and NextOpenAt at the given instant. They are left empty if the hours are unknown.
+func (l *Location) SetOpeningStatus(now time.Time) {
+	l.OpenNow, l.NextOpenAt = nil, nil
+	if l.Hours == nil {
+		return
+	}
+	open, err := l.Hours.IsOpen(now)
+	if err != nil {
+		return
+	}
+	l.OpenNow = &open
+	if !open {
+		if next, ok, _ := l.Hours.NextOpen(now); ok {
+			l.NextOpenAt = &next
+		}
+	}
+}
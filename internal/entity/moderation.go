@@ -0,0 +1,16 @@
+package entity
+
+import "time"
+
+// ModerationPending is the status of content waiting for a moderator's decision.
+const ModerationPending = "pending"
+
+// Moderation records why user-generated content is held for review by a moderator.
+type Moderation struct {
+	Status string `json:"status" bson:"status"`
+	// Fields lists the fields that need to be reviewed.
+	Fields []string `json:"fields" bson:"fields"`
+	// Reasons lists the kinds of problems found, e.g. "profanity" or "phone".
+	Reasons   []string  `json:"reasons" bson:"reasons"`
+	FlaggedAt time.Time `json:"flagged_at" bson:"flagged_at"`
+}
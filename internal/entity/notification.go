@@ -0,0 +1,41 @@
+package entity
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Email delivery of the notifications of a type.
+const (
+	// EmailInstant emails each notification as soon as it is created.
+	EmailInstant = "instant"
+	// EmailDaily emails the notifications of the day in a single digest.
+	EmailDaily = "daily"
+	// EmailOff never emails the notifications, they are only shown in the app.
+	EmailOff = "off"
+)
+
+// Notification is an in-app message to a user about something that happened to them or their business.
+type Notification struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID primitive.ObjectID `json:"user_id" bson:"user_id"`
+	// Type is the kind of event the notification is about, such as "review.replied".
+	Type  string `json:"type" bson:"type"`
+	Title string `json:"title" bson:"title"`
+	Body  string `json:"body" bson:"body"`
+	// Link is the path in the web application showing what the notification is about.
+	Link      string     `json:"link,omitempty" bson:"link,omitempty"`
+	ReadAt    *time.Time `json:"read_at,omitempty" bson:"read_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	// Key identifies the event the notification is about, so that the user is not notified twice of it.
+	Key string `json:"-" bson:"key,omitempty"`
+	// InDigest is set while the notification waits to be emailed in the daily digest of the user.
+	InDigest bool `json:"-" bson:"in_digest,omitempty"`
+}
+
+// NotificationPreferences tells how a user wants to receive each type of notification by email.
+type NotificationPreferences struct {
+	UserID primitive.ObjectID `json:"-" bson:"_id"`
+	// Email maps notification types to EmailInstant, EmailDaily or EmailOff. Missing types use their default.
+	Email map[string]string `json:"email" bson:"email"`
+}
@@ -0,0 +1,57 @@
+package entity
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// WebhookSubscription is an endpoint of an integration partner that is notified of the events of a business.
+type WebhookSubscription struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	BusinessID primitive.ObjectID `json:"business_id" bson:"business_id"`
+	URL        string             `json:"url" bson:"url"`
+	// Events lists the types of the events sent to the endpoint.
+	Events []string `json:"events" bson:"events"`
+	// Secret signs the payloads sent to the endpoint. It is only returned when the subscription is created.
+	Secret    string    `json:"secret,omitempty" bson:"secret"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Statuses of a webhook delivery.
+const (
+	// DeliveryPending is a delivery waiting for its next attempt.
+	DeliveryPending = "pending"
+	// DeliverySucceeded is a delivery acknowledged by the endpoint with a 2xx response.
+	DeliverySucceeded = "succeeded"
+	// DeliveryDead is a delivery that failed too many times and will not be attempted again unless redelivered.
+	DeliveryDead = "dead"
+)
+
+// WebhookDelivery is an event to deliver to a webhook subscription, with the log of the delivery attempts.
+type WebhookDelivery struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	SubscriptionID primitive.ObjectID `json:"subscription_id" bson:"subscription_id"`
+	BusinessID     primitive.ObjectID `json:"business_id" bson:"business_id"`
+	// EventID identifies the event, so that endpoints can ignore an event delivered more than once.
+	EventID   string `json:"event_id" bson:"event_id"`
+	EventType string `json:"event_type" bson:"event_type"`
+	// Payload is the JSON body sent to the endpoint.
+	Payload       string     `json:"payload" bson:"payload"`
+	Status        string     `json:"status" bson:"status"`
+	Attempts      int        `json:"attempts" bson:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+	// Log lists the latest delivery attempts, oldest first.
+	Log       []DeliveryAttempt `json:"log" bson:"log"`
+	CreatedAt time.Time         `json:"created_at" bson:"created_at"`
+}
+
+// DeliveryAttempt records the outcome of an attempt to deliver a webhook.
+type DeliveryAttempt struct {
+	At time.Time `json:"at" bson:"at"`
+	// StatusCode is the HTTP status of the response, 0 if no response was received.
+	StatusCode int    `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	Error      string `json:"error,omitempty" bson:"error,omitempty"`
+	// Duration is the time taken by the attempt in milliseconds.
+	Duration int64 `json:"duration" bson:"duration"`
+}
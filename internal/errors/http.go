@@ -0,0 +1,37 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+)
+
+// Write replies to the request with the HTTP error response that corresponds to the given error.
+// ErrorResponse keeps its status and message, validation errors are reported as bad requests, request bodies
+// exceeding the limit of http.MaxBytesReader as too large, missing documents as not found, and any other error as
+// an internal server error.
+func Write(w http.ResponseWriter, err error) {
+	res := toErrorResponse(err)
+	http.Error(w, res.Message, res.StatusCode())
+}
+
+// toErrorResponse converts an error returned by a service into an ErrorResponse.
+func toErrorResponse(err error) ErrorResponse {
+	var res ErrorResponse
+	if errors.As(err, &res) {
+		return res
+	}
+	if errs, ok := err.(validation.Errors); ok {
+		return BadRequest(errs.Error())
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return PayloadTooLarge(fmt.Sprintf("The request body must not be larger than %d bytes.", tooLarge.Limit))
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return NotFound("")
+	}
+	return InternalServerError("")
+}
@@ -0,0 +1,35 @@
+package errors
+
+import (
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{"error response", Forbidden("nope"), http.StatusForbidden, "nope\n"},
+		{"wrapped error response", fmt.Errorf("wrap: %w", NotFound("gone")), http.StatusNotFound, "gone\n"},
+		{"validation", validation.Errors{"name": fmt.Errorf("is required")}, http.StatusBadRequest, "name: is required.\n"},
+		{"body too large", fmt.Errorf("wrap: %w", &http.MaxBytesError{Limit: 1024}), http.StatusRequestEntityTooLarge, "The request body must not be larger than 1024 bytes.\n"},
+		{"no documents", mongo.ErrNoDocuments, http.StatusNotFound, NotFound("").Message + "\n"},
+		{"unknown", fmt.Errorf("boom"), http.StatusInternalServerError, InternalServerError("").Message + "\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			Write(res, tc.err)
+			assert.Equal(t, tc.wantStatus, res.Code)
+			assert.Equal(t, tc.wantBody, res.Body.String())
+		})
+	}
+}
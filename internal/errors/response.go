@@ -78,6 +78,17 @@ func BadRequest(msg string) ErrorResponse {
 	}
 }
 
+// PayloadTooLarge creates a new error response representing a request body larger than accepted (HTTP 413)
+func PayloadTooLarge(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The request body is too large."
+	}
+	return ErrorResponse{
+		Status:  http.StatusRequestEntityTooLarge,
+		Message: msg,
+	}
+}
+
 type invalidField struct {
 	Field string `json:"field"`
 	Error string `json:"error"`
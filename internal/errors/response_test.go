@@ -62,6 +62,14 @@ func TestBadRequest(t *testing.T) {
 	assert.NotEmpty(t, res.Error())
 }
 
+func TestPayloadTooLarge(t *testing.T) {
+	res := PayloadTooLarge("test")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = PayloadTooLarge("")
+	assert.NotEmpty(t, res.Error())
+}
+
 func TestInvalidInput(t *testing.T) {
 	err := InvalidInput(validation.Errors{
 		"xyz": fmt.Errorf("2"),
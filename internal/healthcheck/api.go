@@ -1,15 +1,103 @@
 package healthcheck
 
-import routing "github.com/go-ozzo/ozzo-routing/v2"
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// StatusUp reports that the application or one of its components works.
+	StatusUp = "up"
+	// StatusDown reports that the application or one of its components does not work.
+	StatusDown = "down"
+	// checkTimeout is how long a component check may take before the component is reported as down.
+	checkTimeout = 2 * time.Second
+)
+
+// Check returns an error when a component the application depends on does not work.
+type Check func(ctx context.Context) error
+
+// Response is the result of a health check.
+type Response struct {
+	Status     string               `json:"status"`
+	Version    string               `json:"version"`
+	Commit     string               `json:"commit"`
+	Components map[string]Component `json:"components,omitempty"`
+}
+
+// Component is the result of the check of a component. The error of a failed check is logged rather than
+// returned, as it may reveal hosts or the topology of the database.
+type Component struct {
+	Status string `json:"status"`
+}
 
 // RegisterHandlers registers the handlers that perform healthchecks.
-func RegisterHandlers(r *routing.Router, version string) {
-	r.To("GET,HEAD", "/healthcheck", healthcheck(version))
+// /healthz reports that the process is alive without checking anything else, so that an orchestrator does not
+// restart it when a dependency fails. /readyz runs the given checks and responds with 503 Service Unavailable
+// unless they all pass, so that load balancers stop sending requests to it.
+func RegisterHandlers(r *mux.Router, version, commit string, checks map[string]Check, logger log.Logger) {
+	res := resource{version, commit, checks, logger}
+	r.HandleFunc("/healthz", res.liveHandler).Methods("GET", "HEAD")
+	r.HandleFunc("/readyz", res.readyHandler).Methods("GET", "HEAD")
+}
+
+type resource struct {
+	version string
+	commit  string
+	checks  map[string]Check
+	logger  log.Logger
 }
 
-// healthcheck responds to a healthcheck request.
-func healthcheck(version string) routing.Handler {
-	return func(c *routing.Context) error {
-		return c.Write("OK " + version)
+func (r resource) liveHandler(w http.ResponseWriter, req *http.Request) {
+	write(w, http.StatusOK, Response{Status: StatusUp, Version: r.version, Commit: r.commit})
+}
+
+func (r resource) readyHandler(w http.ResponseWriter, req *http.Request) {
+	res := Response{Status: StatusUp, Version: r.version, Commit: r.commit, Components: run(req.Context(), r.checks, r.logger)}
+	status := http.StatusOK
+	for _, component := range res.Components {
+		if component.Status != StatusUp {
+			res.Status = StatusDown
+			status = http.StatusServiceUnavailable
+		}
 	}
+	write(w, status, res)
+}
+
+// run runs the checks concurrently, each with a timeout, and logs the errors of the failed checks.
+func run(ctx context.Context, checks map[string]Check, logger log.Logger) map[string]Component {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	result := map[string]Component{}
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			component := Component{Status: StatusUp}
+			if err := check(ctx); err != nil {
+				logger.With(ctx).Errorf("readiness check %s failed: %s", name, err)
+				component = Component{Status: StatusDown}
+			}
+			mu.Lock()
+			result[name] = component
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+	return result
+}
+
+func write(w http.ResponseWriter, status int, res Response) {
+	w.Header().Set("Content-Type", "application/json")
+	// health checks must reflect the current state, not a cached one
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
 }
@@ -1,17 +1,61 @@
 package healthcheck
 
 import (
-	"github.com/ysodiqakanni/trustank-api/internal/test"
-	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
 )
 
 func TestAPI(t *testing.T) {
-	logger, _ := log.NewForTest()
-	router := test.MockRouter(logger)
-	RegisterHandlers(router, "0.9.0")
-	test.Endpoint(t, router, test.APITestCase{
-		"ok", "GET", "/healthcheck", "", nil, http.StatusOK, `"OK 0.9.0"`,
-	})
+	failing := errors.New("connection refused")
+	checks := map[string]Check{
+		"mongo":   func(ctx context.Context) error { return nil },
+		"workers": func(ctx context.Context) error { return nil },
+	}
+	logger, entries := log.NewForTest()
+	router := mux.NewRouter()
+	RegisterHandlers(router, "0.9.0", "abc123", checks, logger)
+
+	get := func(path string) (int, Response) {
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest("GET", path, nil))
+		var body Response
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(&body))
+		return res.Code, body
+	}
+
+	status, body := get("/healthz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, Response{Status: StatusUp, Version: "0.9.0", Commit: "abc123"}, body)
+
+	status, body = get("/readyz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, StatusUp, body.Status)
+	assert.Equal(t, Component{Status: StatusUp}, body.Components["mongo"])
+
+	checks["mongo"] = func(ctx context.Context) error { return failing }
+	checks["workers"] = func(ctx context.Context) error {
+		// a check that hangs is reported as down once it times out
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	status, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, StatusDown, body.Status)
+	assert.Equal(t, Component{Status: StatusDown}, body.Components["mongo"])
+	assert.Equal(t, Component{Status: StatusDown}, body.Components["workers"])
+	// the errors are logged, not exposed
+	assert.Equal(t, 1, entries.FilterMessage("readiness check mongo failed: connection refused").Len())
+	assert.Equal(t, 1, entries.FilterMessage("readiness check workers failed: context deadline exceeded").Len())
+
+	// liveness does not depend on the components
+	status, _ = get("/healthz")
+	assert.Equal(t, http.StatusOK, status)
 }
@@ -0,0 +1,163 @@
+package invitation
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/ysodiqakanni/trustank-api/internal/auth"
+	"github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/pagination"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"net/http"
+)
+
+// RegisterHandlers registers handlers for different HTTP requests.
+// Businesses manage their invitations with a JWT or with an API key checked by authenticateAPIKey.
+func RegisterHandlers(r *mux.Router, service Service, authenticateAPIKey func(ctx context.Context, key string) (primitive.ObjectID, error), logger log.Logger, secret string) {
+	res := resource{service, logger}
+
+	// Public Endpoints: the signed token is the credential of the customer
+	r.HandleFunc("/api/v1/invitations/{token}", res.getHandler).Methods("GET")
+	// links are fetched by mail scanners and prefetchers, so only the review page records that the customer came
+	r.HandleFunc("/api/v1/invitations/{token}/open", res.openHandler).Methods("POST")
+	r.HandleFunc("/api/v1/invitations/{token}/unsubscribe", res.unsubscribeHandler).Methods("POST")
+
+	// Owner-scoped Endpoints: ownership is checked by the service
+	r.Handle("/api/v1/businesses/{id}/invitations", auth.APIKeyMiddleware(http.HandlerFunc(res.inviteHandler), secret, authenticateAPIKey)).Methods("POST")
+	r.Handle("/api/v1/businesses/{id}/invitations", auth.APIKeyMiddleware(http.HandlerFunc(res.queryHandler), secret, authenticateAPIKey)).Methods("GET")
+	r.Handle("/api/v1/businesses/{id}/invitation-imports", auth.APIKeyMiddleware(http.HandlerFunc(res.importHandler), secret, authenticateAPIKey)).Methods("POST")
+	r.Handle("/api/v1/invitation-imports/{id}", auth.APIKeyMiddleware(http.HandlerFunc(res.getImportHandler), secret, authenticateAPIKey)).Methods("GET")
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) inviteHandler(w http.ResponseWriter, req *http.Request) {
+	var input InviteRequest
+
+	err := json.NewDecoder(req.Body).Decode(&input)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	invitation, created, err := r.service.Invite(req.Context(), mux.Vars(req)["id"], input)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(invitation)
+}
+
+// list the invitations of a business: ?status=&page=&per_page=
+func (r resource) queryHandler(w http.ResponseWriter, req *http.Request) {
+	businessId, status := mux.Vars(req)["id"], req.URL.Query().Get("status")
+	count, err := r.service.Count(req.Context(), businessId, status)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+	pages := pagination.NewFromRequest(req, count)
+	invitations, err := r.service.Query(req.Context(), businessId, status, pages.Offset(), pages.Limit())
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+	pages.Items = invitations
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(pages)
+}
+
+func (r resource) getHandler(w http.ResponseWriter, req *http.Request) {
+	invitation, err := r.service.Get(req.Context(), mux.Vars(req)["token"])
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+func (r resource) openHandler(w http.ResponseWriter, req *http.Request) {
+	invitation, err := r.service.Open(req.Context(), mux.Vars(req)["token"])
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+func (r resource) unsubscribeHandler(w http.ResponseWriter, req *http.Request) {
+	if err := r.service.Unsubscribe(req.Context(), mux.Vars(req)["token"]); err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// import a CSV file of orders, sent either as the body of the request or as the "file" field of a multipart form.
+// The file is streamed to storage rather than parsed in memory.
+func (r resource) importHandler(w http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(w, req.Body, MaxImportSize)
+	var file io.Reader = req.Body
+	if mr, err := req.MultipartReader(); err == nil {
+		file = nil
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			if part.FormName() == "file" {
+				file = part
+				break
+			}
+		}
+		if file == nil {
+			http.Error(w, "A multipart form with a \"file\" field is required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	imp, err := r.service.Import(req.Context(), mux.Vars(req)["id"], file)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(imp)
+}
+
+func (r resource) getImportHandler(w http.ResponseWriter, req *http.Request) {
+	imp, err := r.service.GetImport(req.Context(), mux.Vars(req)["id"])
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(imp)
+}
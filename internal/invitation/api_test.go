@@ -0,0 +1,60 @@
+package invitation
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	"github.com/ysodiqakanni/trustank-api/pkg/jobs"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/storage"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_resource_importHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imports")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	logger, _ := log.NewForTest()
+	biz := entity.Business{ID: primitive.NewObjectID(), Name: "Bukka Hut"}
+	s := NewService(newMockRepository(), mockBusinesses{biz}, &mockPublisher{}, &mockMailer{}, templates(t), storage.NewLocal(dir),
+		jobs.NewQueue(jobs.NewMemoryStore()), secret, "http://app.test", time.Hour, 0, logger)
+	res := resource{s, logger}
+
+	upload := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/businesses/"+biz.ID.Hex()+"/invitation-imports", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req = mux.SetURLVars(req, map[string]string{"id": biz.ID.Hex()})
+		w := httptest.NewRecorder()
+		res.importHandler(w, req)
+		return w
+	}
+	file := "email,name,reference\n" + strings.Repeat("jane@example.com,Jane,A-1\n", MaxImportSize/26+1)
+
+	w := upload("text/csv", []byte(file[:1000]))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	// files larger than the limit are rejected, whether sent as the body or in a form
+	w = upload("text/csv", []byte(file))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "The request body must not be larger than 10485760 bytes.\n", w.Body.String())
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	part, _ := mw.CreateFormFile("file", "orders.csv")
+	part.Write([]byte(file))
+	mw.Close()
+	w = upload(mw.FormDataContentType(), form.Bytes())
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
@@ -0,0 +1,308 @@
+package invitation
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/ysodiqakanni/trustank-api/internal/business"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	apperrors "github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/pkg/jobs"
+	"github.com/ysodiqakanni/trustank-api/pkg/tracing"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// JobImport is the type of the jobs processing imported files. Their payload is the ID of the import.
+	JobImport = "invitation.import"
+	// ImportTimeout is how long a JobImport job may run. The rows left once it elapses are processed by another job.
+	ImportTimeout = 30 * time.Minute
+	// MaxImportSize is the size in bytes of the largest CSV file that can be imported.
+	MaxImportSize = 10 << 20
+	// maxImportErrors is the number of row errors kept in an import.
+	maxImportErrors = 100
+	// progressInterval is the number of rows processed between two progress updates.
+	progressInterval = 50
+	// utf8BOM is the byte order mark that spreadsheet applications write at the start of CSV files.
+	utf8BOM = "\ufeff"
+)
+
+// importColumns lists the accepted header names of each field of an imported file.
+var importColumns = map[string][]string{
+	"email":     {"email", "customer_email"},
+	"name":      {"name", "customer_name"},
+	"reference": {"reference", "order_ref", "order_reference"},
+	"date":      {"date", "order_date"},
+}
+
+// dateFormats lists the accepted formats of the order dates of an imported file.
+var dateFormats = []string{"2006-01-02", time.RFC3339}
+
+func (s service) Import(ctx context.Context, businessId string, file io.Reader) (Import, error) {
+	ctx, span := tracing.Start(ctx, "invitation.Import")
+	defer span.End()
+	biz, err := s.businesses.GetOwned(ctx, businessId)
+	if err != nil {
+		return Import{}, err
+	}
+	// check the header before accepting the file, the rows are checked by the background processing
+	r := bufio.NewReader(file)
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return Import{}, err
+	}
+	line = strings.TrimPrefix(line, utf8BOM)
+	header, err := csv.NewReader(strings.NewReader(line)).Read()
+	if err != nil {
+		return Import{}, apperrors.BadRequest("The file is not a valid CSV file.")
+	}
+	if _, err := parseHeader(header); err != nil {
+		return Import{}, apperrors.BadRequest(err.Error())
+	}
+
+	imp := entity.InvitationImport{BusinessID: biz.ID, Status: entity.ImportQueued, CreatedAt: time.Now()}
+	if imp.ID, err = s.repo.CreateImport(ctx, imp); err != nil {
+		return Import{}, err
+	}
+	if err := s.storage.Put(ctx, importKey(imp.ID), io.MultiReader(strings.NewReader(line), r), "text/csv"); err != nil {
+		s.finish(&imp, err)
+		return Import{}, err
+	}
+	if _, err := s.queue.Enqueue(ctx, JobImport, imp.ID.Hex()); err != nil {
+		s.deleteFile(imp)
+		s.finish(&imp, err)
+		return Import{}, err
+	}
+	return Import{imp}, nil
+}
+
+func (s service) GetImport(ctx context.Context, id string) (Import, error) {
+	ctx, span := tracing.Start(ctx, "invitation.GetImport")
+	defer span.End()
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Import{}, apperrors.NotFound("")
+	}
+	imp, err := s.repo.GetImport(ctx, objectId)
+	if err != nil {
+		return Import{}, err
+	}
+	if _, err := s.businesses.GetOwned(ctx, imp.BusinessID.Hex()); err != nil {
+		return Import{}, err
+	}
+	return Import{imp}, nil
+}
+
+// ImportJob returns the handler of JobImport jobs, processing imported files with service.
+func ImportJob(service Service) jobs.Handler {
+	return func(ctx context.Context, job jobs.Job) error {
+		var id string
+		if err := job.Decode(&id); err != nil {
+			return err
+		}
+		return service.ProcessImport(ctx, id, job.Attempts >= job.MaxAttempts)
+	}
+}
+
+func (s service) ProcessImport(ctx context.Context, id string, last bool) error {
+	ctx, span := tracing.Start(ctx, "invitation.ProcessImport")
+	defer span.End()
+	span.SetAttributes(attribute.String("invitation.import_id", id))
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	imp, err := s.repo.GetImport(ctx, objectId)
+	if err != nil {
+		return err
+	}
+	if imp.FinishedAt != nil {
+		return nil
+	}
+	rows := imp.Rows
+	biz, err := s.businesses.Get(ctx, imp.BusinessID)
+	if err == nil {
+		imp.Status = entity.ImportProcessing
+		s.save(ctx, imp)
+		err = s.processFile(ctx, biz, &imp)
+	}
+	tracing.RecordError(span, err)
+	switch {
+	case err != nil && ctx.Err() == context.DeadlineExceeded && imp.Rows > rows:
+		// the job ran out of time: another job processes the rows left
+		s.save(context.Background(), imp)
+		_, err = s.queue.Enqueue(context.Background(), JobImport, id)
+		return err
+	case err != nil && !last:
+		// the job is retried, resuming after the rows processed so far
+		s.save(context.Background(), imp)
+		return err
+	}
+	s.deleteFile(imp)
+	s.finish(&imp, err)
+	return err
+}
+
+// processFile reads the rows of an imported file, updating the progress of the import as it goes.
+// The rows counted by an earlier attempt are skipped. The rows processed after the last progress update are
+// processed again, but rows are idempotent on the order reference, so no customer is invited twice.
+func (s service) processFile(ctx context.Context, biz business.Business, imp *entity.InvitationImport) error {
+	obj, err := s.storage.Get(ctx, importKey(imp.ID))
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	r := csv.NewReader(obj)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return err
+	}
+	header[0] = strings.TrimPrefix(header[0], utf8BOM)
+	cols, err := parseHeader(header)
+	if err != nil {
+		return err
+	}
+	skip := imp.Rows
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if skip > 0 {
+			if _, ok := err.(*csv.ParseError); err != nil && !ok {
+				return err
+			}
+			skip--
+			continue
+		}
+		imp.Rows++
+		// the header is row 1
+		row := imp.Rows + 1
+		if _, ok := err.(*csv.ParseError); ok {
+			addRowError(imp, row, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		req, err := cols.request(record)
+		if err != nil {
+			addRowError(imp, row, err)
+			continue
+		}
+		invitation, created, err := s.invite(ctx, biz, req)
+		if err != nil {
+			return err
+		}
+		if !created {
+			imp.Duplicates++
+		} else {
+			imp.Invited++
+			if invitation.Status != entity.InvitationUnsubscribed && s.sendDelay > 0 {
+				// spread the emails out so that the mail server does not throttle or flag them
+				select {
+				case <-time.After(s.sendDelay):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		if imp.Rows%progressInterval == 0 {
+			s.save(ctx, *imp)
+		}
+	}
+}
+
+// deleteFile deletes an imported file once it is processed. Failures are only logged.
+func (s service) deleteFile(imp entity.InvitationImport) {
+	if err := s.storage.Delete(context.Background(), importKey(imp.ID)); err != nil {
+		s.logger.Errorf("failed to delete invitation import file %s: %s", imp.ID.Hex(), err)
+	}
+}
+
+// finish records the outcome of an import.
+func (s service) finish(imp *entity.InvitationImport, err error) {
+	now := time.Now()
+	imp.FinishedAt = &now
+	imp.Status = entity.ImportCompleted
+	if err != nil {
+		s.logger.Errorf("invitation import %s failed: %s", imp.ID.Hex(), err)
+		imp.Status = entity.ImportFailed
+		imp.Error = err.Error()
+	}
+	s.save(context.Background(), *imp)
+}
+
+// save stores the progress of an import. Failures are only logged so that the processing goes on.
+func (s service) save(ctx context.Context, imp entity.InvitationImport) {
+	if err := s.repo.UpdateImport(ctx, imp); err != nil {
+		s.logger.Errorf("failed to save invitation import %s: %s", imp.ID.Hex(), err)
+	}
+}
+
+// addRowError records an invalid row in an import.
+func addRowError(imp *entity.InvitationImport, row int, err error) {
+	imp.Invalid++
+	if len(imp.Errors) < maxImportErrors {
+		imp.Errors = append(imp.Errors, entity.RowError{Row: row, Error: err.Error()})
+	}
+}
+
+// importKey returns the storage key of an imported file.
+func importKey(id primitive.ObjectID) string {
+	return "invitation-imports/" + id.Hex() + ".csv"
+}
+
+// columns maps the fields of an imported file to their index in its records.
+type columns map[string]int
+
+// parseHeader finds the fields in the header of an imported file. The date is optional.
+func parseHeader(header []string) (columns, error) {
+	cols := columns{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for field, names := range importColumns {
+			for _, n := range names {
+				if n == name {
+					cols[field] = i
+				}
+			}
+		}
+	}
+	for _, field := range []string{"email", "name", "reference"} {
+		if _, ok := cols[field]; !ok {
+			return nil, fmt.Errorf("The file has no %s column.", field)
+		}
+	}
+	return cols, nil
+}
+
+// request builds and validates the invitation request of a record.
+func (c columns) request(record []string) (InviteRequest, error) {
+	get := func(field string) string {
+		if i, ok := c[field]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	req := InviteRequest{CustomerEmail: get("email"), CustomerName: get("name"), OrderRef: get("reference")}
+	if date := get("date"); date != "" {
+		for _, format := range dateFormats {
+			if t, err := time.Parse(format, date); err == nil {
+				req.OrderDate = &t
+				break
+			}
+		}
+		if req.OrderDate == nil {
+			return InviteRequest{}, fmt.Errorf("date: %q is not a valid date, expected YYYY-MM-DD.", date)
+		}
+	}
+	return req, req.Validate()
+}
@@ -0,0 +1,147 @@
+package invitation
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	apperrors "github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/pkg/jobs"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/storage"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_parseHeader(t *testing.T) {
+	cols, err := parseHeader([]string{"Order_Ref", " Email ", "Name", "Date"})
+	assert.Nil(t, err)
+	assert.Equal(t, columns{"reference": 0, "email": 1, "name": 2, "date": 3}, cols)
+
+	_, err = parseHeader([]string{"email", "name"})
+	assert.EqualError(t, err, "The file has no reference column.")
+}
+
+func Test_columns_request(t *testing.T) {
+	cols := columns{"email": 0, "name": 1, "reference": 2, "date": 3}
+	req, err := cols.request([]string{"jane@example.com", " Jane ", "A-1", "2021-06-01"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Jane", req.CustomerName)
+	assert.Equal(t, time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC), *req.OrderDate)
+
+	_, err = cols.request([]string{"jane@example.com", "Jane", "A-1", "01/06/2021"})
+	assert.NotNil(t, err)
+	_, err = cols.request([]string{"not an email", "Jane", "A-1"})
+	assert.NotNil(t, err)
+}
+
+func Test_service_Import(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imports")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	biz := entity.Business{ID: primitive.NewObjectID(), Name: "Bukka Hut"}
+	repo, mail := newMockRepository(), &mockMailer{}
+	store := jobs.NewMemoryStore()
+	s := NewService(repo, mockBusinesses{biz}, &mockPublisher{}, mail, templates(t), storage.NewLocal(dir), jobs.NewQueue(store), secret, "http://app.test", time.Hour, 0, logger)
+	runner := jobs.NewRunner(store, logger)
+	runner.Handle(JobImport, ImportJob(s), ImportTimeout)
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go runner.Run(runCtx, 1, 5*time.Millisecond)
+
+	_, err = s.Import(ctx, biz.ID.Hex(), strings.NewReader("email,name\njane@example.com,Jane\n"))
+	assert.Equal(t, apperrors.BadRequest("The file has no reference column."), err)
+	_, err = s.Import(ctx, primitive.NewObjectID().Hex(), strings.NewReader("email,name,reference\n"))
+	assert.Equal(t, apperrors.Forbidden(""), err)
+
+	file := utf8BOM + "Email,Name,Reference,Date\n" +
+		"jane@example.com,Jane,A-1,2021-06-01\n" +
+		"john@example.com,\"Doe, John\",A-2,\n" +
+		"invalid,Nobody,A-3,\n" +
+		"jane@example.com,Jane,A-1,2021-06-01\n"
+	for attempt := 0; attempt < 2; attempt++ {
+		imp, err := s.Import(ctx, biz.ID.Hex(), strings.NewReader(file))
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, entity.ImportQueued, imp.Status)
+
+		var status Import
+		for i := 0; i < 100; i++ {
+			if status, err = s.GetImport(ctx, imp.ID.Hex()); err != nil || status.FinishedAt != nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, entity.ImportCompleted, status.Status)
+		assert.Equal(t, 4, status.Rows)
+		assert.Equal(t, 1, status.Invalid)
+		if assert.Len(t, status.Errors, 1) {
+			assert.Equal(t, 4, status.Errors[0].Row)
+		}
+		if attempt == 0 {
+			assert.Equal(t, 2, status.Invited)
+			assert.Equal(t, 1, status.Duplicates)
+		} else {
+			// uploading the file again does not invite anyone twice
+			assert.Equal(t, 0, status.Invited)
+			assert.Equal(t, 3, status.Duplicates)
+		}
+		// the file is deleted once processed
+		_, err = storage.NewLocal(dir).Get(ctx, importKey(imp.ID))
+		assert.Equal(t, storage.ErrNotFound, err)
+	}
+	assert.Len(t, mail.sent, 2)
+
+	_, err = s.GetImport(ctx, "missing")
+	assert.Equal(t, apperrors.NotFound(""), err)
+}
+
+func Test_service_ProcessImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imports")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	biz := entity.Business{ID: primitive.NewObjectID(), Name: "Bukka Hut"}
+	repo, mail := newMockRepository(), &mockMailer{}
+	files := storage.NewLocal(dir)
+	s := NewService(repo, mockBusinesses{biz}, &mockPublisher{}, mail, templates(t), files, jobs.NewQueue(jobs.NewMemoryStore()), secret, "http://app.test", time.Hour, 0, logger)
+
+	// an import interrupted after its first row resumes with the second one
+	imp := entity.InvitationImport{BusinessID: biz.ID, Status: entity.ImportProcessing, Rows: 1, Invited: 1, CreatedAt: time.Now()}
+	imp.ID, _ = repo.CreateImport(ctx, imp)
+	file := "email,name,reference\njane@example.com,Jane,A-1\njohn@example.com,John,A-2\n"
+	assert.Nil(t, files.Put(ctx, importKey(imp.ID), strings.NewReader(file), "text/csv"))
+	assert.Nil(t, s.ProcessImport(ctx, imp.ID.Hex(), false))
+	imp, _ = repo.GetImport(ctx, imp.ID)
+	assert.Equal(t, entity.ImportCompleted, imp.Status)
+	assert.Equal(t, 2, imp.Rows)
+	assert.Equal(t, 2, imp.Invited)
+	if assert.Len(t, mail.sent, 1) {
+		assert.Equal(t, "john@example.com", mail.sent[0].To)
+	}
+	// a finished import is not processed again
+	assert.Nil(t, s.ProcessImport(ctx, imp.ID.Hex(), false))
+
+	// a failure is retried until the last attempt
+	imp = entity.InvitationImport{BusinessID: biz.ID, Status: entity.ImportQueued, CreatedAt: time.Now()}
+	imp.ID, _ = repo.CreateImport(ctx, imp)
+	assert.Equal(t, storage.ErrNotFound, s.ProcessImport(ctx, imp.ID.Hex(), false))
+	imp, _ = repo.GetImport(ctx, imp.ID)
+	assert.Equal(t, entity.ImportProcessing, imp.Status)
+	assert.Equal(t, storage.ErrNotFound, s.ProcessImport(ctx, imp.ID.Hex(), true))
+	imp, _ = repo.GetImport(ctx, imp.ID)
+	assert.Equal(t, entity.ImportFailed, imp.Status)
+}
@@ -0,0 +1,192 @@
+package invitation
+
+import (
+	"context"
+	"errors"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	"github.com/ysodiqakanni/trustank-api/pkg/dbcontext"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// ErrDuplicate is returned by Create when the business already invited the customer of the order.
+var ErrDuplicate = errors.New("invitation already exists for this order")
+
+// Repository encapsulates the logic to access invitations from the data source.
+type Repository interface {
+	// Get returns the invitation with the specified ID.
+	Get(ctx context.Context, id primitive.ObjectID) (entity.Invitation, error)
+	// GetByOrder returns the invitation a business sent for an order.
+	GetByOrder(ctx context.Context, businessId primitive.ObjectID, orderRef string) (entity.Invitation, error)
+	// Create saves a new invitation and returns its ID.
+	Create(ctx context.Context, invitation entity.Invitation) (primitive.ObjectID, error)
+	// Query returns the invitations of a business, newest first, optionally filtered by status.
+	Query(ctx context.Context, businessId primitive.ObjectID, status string, offset, limit int) ([]entity.Invitation, error)
+	// Count returns the number of invitations of a business, optionally filtered by status.
+	Count(ctx context.Context, businessId primitive.ObjectID, status string) (int, error)
+	// SetStatus changes the status of an invitation whose status is one of from, recording the time in the
+	// given field. mongo.ErrNoDocuments is returned if no such invitation exists.
+	SetStatus(ctx context.Context, id primitive.ObjectID, from []string, status, timeField string, at time.Time) error
+	// IsUnsubscribed reports whether a customer unsubscribed from the invitations of a business.
+	IsUnsubscribed(ctx context.Context, businessId primitive.ObjectID, email string) (bool, error)
+	// Unsubscribe stops the invitations of a business to a customer.
+	Unsubscribe(ctx context.Context, businessId primitive.ObjectID, email string) error
+	// CreateImport saves a new invitation import and returns its ID.
+	CreateImport(ctx context.Context, imp entity.InvitationImport) (primitive.ObjectID, error)
+	// GetImport returns the invitation import with the specified ID.
+	GetImport(ctx context.Context, id primitive.ObjectID) (entity.InvitationImport, error)
+	// UpdateImport saves the progress of an invitation import.
+	UpdateImport(ctx context.Context, imp entity.InvitationImport) error
+}
+
+// repository persists invitations in database
+type repository struct {
+	collection   *mongo.Collection
+	unsubscribes *mongo.Collection
+	imports      *mongo.Collection
+	logger       log.Logger
+}
+
+// NewRepository creates a new invitation repository.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	r := repository{
+		db.DB().Collection("invitations"),
+		db.DB().Collection("invitation_unsubscribes"),
+		db.DB().Collection("invitation_imports"),
+		logger,
+	}
+	r.ensureIndexes()
+	return r
+}
+
+// ensureIndexes creates the indexes required by the repository queries if they do not exist yet.
+func (r repository) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "business_id", Value: 1}, {Key: "order_ref", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "business_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		r.logger.Errorf("failed to create invitation indexes: %v", err)
+	}
+	_, err = r.unsubscribes.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "business_id", Value: 1}, {Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		r.logger.Errorf("failed to create invitation unsubscribe indexes: %v", err)
+	}
+}
+
+func (r repository) Get(ctx context.Context, id primitive.ObjectID) (entity.Invitation, error) {
+	var invitation entity.Invitation
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&invitation)
+	return invitation, err
+}
+
+func (r repository) GetByOrder(ctx context.Context, businessId primitive.ObjectID, orderRef string) (entity.Invitation, error) {
+	var invitation entity.Invitation
+	err := r.collection.FindOne(ctx, bson.M{"business_id": businessId, "order_ref": orderRef}).Decode(&invitation)
+	return invitation, err
+}
+
+func (r repository) Create(ctx context.Context, invitation entity.Invitation) (primitive.ObjectID, error) {
+	result, err := r.collection.InsertOne(ctx, invitation)
+	if mongo.IsDuplicateKeyError(err) {
+		return primitive.NilObjectID, ErrDuplicate
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return result.InsertedID.(primitive.ObjectID), nil
+}
+
+func (r repository) Query(ctx context.Context, businessId primitive.ObjectID, status string, offset, limit int) ([]entity.Invitation, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, filter(businessId, status), opts)
+	if err != nil {
+		return nil, err
+	}
+	invitations := []entity.Invitation{}
+	err = cursor.All(ctx, &invitations)
+	return invitations, err
+}
+
+func (r repository) Count(ctx context.Context, businessId primitive.ObjectID, status string) (int, error) {
+	count, err := r.collection.CountDocuments(ctx, filter(businessId, status))
+	return int(count), err
+}
+
+func (r repository) SetStatus(ctx context.Context, id primitive.ObjectID, from []string, status, timeField string, at time.Time) error {
+	query := bson.M{"_id": id, "status": bson.M{"$in": from}}
+	update := bson.M{"status": status}
+	if timeField != "" {
+		update[timeField] = at
+	}
+	result, err := r.collection.UpdateOne(ctx, query, bson.M{"$set": update})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r repository) IsUnsubscribed(ctx context.Context, businessId primitive.ObjectID, email string) (bool, error) {
+	count, err := r.unsubscribes.CountDocuments(ctx, bson.M{"business_id": businessId, "email": strings.ToLower(email)})
+	return count > 0, err
+}
+
+func (r repository) Unsubscribe(ctx context.Context, businessId primitive.ObjectID, email string) error {
+	query := bson.M{"business_id": businessId, "email": strings.ToLower(email)}
+	update := bson.M{"$setOnInsert": bson.M{"created_at": time.Now()}}
+	_, err := r.unsubscribes.UpdateOne(ctx, query, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (r repository) CreateImport(ctx context.Context, imp entity.InvitationImport) (primitive.ObjectID, error) {
+	result, err := r.imports.InsertOne(ctx, imp)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return result.InsertedID.(primitive.ObjectID), nil
+}
+
+func (r repository) GetImport(ctx context.Context, id primitive.ObjectID) (entity.InvitationImport, error) {
+	var imp entity.InvitationImport
+	err := r.imports.FindOne(ctx, bson.M{"_id": id}).Decode(&imp)
+	return imp, err
+}
+
+func (r repository) UpdateImport(ctx context.Context, imp entity.InvitationImport) error {
+	result, err := r.imports.ReplaceOne(ctx, bson.M{"_id": imp.ID}, imp)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// filter returns the query selecting the invitations of a business, optionally with the given status.
+func filter(businessId primitive.ObjectID, status string) bson.M {
+	query := bson.M{"business_id": businessId}
+	if status != "" {
+		query["status"] = status
+	}
+	return query
+}
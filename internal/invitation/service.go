@@ -0,0 +1,311 @@
+package invitation
+
+import (
+	"context"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/ysodiqakanni/trustank-api/internal/business"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	apperrors "github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/internal/webhook"
+	"github.com/ysodiqakanni/trustank-api/pkg/jobs"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/mailer"
+	"github.com/ysodiqakanni/trustank-api/pkg/metrics"
+	"github.com/ysodiqakanni/trustank-api/pkg/storage"
+	"github.com/ysodiqakanni/trustank-api/pkg/tracing"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"strings"
+	"time"
+)
+
+// invitationsTotal counts the invitations by outcome: the status they were sent with, then what the customers did.
+var invitationsTotal = metrics.NewCounter("trustank_invitations_total", "Number of review invitations by outcome.", "outcome")
+
+// Service encapsulates use case logic for review invitations.
+//
+// Invitations cannot be redeemed yet. Turning a review submitted with a token into a verified review, once per
+// token, needs the review entity, which does not exist.
+type Service interface {
+	// Invite creates an invitation for a customer of a business managed by the current user or API key and emails it.
+	// If the business already invited the customer of the order, the existing invitation is returned and created is false.
+	Invite(ctx context.Context, businessId string, req InviteRequest) (invitation Invitation, created bool, err error)
+	// Query returns the invitations of a business managed by the current user or API key, optionally filtered by status.
+	Query(ctx context.Context, businessId, status string, offset, limit int) ([]Invitation, error)
+	// Count returns the number of invitations of a business managed by the current user or API key.
+	Count(ctx context.Context, businessId, status string) (int, error)
+	// Get returns the invitation of a token if it can still be used. It does not change the invitation.
+	Get(ctx context.Context, token string) (Invitation, error)
+	// Open returns the invitation of a token and records that the customer followed the link.
+	Open(ctx context.Context, token string) (Invitation, error)
+	// Unsubscribe stops the invitations of the business to the customer of a token.
+	Unsubscribe(ctx context.Context, token string) error
+	// Import stores a CSV file of orders for a business managed by the current user or API key, and enqueues a
+	// JobImport job inviting the customers of its rows.
+	Import(ctx context.Context, businessId string, file io.Reader) (Import, error)
+	// ProcessImport invites the customers of the rows of an imported file that were not processed yet. It is run by
+	// the JobImport jobs. A failure is recorded in the import when last is true, otherwise the job is retried.
+	ProcessImport(ctx context.Context, id string, last bool) error
+	// GetImport returns the progress of an import of a business managed by the current user or API key.
+	GetImport(ctx context.Context, id string) (Import, error)
+}
+
+// Businesses gives access to the businesses that the current user or API key manages.
+type Businesses interface {
+	GetOwned(ctx context.Context, businessId string) (business.Business, error)
+	// Get returns any business, for the imports processed in the background.
+	Get(ctx context.Context, id primitive.ObjectID) (business.Business, error)
+}
+
+// Invitation represents a review invitation.
+type Invitation struct {
+	entity.Invitation
+}
+
+// Import represents the progress of an invitation import.
+type Import struct {
+	entity.InvitationImport
+}
+
+// InviteRequest represents a request to invite a customer to review a business.
+type InviteRequest struct {
+	CustomerEmail string `json:"customer_email"`
+	CustomerName  string `json:"customer_name"`
+	OrderRef      string `json:"order_ref"`
+	// OrderDate optionally records when the order was placed.
+	OrderDate *time.Time `json:"order_date,omitempty"`
+	// Locale optionally selects the language of the email, such as "en" or "fr-CA".
+	Locale string `json:"locale,omitempty"`
+}
+
+// Validate validates the InviteRequest fields.
+func (m InviteRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.CustomerEmail, validation.Required, validation.Length(0, 128), is.Email),
+		validation.Field(&m.CustomerName, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.OrderRef, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.Locale, validation.Length(0, 16)),
+	)
+}
+
+type service struct {
+	repo       Repository
+	businesses Businesses
+	webhooks   webhook.Publisher
+	mailer     mailer.Mailer
+	templates  *mailer.Templates
+	storage    storage.Storage
+	queue      *jobs.Queue
+	secret     string
+	baseURL    string
+	expiry     time.Duration
+	sendDelay  time.Duration
+	logger     log.Logger
+}
+
+// NewService creates a new invitation service. Tokens are signed with secret, and the links sent to customers
+// start with baseURL, the address of the web application, in emails rendered from the "invitation" template.
+// Invitations expire after the given duration.
+// Imported files are kept in storage while the JobImport jobs of queue process them, waiting sendDelay after each
+// email sent. The businesses are notified of what their customers do with their invitations through webhooks.
+func NewService(repo Repository, businesses Businesses, webhooks webhook.Publisher, mailer mailer.Mailer, templates *mailer.Templates, storage storage.Storage, queue *jobs.Queue, secret, baseURL string, expiry, sendDelay time.Duration, logger log.Logger) Service {
+	return service{repo, businesses, webhooks, mailer, templates, storage, queue, secret, strings.TrimSuffix(baseURL, "/"), expiry, sendDelay, logger}
+}
+
+func (s service) Invite(ctx context.Context, businessId string, req InviteRequest) (Invitation, bool, error) {
+	ctx, span := tracing.Start(ctx, "invitation.Invite")
+	defer span.End()
+	if err := req.Validate(); err != nil {
+		return Invitation{}, false, err
+	}
+	biz, err := s.businesses.GetOwned(ctx, businessId)
+	if err != nil {
+		return Invitation{}, false, err
+	}
+	return s.invite(ctx, biz, req)
+}
+
+// invite creates and sends an invitation for a valid request.
+func (s service) invite(ctx context.Context, biz business.Business, req InviteRequest) (Invitation, bool, error) {
+	if existing, err := s.repo.GetByOrder(ctx, biz.ID, req.OrderRef); err == nil {
+		return Invitation{existing}, false, nil
+	} else if err != mongo.ErrNoDocuments {
+		return Invitation{}, false, err
+	}
+
+	now := time.Now()
+	invitation := entity.Invitation{
+		BusinessID:    biz.ID,
+		CustomerEmail: strings.ToLower(strings.TrimSpace(req.CustomerEmail)),
+		CustomerName:  req.CustomerName,
+		OrderRef:      req.OrderRef,
+		OrderDate:     req.OrderDate,
+		Locale:        req.Locale,
+		Status:        entity.InvitationPending,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(s.expiry),
+	}
+	unsubscribed, err := s.repo.IsUnsubscribed(ctx, biz.ID, invitation.CustomerEmail)
+	if err != nil {
+		return Invitation{}, false, err
+	}
+	if unsubscribed {
+		invitation.Status = entity.InvitationUnsubscribed
+	}
+	invitation.ID, err = s.repo.Create(ctx, invitation)
+	if err == ErrDuplicate {
+		// another request created the invitation concurrently
+		existing, err := s.repo.GetByOrder(ctx, biz.ID, req.OrderRef)
+		return Invitation{existing}, false, err
+	}
+	if err != nil {
+		return Invitation{}, false, err
+	}
+	if unsubscribed {
+		return Invitation{invitation}, true, nil
+	}
+
+	status, field := entity.InvitationSent, "sent_at"
+	if err := s.send(ctx, biz, invitation); err != nil {
+		s.logger.With(ctx).Errorf("failed to send invitation %s: %s", invitation.ID.Hex(), err)
+		status, field = entity.InvitationFailed, ""
+	}
+	if err := s.repo.SetStatus(ctx, invitation.ID, []string{entity.InvitationPending}, status, field, now); err != nil {
+		return Invitation{}, false, err
+	}
+	invitationsTotal.Inc(status)
+	invitation.Status = status
+	if field != "" {
+		invitation.SentAt = &now
+	}
+	return Invitation{invitation}, true, nil
+}
+
+func (s service) Query(ctx context.Context, businessId, status string, offset, limit int) ([]Invitation, error) {
+	ctx, span := tracing.Start(ctx, "invitation.Query")
+	defer span.End()
+	biz, err := s.businesses.GetOwned(ctx, businessId)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.repo.Query(ctx, biz.ID, status, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Invitation{}
+	for _, item := range items {
+		result = append(result, Invitation{item})
+	}
+	return result, nil
+}
+
+func (s service) Count(ctx context.Context, businessId, status string) (int, error) {
+	ctx, span := tracing.Start(ctx, "invitation.Count")
+	defer span.End()
+	biz, err := s.businesses.GetOwned(ctx, businessId)
+	if err != nil {
+		return 0, err
+	}
+	return s.repo.Count(ctx, biz.ID, status)
+}
+
+func (s service) Get(ctx context.Context, token string) (Invitation, error) {
+	ctx, span := tracing.Start(ctx, "invitation.Get")
+	defer span.End()
+	invitation, err := s.usable(ctx, token)
+	if err != nil {
+		return Invitation{}, err
+	}
+	return Invitation{invitation}, nil
+}
+
+func (s service) Open(ctx context.Context, token string) (Invitation, error) {
+	ctx, span := tracing.Start(ctx, "invitation.Open")
+	defer span.End()
+	invitation, err := s.usable(ctx, token)
+	if err != nil {
+		return Invitation{}, err
+	}
+	if invitation.OpenedAt == nil {
+		now := time.Now()
+		from := []string{entity.InvitationPending, entity.InvitationSent, entity.InvitationFailed}
+		if err := s.repo.SetStatus(ctx, invitation.ID, from, entity.InvitationOpened, "opened_at", now); err == nil {
+			invitation.Status = entity.InvitationOpened
+			invitation.OpenedAt = &now
+			s.publish(ctx, webhook.EventInvitationOpened, invitation)
+		} else if err != mongo.ErrNoDocuments {
+			return Invitation{}, err
+		}
+	}
+	return Invitation{invitation}, nil
+}
+
+func (s service) Unsubscribe(ctx context.Context, token string) error {
+	ctx, span := tracing.Start(ctx, "invitation.Unsubscribe")
+	defer span.End()
+	invitation, err := s.get(ctx, token)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Unsubscribe(ctx, invitation.BusinessID, invitation.CustomerEmail); err != nil {
+		return err
+	}
+	s.publish(ctx, webhook.EventInvitationUnsubscribed, invitation)
+	return nil
+}
+
+// publish notifies the webhooks of the business of an invitation event. The customer action has already been
+// recorded, so a failure is only logged.
+func (s service) publish(ctx context.Context, eventType string, invitation entity.Invitation) {
+	invitationsTotal.Inc(strings.TrimPrefix(eventType, "invitation."))
+	if err := s.webhooks.Publish(ctx, invitation.BusinessID, eventType, Invitation{invitation}); err != nil {
+		s.logger.With(ctx).Errorf("failed to publish %s webhook event: %s", eventType, err)
+	}
+}
+
+// get returns the invitation of a token. An invalid token is reported as not found.
+func (s service) get(ctx context.Context, token string) (entity.Invitation, error) {
+	id, ok := verify(token, s.secret)
+	if !ok {
+		return entity.Invitation{}, apperrors.NotFound("")
+	}
+	return s.repo.Get(ctx, id)
+}
+
+// usable returns the invitation of a token if it can still be used to submit a review.
+func (s service) usable(ctx context.Context, token string) (entity.Invitation, error) {
+	invitation, err := s.get(ctx, token)
+	if err != nil {
+		return entity.Invitation{}, err
+	}
+	switch {
+	case invitation.Status == entity.InvitationUnsubscribed:
+		return entity.Invitation{}, apperrors.NotFound("")
+	case time.Now().After(invitation.ExpiresAt):
+		return entity.Invitation{}, apperrors.BadRequest("This invitation has expired.")
+	}
+	return invitation, nil
+}
+
+// send emails an invitation to the customer.
+func (s service) send(ctx context.Context, biz business.Business, invitation entity.Invitation) error {
+	token := sign(invitation.ID, s.secret)
+	reviewURL := s.baseURL + "/invitations/" + token
+	unsubscribeURL := reviewURL + "/unsubscribe"
+	msg, err := s.templates.Render(invitation.Locale, "invitation", map[string]interface{}{
+		"CustomerName":   invitation.CustomerName,
+		"BusinessName":   biz.Name,
+		"OrderRef":       invitation.OrderRef,
+		"ReviewURL":      reviewURL,
+		"UnsubscribeURL": unsubscribeURL,
+		"ExpiresAt":      invitation.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	msg.To = invitation.CustomerEmail
+	msg.Headers = map[string]string{"List-Unsubscribe": "<" + unsubscribeURL + ">"}
+	return s.mailer.Send(ctx, msg)
+}
@@ -0,0 +1,300 @@
+package invitation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysodiqakanni/trustank-api/internal/business"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	apperrors "github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/internal/webhook"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/mailer"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const secret = "secret"
+
+type mockRepository struct {
+	sync.Mutex
+	items        map[primitive.ObjectID]entity.Invitation
+	unsubscribes map[string]bool
+	imports      map[primitive.ObjectID]entity.InvitationImport
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{
+		items:        map[primitive.ObjectID]entity.Invitation{},
+		unsubscribes: map[string]bool{},
+		imports:      map[primitive.ObjectID]entity.InvitationImport{},
+	}
+}
+
+func (m *mockRepository) Get(ctx context.Context, id primitive.ObjectID) (entity.Invitation, error) {
+	m.Lock()
+	defer m.Unlock()
+	if item, ok := m.items[id]; ok {
+		return item, nil
+	}
+	return entity.Invitation{}, mongo.ErrNoDocuments
+}
+
+func (m *mockRepository) GetByOrder(ctx context.Context, businessId primitive.ObjectID, orderRef string) (entity.Invitation, error) {
+	m.Lock()
+	defer m.Unlock()
+	for _, item := range m.items {
+		if item.BusinessID == businessId && item.OrderRef == orderRef {
+			return item, nil
+		}
+	}
+	return entity.Invitation{}, mongo.ErrNoDocuments
+}
+
+func (m *mockRepository) Create(ctx context.Context, invitation entity.Invitation) (primitive.ObjectID, error) {
+	m.Lock()
+	defer m.Unlock()
+	invitation.ID = primitive.NewObjectID()
+	m.items[invitation.ID] = invitation
+	return invitation.ID, nil
+}
+
+func (m *mockRepository) Query(ctx context.Context, businessId primitive.ObjectID, status string, offset, limit int) ([]entity.Invitation, error) {
+	m.Lock()
+	defer m.Unlock()
+	var result []entity.Invitation
+	for _, item := range m.items {
+		if item.BusinessID == businessId && (status == "" || item.Status == status) {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockRepository) Count(ctx context.Context, businessId primitive.ObjectID, status string) (int, error) {
+	items, _ := m.Query(ctx, businessId, status, 0, 0)
+	return len(items), nil
+}
+
+func (m *mockRepository) CreateImport(ctx context.Context, imp entity.InvitationImport) (primitive.ObjectID, error) {
+	m.Lock()
+	defer m.Unlock()
+	imp.ID = primitive.NewObjectID()
+	m.imports[imp.ID] = imp
+	return imp.ID, nil
+}
+
+func (m *mockRepository) GetImport(ctx context.Context, id primitive.ObjectID) (entity.InvitationImport, error) {
+	m.Lock()
+	defer m.Unlock()
+	if imp, ok := m.imports[id]; ok {
+		return imp, nil
+	}
+	return entity.InvitationImport{}, mongo.ErrNoDocuments
+}
+
+func (m *mockRepository) UpdateImport(ctx context.Context, imp entity.InvitationImport) error {
+	m.Lock()
+	defer m.Unlock()
+	// copy the errors as the caller keeps appending to them
+	imp.Errors = append([]entity.RowError(nil), imp.Errors...)
+	m.imports[imp.ID] = imp
+	return nil
+}
+
+func (m *mockRepository) SetStatus(ctx context.Context, id primitive.ObjectID, from []string, status, timeField string, at time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	item, ok := m.items[id]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	for _, f := range from {
+		if item.Status == f {
+			item.Status = status
+			switch timeField {
+			case "sent_at":
+				item.SentAt = &at
+			case "opened_at":
+				item.OpenedAt = &at
+			}
+			m.items[id] = item
+			return nil
+		}
+	}
+	return mongo.ErrNoDocuments
+}
+
+func (m *mockRepository) IsUnsubscribed(ctx context.Context, businessId primitive.ObjectID, email string) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.unsubscribes[businessId.Hex()+email], nil
+}
+
+func (m *mockRepository) Unsubscribe(ctx context.Context, businessId primitive.ObjectID, email string) error {
+	m.Lock()
+	defer m.Unlock()
+	m.unsubscribes[businessId.Hex()+email] = true
+	return nil
+}
+
+type mockBusinesses struct {
+	business entity.Business
+}
+
+func (m mockBusinesses) GetOwned(ctx context.Context, businessId string) (business.Business, error) {
+	if businessId != m.business.ID.Hex() {
+		return business.Business{}, apperrors.Forbidden("")
+	}
+	return business.Business{Business: m.business}, nil
+}
+
+func (m mockBusinesses) Get(ctx context.Context, id primitive.ObjectID) (business.Business, error) {
+	if id != m.business.ID {
+		return business.Business{}, mongo.ErrNoDocuments
+	}
+	return business.Business{Business: m.business}, nil
+}
+
+type mockPublisher struct {
+	events []string
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, businessId primitive.ObjectID, eventType string, data interface{}) error {
+	m.events = append(m.events, eventType)
+	return nil
+}
+
+type mockMailer struct {
+	sent []mailer.Message
+	err  error
+}
+
+func (m *mockMailer) Send(ctx context.Context, msg mailer.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// templates loads the email templates of the repository.
+func templates(t *testing.T) *mailer.Templates {
+	templates, err := mailer.LoadTemplates("../../templates/mail", "en")
+	assert.Nil(t, err)
+	return templates
+}
+
+// token extracts the invitation token from the link of a sent message.
+func token(msg mailer.Message) string {
+	link := strings.TrimPrefix(msg.Headers["List-Unsubscribe"], "<http://app.test/invitations/")
+	return strings.TrimSuffix(link, "/unsubscribe>")
+}
+
+func Test_service_Invite(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	biz := entity.Business{ID: primitive.NewObjectID(), Name: "Bukka Hut"}
+	repo, mail := newMockRepository(), &mockMailer{}
+	s := NewService(repo, mockBusinesses{biz}, &mockPublisher{}, mail, templates(t), nil, nil, secret, "http://app.test/", 24*time.Hour, 0, logger)
+	req := InviteRequest{CustomerEmail: "Jane@example.com", CustomerName: "Jane", OrderRef: "A-1"}
+
+	_, _, err := s.Invite(ctx, biz.ID.Hex(), InviteRequest{})
+	assert.NotNil(t, err)
+	_, _, err = s.Invite(ctx, primitive.NewObjectID().Hex(), req)
+	assert.Equal(t, apperrors.Forbidden(""), err)
+
+	invitation, created, err := s.Invite(ctx, biz.ID.Hex(), req)
+	assert.Nil(t, err)
+	assert.True(t, created)
+	assert.Equal(t, entity.InvitationSent, invitation.Status)
+	assert.Equal(t, "jane@example.com", invitation.CustomerEmail)
+	assert.NotNil(t, invitation.SentAt)
+	if assert.Len(t, mail.sent, 1) {
+		assert.Equal(t, "jane@example.com", mail.sent[0].To)
+		assert.Equal(t, "How was your experience with Bukka Hut?", mail.sent[0].Subject)
+		assert.Contains(t, mail.sent[0].Text, "http://app.test/invitations/"+token(mail.sent[0]))
+		assert.Contains(t, mail.sent[0].HTML, "http://app.test/invitations/"+token(mail.sent[0]))
+	}
+
+	// a second invitation for the same order is not sent
+	again, created, err := s.Invite(ctx, biz.ID.Hex(), req)
+	assert.Nil(t, err)
+	assert.False(t, created)
+	assert.Equal(t, invitation.ID, again.ID)
+	assert.Len(t, mail.sent, 1)
+
+	// delivery failures are recorded
+	mail.err = errors.New("smtp down")
+	req.OrderRef = "A-2"
+	invitation, _, err = s.Invite(ctx, biz.ID.Hex(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.InvitationFailed, invitation.Status)
+
+	count, err := s.Count(ctx, biz.ID.Hex(), "")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	items, err := s.Query(ctx, biz.ID.Hex(), entity.InvitationFailed, 0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+}
+
+func Test_service_Lifecycle(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	biz := entity.Business{ID: primitive.NewObjectID(), Name: "Bukka Hut"}
+	repo, mail := newMockRepository(), &mockMailer{}
+	webhooks := &mockPublisher{}
+	s := NewService(repo, mockBusinesses{biz}, webhooks, mail, templates(t), nil, nil, secret, "http://app.test", 24*time.Hour, 0, logger)
+
+	_, _, err := s.Invite(ctx, biz.ID.Hex(), InviteRequest{CustomerEmail: "jane@example.com", CustomerName: "Jane", OrderRef: "A-1"})
+	assert.Nil(t, err)
+	tok := token(mail.sent[0])
+
+	_, err = s.Open(ctx, tok+"x")
+	assert.Equal(t, apperrors.NotFound(""), err)
+
+	// viewing the invitation does not record that it was opened
+	invitation, err := s.Get(ctx, tok)
+	assert.Nil(t, err)
+	assert.Nil(t, invitation.OpenedAt)
+	assert.Empty(t, webhooks.events)
+
+	invitation, err = s.Open(ctx, tok)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.InvitationOpened, invitation.Status)
+	assert.NotNil(t, invitation.OpenedAt)
+
+	// opening again is not notified twice
+	_, err = s.Open(ctx, tok)
+	assert.Nil(t, err)
+
+	// unsubscribed customers are not invited again
+	assert.Nil(t, s.Unsubscribe(ctx, tok))
+	invitation, created, err := s.Invite(ctx, biz.ID.Hex(), InviteRequest{CustomerEmail: "JANE@example.com", CustomerName: "Jane", OrderRef: "A-2"})
+	assert.Nil(t, err)
+	assert.True(t, created)
+	assert.Equal(t, entity.InvitationUnsubscribed, invitation.Status)
+	assert.Len(t, mail.sent, 1)
+
+	assert.Equal(t, []string{webhook.EventInvitationOpened, webhook.EventInvitationUnsubscribed}, webhooks.events)
+}
+
+func Test_service_Expired(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := newMockRepository()
+	id, _ := repo.Create(context.Background(), entity.Invitation{Status: entity.InvitationSent, ExpiresAt: time.Now().Add(-time.Minute)})
+	s := NewService(repo, mockBusinesses{}, &mockPublisher{}, &mockMailer{}, templates(t), nil, nil, secret, "http://app.test", time.Hour, 0, logger)
+
+	_, err := s.Get(context.Background(), sign(id, secret))
+	assert.Equal(t, apperrors.BadRequest("This invitation has expired."), err)
+	_, err = s.Open(context.Background(), sign(id, secret))
+	assert.Equal(t, apperrors.BadRequest("This invitation has expired."), err)
+	_, err = s.Get(context.Background(), sign(id, "other secret"))
+	assert.Equal(t, apperrors.NotFound(""), err)
+}
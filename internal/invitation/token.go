@@ -0,0 +1,34 @@
+package invitation
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+)
+
+// sign returns the token of an invitation: its ID followed by an HMAC-SHA256 signature of the ID.
+func sign(id primitive.ObjectID, secret string) string {
+	return id.Hex() + "." + base64.RawURLEncoding.EncodeToString(mac(id.Hex(), secret))
+}
+
+// verify checks the signature of an invitation token and returns the invitation ID.
+func verify(token, secret string) (primitive.ObjectID, bool) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return primitive.NilObjectID, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, mac(parts[0], secret)) {
+		return primitive.NilObjectID, false
+	}
+	id, err := primitive.ObjectIDFromHex(parts[0])
+	return id, err == nil
+}
+
+func mac(id, secret string) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte("invitation:" + id))
+	return h.Sum(nil)
+}
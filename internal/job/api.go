@@ -0,0 +1,89 @@
+package job
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/ysodiqakanni/trustank-api/internal/auth"
+	"github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/pkg/jobs"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/pagination"
+	"net/http"
+)
+
+// RegisterHandlers registers handlers for different HTTP requests.
+func RegisterHandlers(r *mux.Router, service Service, logger log.Logger, secret string) {
+	res := resource{service, logger}
+	admin := func(h http.HandlerFunc) http.Handler {
+		return auth.AuthenticateMiddleware(auth.RoleMiddleware(h, "admin"), secret)
+	}
+
+	// Admin Endpoints
+	r.Handle("/api/v1/admin/jobs", admin(res.queryHandler)).Methods("GET")
+	r.Handle("/api/v1/admin/jobs/{id}", admin(res.getHandler)).Methods("GET")
+	r.Handle("/api/v1/admin/jobs/{id}/retry", admin(res.retryHandler)).Methods("POST")
+	r.Handle("/api/v1/admin/jobs/{id}/cancel", admin(res.cancelHandler)).Methods("POST")
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// list the jobs: ?type=&status=&page=&per_page=
+func (r resource) queryHandler(w http.ResponseWriter, req *http.Request) {
+	filter := jobs.Filter{Type: req.URL.Query().Get("type"), Status: req.URL.Query().Get("status")}
+	count, err := r.service.Count(req.Context(), filter)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+	pages := pagination.NewFromRequest(req, count)
+	items, err := r.service.Query(req.Context(), filter, pages.Offset(), pages.Limit())
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+	pages.Items = items
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(pages)
+}
+
+func (r resource) getHandler(w http.ResponseWriter, req *http.Request) {
+	job, err := r.service.Get(req.Context(), mux.Vars(req)["id"])
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (r resource) retryHandler(w http.ResponseWriter, req *http.Request) {
+	job, err := r.service.Retry(req.Context(), mux.Vars(req)["id"])
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (r resource) cancelHandler(w http.ResponseWriter, req *http.Request) {
+	job, err := r.service.Cancel(req.Context(), mux.Vars(req)["id"])
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
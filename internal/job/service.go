@@ -0,0 +1,80 @@
+package job
+
+import (
+	"context"
+	apperrors "github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/pkg/jobs"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/tracing"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Service encapsulates the administration of background jobs.
+type Service interface {
+	// Get returns the job with the specified ID.
+	Get(ctx context.Context, id string) (jobs.Job, error)
+	// Query returns the jobs matching the filter, newest first.
+	Query(ctx context.Context, filter jobs.Filter, offset, limit int) ([]jobs.Job, error)
+	// Count returns the number of jobs matching the filter.
+	Count(ctx context.Context, filter jobs.Filter) (int, error)
+	// Retry queues a failed or canceled job again.
+	Retry(ctx context.Context, id string) (jobs.Job, error)
+	// Cancel cancels a queued job.
+	Cancel(ctx context.Context, id string) (jobs.Job, error)
+}
+
+type service struct {
+	queue  *jobs.Queue
+	logger log.Logger
+}
+
+// NewService creates a new job administration service.
+func NewService(queue *jobs.Queue, logger log.Logger) Service {
+	return service{queue, logger}
+}
+
+func (s service) Get(ctx context.Context, id string) (jobs.Job, error) {
+	ctx, span := tracing.Start(ctx, "job.Get")
+	defer span.End()
+	return s.do(ctx, id, s.queue.Get)
+}
+
+func (s service) Query(ctx context.Context, filter jobs.Filter, offset, limit int) ([]jobs.Job, error) {
+	ctx, span := tracing.Start(ctx, "job.Query")
+	defer span.End()
+	return s.queue.Query(ctx, filter, offset, limit)
+}
+
+func (s service) Count(ctx context.Context, filter jobs.Filter) (int, error) {
+	ctx, span := tracing.Start(ctx, "job.Count")
+	defer span.End()
+	return s.queue.Count(ctx, filter)
+}
+
+func (s service) Retry(ctx context.Context, id string) (jobs.Job, error) {
+	ctx, span := tracing.Start(ctx, "job.Retry")
+	defer span.End()
+	return s.do(ctx, id, s.queue.Retry)
+}
+
+func (s service) Cancel(ctx context.Context, id string) (jobs.Job, error) {
+	ctx, span := tracing.Start(ctx, "job.Cancel")
+	defer span.End()
+	return s.do(ctx, id, s.queue.Cancel)
+}
+
+// do calls f with the ID of a job, translating the queue errors into HTTP errors.
+func (s service) do(ctx context.Context, id string, f func(ctx context.Context, id primitive.ObjectID) (jobs.Job, error)) (jobs.Job, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return jobs.Job{}, apperrors.NotFound("")
+	}
+	job, err := f(ctx, objectId)
+	switch err {
+	case jobs.ErrNotFound:
+		return jobs.Job{}, apperrors.NotFound("")
+	case jobs.ErrStatus:
+		return jobs.Job{}, apperrors.BadRequest("The job cannot be changed in its current status.")
+	}
+	return job, err
+}
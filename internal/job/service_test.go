@@ -0,0 +1,37 @@
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apperrors "github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/pkg/jobs"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_service(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	queue := jobs.NewQueue(jobs.NewMemoryStore())
+	s := NewService(queue, logger)
+	job, _ := queue.Enqueue(ctx, "export", nil)
+
+	_, err := s.Get(ctx, "missing")
+	assert.Equal(t, apperrors.NotFound(""), err)
+	_, err = s.Get(ctx, primitive.NewObjectID().Hex())
+	assert.Equal(t, apperrors.NotFound(""), err)
+
+	_, err = s.Retry(ctx, job.ID.Hex())
+	assert.Equal(t, apperrors.BadRequest("The job cannot be changed in its current status."), err)
+	canceled, err := s.Cancel(ctx, job.ID.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, jobs.StatusCanceled, canceled.Status)
+	retried, err := s.Retry(ctx, job.ID.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, jobs.StatusQueued, retried.Status)
+
+	count, _ := s.Count(ctx, jobs.Filter{Status: jobs.StatusQueued})
+	assert.Equal(t, 1, count)
+}
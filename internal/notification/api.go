@@ -0,0 +1,115 @@
+package notification
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/ysodiqakanni/trustank-api/internal/auth"
+	"github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/pagination"
+	"net/http"
+	"strconv"
+)
+
+// RegisterHandlers registers handlers for different HTTP requests.
+func RegisterHandlers(r *mux.Router, service Service, logger log.Logger, secret string) {
+	res := resource{service, logger}
+	user := func(h http.HandlerFunc) http.Handler {
+		return auth.AuthenticateMiddleware(h, secret)
+	}
+
+	// Authenticated Endpoints: the notifications of the current user
+	r.Handle("/api/v1/notifications", user(res.queryHandler)).Methods("GET")
+	r.Handle("/api/v1/notifications/read", user(res.markAllReadHandler)).Methods("POST")
+	r.Handle("/api/v1/notifications/preferences", user(res.getPreferencesHandler)).Methods("GET")
+	r.Handle("/api/v1/notifications/preferences", user(res.updatePreferencesHandler)).Methods("PUT")
+	r.Handle("/api/v1/notifications/{id}/read", user(res.markReadHandler)).Methods("POST")
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// list the notifications: ?unread=true&page=&per_page=
+// The number of unread notifications is returned in the X-Unread-Count header.
+func (r resource) queryHandler(w http.ResponseWriter, req *http.Request) {
+	unread := req.URL.Query().Get("unread") == "true"
+	unreadCount, err := r.service.Count(req.Context(), true)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+	count := unreadCount
+	if !unread {
+		if count, err = r.service.Count(req.Context(), false); err != nil {
+			r.logger.With(req.Context()).Info(err)
+			errors.Write(w, err)
+			return
+		}
+	}
+	pages := pagination.NewFromRequest(req, count)
+	notifications, err := r.service.Query(req.Context(), unread, pages.Offset(), pages.Limit())
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+	pages.Items = notifications
+
+	w.Header().Set("X-Unread-Count", strconv.Itoa(unreadCount))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(pages)
+}
+
+func (r resource) markReadHandler(w http.ResponseWriter, req *http.Request) {
+	if err := r.service.MarkRead(req.Context(), mux.Vars(req)["id"]); err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r resource) markAllReadHandler(w http.ResponseWriter, req *http.Request) {
+	if err := r.service.MarkAllRead(req.Context()); err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r resource) getPreferencesHandler(w http.ResponseWriter, req *http.Request) {
+	preferences, err := r.service.GetPreferences(req.Context())
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(preferences)
+}
+
+func (r resource) updatePreferencesHandler(w http.ResponseWriter, req *http.Request) {
+	var input Preferences
+
+	err := json.NewDecoder(req.Body).Decode(&input)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	preferences, err := r.service.UpdatePreferences(req.Context(), input)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(preferences)
+}
@@ -0,0 +1,170 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	"github.com/ysodiqakanni/trustank-api/pkg/dbcontext"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// ErrDuplicate is returned when a notification is created with the key of an existing one.
+var ErrDuplicate = errors.New("the notification already exists")
+
+// Repository encapsulates the logic to access notifications and preferences from the data source.
+type Repository interface {
+	// Create saves a new notification and returns its ID. ErrDuplicate is returned if its key is taken.
+	Create(ctx context.Context, notification entity.Notification) (primitive.ObjectID, error)
+	// Query returns the notifications of a user, newest first, optionally only the unread ones.
+	Query(ctx context.Context, userId primitive.ObjectID, unread bool, offset, limit int) ([]entity.Notification, error)
+	// Count returns the number of notifications of a user, optionally only the unread ones.
+	Count(ctx context.Context, userId primitive.ObjectID, unread bool) (int, error)
+	// MarkRead marks a notification of a user as read. Marking a read notification again is not an error.
+	MarkRead(ctx context.Context, userId, id primitive.ObjectID, at time.Time) error
+	// MarkAllRead marks all the notifications of a user as read.
+	MarkAllRead(ctx context.Context, userId primitive.ObjectID, at time.Time) error
+	// DigestUsers returns the IDs of the users having notifications waiting for their daily digest.
+	DigestUsers(ctx context.Context) ([]primitive.ObjectID, error)
+	// QueryDigest returns the notifications waiting for the daily digest of a user, oldest first.
+	QueryDigest(ctx context.Context, userId primitive.ObjectID) ([]entity.Notification, error)
+	// ClearDigest removes notifications from the daily digest of their user.
+	ClearDigest(ctx context.Context, ids []primitive.ObjectID) error
+	// GetPreferences returns the preferences of a user. Users without preferences get empty ones.
+	GetPreferences(ctx context.Context, userId primitive.ObjectID) (entity.NotificationPreferences, error)
+	// SavePreferences saves the preferences of a user.
+	SavePreferences(ctx context.Context, preferences entity.NotificationPreferences) error
+}
+
+// repository persists notifications in database
+type repository struct {
+	notifications *mongo.Collection
+	preferences   *mongo.Collection
+	logger        log.Logger
+}
+
+// NewRepository creates a new notification repository.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	r := repository{db.DB().Collection("notifications"), db.DB().Collection("notification_preferences"), logger}
+	r.ensureIndexes()
+	return r
+}
+
+// ensureIndexes creates the indexes required by the repository queries if they do not exist yet.
+func (r repository) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := r.notifications.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.M{"in_digest": 1}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.M{"key": 1}, Options: options.Index().SetUnique(true).SetSparse(true)},
+	})
+	if err != nil {
+		r.logger.Errorf("failed to create notification indexes: %v", err)
+	}
+}
+
+func (r repository) Create(ctx context.Context, notification entity.Notification) (primitive.ObjectID, error) {
+	result, err := r.notifications.InsertOne(ctx, notification)
+	if mongo.IsDuplicateKeyError(err) {
+		return primitive.NilObjectID, ErrDuplicate
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return result.InsertedID.(primitive.ObjectID), nil
+}
+
+func (r repository) Query(ctx context.Context, userId primitive.ObjectID, unread bool, offset, limit int) ([]entity.Notification, error) {
+	opts := options.Find().SetSort(bson.M{"_id": -1}).SetSkip(int64(offset)).SetLimit(int64(limit))
+	cursor, err := r.notifications.Find(ctx, r.filter(userId, unread), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	notifications := []entity.Notification{}
+	err = cursor.All(ctx, &notifications)
+	return notifications, err
+}
+
+func (r repository) Count(ctx context.Context, userId primitive.ObjectID, unread bool) (int, error) {
+	count, err := r.notifications.CountDocuments(ctx, r.filter(userId, unread))
+	return int(count), err
+}
+
+func (r repository) MarkRead(ctx context.Context, userId, id primitive.ObjectID, at time.Time) error {
+	filter := bson.M{"_id": id, "user_id": userId}
+	result, err := r.notifications.UpdateOne(ctx, filter, bson.A{
+		// keep the time of the first read
+		bson.M{"$set": bson.M{"read_at": bson.M{"$ifNull": bson.A{"$read_at", at}}}},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r repository) MarkAllRead(ctx context.Context, userId primitive.ObjectID, at time.Time) error {
+	_, err := r.notifications.UpdateMany(ctx, r.filter(userId, true), bson.M{"$set": bson.M{"read_at": at}})
+	return err
+}
+
+func (r repository) DigestUsers(ctx context.Context) ([]primitive.ObjectID, error) {
+	values, err := r.notifications.Distinct(ctx, "user_id", bson.M{"in_digest": true})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r repository) QueryDigest(ctx context.Context, userId primitive.ObjectID) ([]entity.Notification, error) {
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+	cursor, err := r.notifications.Find(ctx, bson.M{"user_id": userId, "in_digest": true}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var notifications []entity.Notification
+	err = cursor.All(ctx, &notifications)
+	return notifications, err
+}
+
+func (r repository) ClearDigest(ctx context.Context, ids []primitive.ObjectID) error {
+	_, err := r.notifications.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, bson.M{"$unset": bson.M{"in_digest": ""}})
+	return err
+}
+
+func (r repository) GetPreferences(ctx context.Context, userId primitive.ObjectID) (entity.NotificationPreferences, error) {
+	var preferences entity.NotificationPreferences
+	err := r.preferences.FindOne(ctx, bson.M{"_id": userId}).Decode(&preferences)
+	if err == mongo.ErrNoDocuments {
+		return entity.NotificationPreferences{UserID: userId, Email: map[string]string{}}, nil
+	}
+	return preferences, err
+}
+
+func (r repository) SavePreferences(ctx context.Context, preferences entity.NotificationPreferences) error {
+	_, err := r.preferences.ReplaceOne(ctx, bson.M{"_id": preferences.UserID}, preferences, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r repository) filter(userId primitive.ObjectID, unread bool) bson.M {
+	filter := bson.M{"user_id": userId}
+	if unread {
+		filter["read_at"] = bson.M{"$exists": false}
+	}
+	return filter
+}
@@ -0,0 +1,377 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/ysodiqakanni/trustank-api/internal/auth"
+	"github.com/ysodiqakanni/trustank-api/internal/business"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	apperrors "github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/pkg/events"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/mailer"
+	"github.com/ysodiqakanni/trustank-api/pkg/tracing"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+// Notification types.
+const (
+	// TypeBusinessRegistered welcomes the owner of a new business.
+	TypeBusinessRegistered = business.EventRegistered
+	// TypeReviewCreated tells the owner of a business about a new review.
+	TypeReviewCreated = "review.created"
+	// TypeReviewReplied tells a reviewer that the business replied to their review.
+	TypeReviewReplied = "review.replied"
+	// TypeReviewModerated tells a reviewer that a moderator acted on their review.
+	TypeReviewModerated = "review.moderated"
+)
+
+// JobDigest is the type of the job sending the daily digests.
+const JobDigest = "notification.digest"
+
+// defaultEmail tells how each type of notification is emailed to users who did not choose.
+var defaultEmail = map[string]string{
+	TypeBusinessRegistered: entity.EmailInstant,
+	TypeReviewCreated:      entity.EmailInstant,
+	TypeReviewReplied:      entity.EmailInstant,
+	TypeReviewModerated:    entity.EmailInstant,
+}
+
+// Service encapsulates use case logic for notifications. All methods but Notify, HandleEvent and SendDigests are
+// scoped to the current user.
+type Service interface {
+	// Notify creates a notification and emails it according to the preferences of its user. Notifying again
+	// with the key of an existing notification does nothing.
+	Notify(ctx context.Context, req NotifyRequest) error
+	// Query returns the notifications, newest first, optionally only the unread ones.
+	Query(ctx context.Context, unread bool, offset, limit int) ([]Notification, error)
+	// Count returns the number of notifications, optionally only the unread ones.
+	Count(ctx context.Context, unread bool) (int, error)
+	// MarkRead marks a notification as read.
+	MarkRead(ctx context.Context, id string) error
+	// MarkAllRead marks all the notifications as read.
+	MarkAllRead(ctx context.Context) error
+	// GetPreferences returns how each type of notification is emailed.
+	GetPreferences(ctx context.Context) (Preferences, error)
+	// UpdatePreferences changes how some types of notification are emailed.
+	UpdatePreferences(ctx context.Context, req Preferences) (Preferences, error)
+	// HandleEvent notifies the users concerned by a domain event.
+	HandleEvent(ctx context.Context, record events.Record) error
+	// SendDigests emails their daily digest to the users having notifications waiting for it.
+	SendDigests(ctx context.Context) error
+}
+
+// Users gives access to the recipients of notifications.
+type Users interface {
+	Get(ctx context.Context, id primitive.ObjectID) (entity.User, error)
+}
+
+// Notification represents a notification.
+type Notification struct {
+	entity.Notification
+}
+
+// NotifyRequest represents a notification to create.
+type NotifyRequest struct {
+	UserID primitive.ObjectID
+	Type   string
+	Title  string
+	Body   string
+	// Link is the path in the web application showing what the notification is about.
+	Link string
+	// Key optionally identifies the event the notification is about.
+	Key string
+}
+
+// Preferences tells how each type of notification is emailed: "instant", "daily" or "off".
+type Preferences struct {
+	Email map[string]string `json:"email"`
+}
+
+// Validate validates the Preferences fields.
+func (m Preferences) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Email, validation.Required, validation.By(validEmailPreferences)),
+	)
+}
+
+func validEmailPreferences(value interface{}) error {
+	email, _ := value.(map[string]string)
+	for t, delivery := range email {
+		if _, ok := defaultEmail[t]; !ok {
+			return fmt.Errorf("%q is not a notification type", t)
+		}
+		if delivery != entity.EmailInstant && delivery != entity.EmailDaily && delivery != entity.EmailOff {
+			return fmt.Errorf("%q must be instant, daily or off", t)
+		}
+	}
+	return nil
+}
+
+type service struct {
+	repo      Repository
+	users     Users
+	mailer    mailer.Mailer
+	templates *mailer.Templates
+	baseURL   string
+	logger    log.Logger
+}
+
+// NewService creates a new notification service. Emails are rendered from the "notification" and "digest"
+// templates, with links starting with baseURL, the address of the web application.
+func NewService(repo Repository, users Users, mailer mailer.Mailer, templates *mailer.Templates, baseURL string, logger log.Logger) Service {
+	return service{repo, users, mailer, templates, strings.TrimSuffix(baseURL, "/"), logger}
+}
+
+func (s service) Notify(ctx context.Context, req NotifyRequest) error {
+	ctx, span := tracing.Start(ctx, "notification.Notify")
+	defer span.End()
+	preferences, err := s.repo.GetPreferences(ctx, req.UserID)
+	if err != nil {
+		return err
+	}
+	delivery := resolve(preferences.Email)[req.Type]
+	notification := entity.Notification{
+		UserID:    req.UserID,
+		Type:      req.Type,
+		Title:     req.Title,
+		Body:      req.Body,
+		Link:      req.Link,
+		Key:       req.Key,
+		CreatedAt: time.Now(),
+		InDigest:  delivery == entity.EmailDaily,
+	}
+	notification.ID, err = s.repo.Create(ctx, notification)
+	if err == ErrDuplicate {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if delivery == entity.EmailInstant {
+		// the notification is in the app anyway, so a failure to email it is only logged
+		if err := s.email(ctx, notification); err != nil {
+			s.logger.With(ctx).Errorf("failed to email notification %s: %s", notification.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+func (s service) Query(ctx context.Context, unread bool, offset, limit int) ([]Notification, error) {
+	ctx, span := tracing.Start(ctx, "notification.Query")
+	defer span.End()
+	userId, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.repo.Query(ctx, userId, unread, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Notification{}
+	for _, item := range items {
+		result = append(result, Notification{item})
+	}
+	return result, nil
+}
+
+func (s service) Count(ctx context.Context, unread bool) (int, error) {
+	ctx, span := tracing.Start(ctx, "notification.Count")
+	defer span.End()
+	userId, err := currentUser(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.repo.Count(ctx, userId, unread)
+}
+
+func (s service) MarkRead(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "notification.MarkRead")
+	defer span.End()
+	userId, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return apperrors.NotFound("")
+	}
+	return s.repo.MarkRead(ctx, userId, objectId, time.Now())
+}
+
+func (s service) MarkAllRead(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "notification.MarkAllRead")
+	defer span.End()
+	userId, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+	return s.repo.MarkAllRead(ctx, userId, time.Now())
+}
+
+func (s service) GetPreferences(ctx context.Context) (Preferences, error) {
+	ctx, span := tracing.Start(ctx, "notification.GetPreferences")
+	defer span.End()
+	userId, err := currentUser(ctx)
+	if err != nil {
+		return Preferences{}, err
+	}
+	preferences, err := s.repo.GetPreferences(ctx, userId)
+	if err != nil {
+		return Preferences{}, err
+	}
+	return Preferences{resolve(preferences.Email)}, nil
+}
+
+func (s service) UpdatePreferences(ctx context.Context, req Preferences) (Preferences, error) {
+	ctx, span := tracing.Start(ctx, "notification.UpdatePreferences")
+	defer span.End()
+	if err := req.Validate(); err != nil {
+		return Preferences{}, err
+	}
+	userId, err := currentUser(ctx)
+	if err != nil {
+		return Preferences{}, err
+	}
+	preferences, err := s.repo.GetPreferences(ctx, userId)
+	if err != nil {
+		return Preferences{}, err
+	}
+	if preferences.Email == nil {
+		preferences.Email = map[string]string{}
+	}
+	for t, delivery := range req.Email {
+		preferences.Email[t] = delivery
+	}
+	if err := s.repo.SavePreferences(ctx, preferences); err != nil {
+		return Preferences{}, err
+	}
+	return Preferences{resolve(preferences.Email)}, nil
+}
+
+func (s service) HandleEvent(ctx context.Context, record events.Record) error {
+	ctx, span := tracing.Start(ctx, "notification.HandleEvent")
+	defer span.End()
+	switch record.Type {
+	case business.EventRegistered:
+		var event business.Registered
+		if err := record.Decode(&event); err != nil {
+			return err
+		}
+		ownerId, err := primitive.ObjectIDFromHex(event.OwnerID)
+		if err != nil {
+			return err
+		}
+		return s.Notify(ctx, NotifyRequest{
+			UserID: ownerId,
+			Type:   TypeBusinessRegistered,
+			Title:  fmt.Sprintf("Welcome to Trustank, %s", event.Name),
+			Body:   "Your business profile is ready. Invite your customers to review you and reply to their reviews.",
+			Link:   "/businesses/" + event.BusinessID,
+			Key:    record.ID.Hex(),
+		})
+	}
+	return nil
+}
+
+func (s service) SendDigests(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "notification.SendDigests")
+	defer span.End()
+	userIds, err := s.repo.DigestUsers(ctx)
+	if err != nil {
+		return err
+	}
+	// a failure for a user does not prevent the others from receiving their digest, and is retried with the job
+	var failed error
+	for _, userId := range userIds {
+		if err := s.sendDigest(ctx, userId); err != nil {
+			s.logger.With(ctx).Errorf("failed to send the digest of user %s: %s", userId.Hex(), err)
+			failed = err
+		}
+	}
+	return failed
+}
+
+// sendDigest emails a user the notifications waiting for their digest.
+func (s service) sendDigest(ctx context.Context, userId primitive.ObjectID) error {
+	notifications, err := s.repo.QueryDigest(ctx, userId)
+	if err != nil || len(notifications) == 0 {
+		return err
+	}
+	user, err := s.users.Get(ctx, userId)
+	if err != nil {
+		return err
+	}
+	items := make([]map[string]interface{}, len(notifications))
+	ids := make([]primitive.ObjectID, len(notifications))
+	for i, notification := range notifications {
+		items[i] = s.data(notification)
+		ids[i] = notification.ID
+	}
+	msg, err := s.templates.Render("", "digest", map[string]interface{}{
+		"Name":          user.Name,
+		"Notifications": items,
+		"SettingsURL":   s.baseURL + "/settings/notifications",
+	})
+	if err != nil {
+		return err
+	}
+	msg.To = user.Email
+	if err := s.mailer.Send(ctx, msg); err != nil && err != mailer.ErrSuppressed {
+		return err
+	}
+	return s.repo.ClearDigest(ctx, ids)
+}
+
+// email sends a notification to its user.
+func (s service) email(ctx context.Context, notification entity.Notification) error {
+	user, err := s.users.Get(ctx, notification.UserID)
+	if err != nil {
+		return err
+	}
+	data := s.data(notification)
+	data["Name"] = user.Name
+	data["SettingsURL"] = s.baseURL + "/settings/notifications"
+	msg, err := s.templates.Render("", "notification", data)
+	if err != nil {
+		return err
+	}
+	msg.To = user.Email
+	if err := s.mailer.Send(ctx, msg); err != nil && err != mailer.ErrSuppressed {
+		return err
+	}
+	return nil
+}
+
+// data returns the template data of a notification.
+func (s service) data(notification entity.Notification) map[string]interface{} {
+	data := map[string]interface{}{"Title": notification.Title, "Body": notification.Body, "URL": ""}
+	if notification.Link != "" {
+		data["URL"] = s.baseURL + notification.Link
+	}
+	return data
+}
+
+// resolve returns the email delivery of every notification type, using the defaults for the missing ones.
+func resolve(email map[string]string) map[string]string {
+	result := map[string]string{}
+	for t, delivery := range defaultEmail {
+		result[t] = delivery
+		if chosen, ok := email[t]; ok {
+			result[t] = chosen
+		}
+	}
+	return result
+}
+
+// currentUser returns the ID of the authenticated user.
+func currentUser(ctx context.Context) (primitive.ObjectID, error) {
+	userId, ok := auth.CurrentUserID(ctx)
+	if !ok {
+		return primitive.NilObjectID, apperrors.Unauthorized("")
+	}
+	return userId, nil
+}
@@ -0,0 +1,254 @@
+package notification
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysodiqakanni/trustank-api/internal/business"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	apperrors "github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/pkg/events"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/mailer"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mockRepository struct {
+	sync.Mutex
+	items       map[primitive.ObjectID]entity.Notification
+	preferences map[primitive.ObjectID]entity.NotificationPreferences
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{
+		items:       map[primitive.ObjectID]entity.Notification{},
+		preferences: map[primitive.ObjectID]entity.NotificationPreferences{},
+	}
+}
+
+func (m *mockRepository) Create(ctx context.Context, notification entity.Notification) (primitive.ObjectID, error) {
+	m.Lock()
+	defer m.Unlock()
+	for _, item := range m.items {
+		if notification.Key != "" && item.Key == notification.Key {
+			return primitive.NilObjectID, ErrDuplicate
+		}
+	}
+	notification.ID = primitive.NewObjectID()
+	m.items[notification.ID] = notification
+	return notification.ID, nil
+}
+
+func (m *mockRepository) Query(ctx context.Context, userId primitive.ObjectID, unread bool, offset, limit int) ([]entity.Notification, error) {
+	m.Lock()
+	defer m.Unlock()
+	var result []entity.Notification
+	for _, item := range m.items {
+		if item.UserID == userId && (!unread || item.ReadAt == nil) {
+			result = append(result, item)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID.Hex() > result[j].ID.Hex() })
+	return result, nil
+}
+
+func (m *mockRepository) Count(ctx context.Context, userId primitive.ObjectID, unread bool) (int, error) {
+	items, _ := m.Query(ctx, userId, unread, 0, 0)
+	return len(items), nil
+}
+
+func (m *mockRepository) MarkRead(ctx context.Context, userId, id primitive.ObjectID, at time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	item, ok := m.items[id]
+	if !ok || item.UserID != userId {
+		return mongo.ErrNoDocuments
+	}
+	if item.ReadAt == nil {
+		item.ReadAt = &at
+	}
+	m.items[id] = item
+	return nil
+}
+
+func (m *mockRepository) MarkAllRead(ctx context.Context, userId primitive.ObjectID, at time.Time) error {
+	items, _ := m.Query(ctx, userId, true, 0, 0)
+	for _, item := range items {
+		m.MarkRead(ctx, userId, item.ID, at)
+	}
+	return nil
+}
+
+func (m *mockRepository) DigestUsers(ctx context.Context) ([]primitive.ObjectID, error) {
+	m.Lock()
+	defer m.Unlock()
+	seen := map[primitive.ObjectID]bool{}
+	var result []primitive.ObjectID
+	for _, item := range m.items {
+		if item.InDigest && !seen[item.UserID] {
+			seen[item.UserID] = true
+			result = append(result, item.UserID)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockRepository) QueryDigest(ctx context.Context, userId primitive.ObjectID) ([]entity.Notification, error) {
+	items, _ := m.Query(ctx, userId, false, 0, 0)
+	var result []entity.Notification
+	for i := len(items) - 1; i >= 0; i-- {
+		if items[i].InDigest {
+			result = append(result, items[i])
+		}
+	}
+	return result, nil
+}
+
+func (m *mockRepository) ClearDigest(ctx context.Context, ids []primitive.ObjectID) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, id := range ids {
+		item := m.items[id]
+		item.InDigest = false
+		m.items[id] = item
+	}
+	return nil
+}
+
+func (m *mockRepository) GetPreferences(ctx context.Context, userId primitive.ObjectID) (entity.NotificationPreferences, error) {
+	m.Lock()
+	defer m.Unlock()
+	if preferences, ok := m.preferences[userId]; ok {
+		return preferences, nil
+	}
+	return entity.NotificationPreferences{UserID: userId, Email: map[string]string{}}, nil
+}
+
+func (m *mockRepository) SavePreferences(ctx context.Context, preferences entity.NotificationPreferences) error {
+	m.Lock()
+	defer m.Unlock()
+	m.preferences[preferences.UserID] = preferences
+	return nil
+}
+
+type mockUsers map[primitive.ObjectID]entity.User
+
+func (m mockUsers) Get(ctx context.Context, id primitive.ObjectID) (entity.User, error) {
+	if user, ok := m[id]; ok {
+		return user, nil
+	}
+	return entity.User{}, mongo.ErrNoDocuments
+}
+
+type mockMailer struct {
+	sent []mailer.Message
+}
+
+func (m *mockMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func newTestService(t *testing.T) (Service, *mockRepository, *mockMailer, entity.User) {
+	logger, _ := log.NewForTest()
+	templates, err := mailer.LoadTemplates("../../templates/mail", "en")
+	assert.Nil(t, err)
+	user := entity.User{ID: primitive.NewObjectID(), Name: "Jane", Email: "jane@example.com"}
+	repo, mail := newMockRepository(), &mockMailer{}
+	return NewService(repo, mockUsers{user.ID: user}, mail, templates, "http://app.test/", logger), repo, mail, user
+}
+
+// as returns a context authenticated as the given user.
+func as(user entity.User) context.Context {
+	return context.WithValue(context.Background(), "id", user.ID.Hex())
+}
+
+func Test_service(t *testing.T) {
+	s, _, mail, user := newTestService(t)
+	ctx := as(user)
+
+	_, err := s.Query(context.Background(), false, 0, 10)
+	assert.Equal(t, apperrors.Unauthorized(""), err)
+
+	assert.Nil(t, s.Notify(ctx, NotifyRequest{UserID: user.ID, Type: TypeReviewReplied, Title: "Bukka Hut replied to your review", Body: "Thanks!", Link: "/reviews/1"}))
+	assert.Nil(t, s.Notify(ctx, NotifyRequest{UserID: user.ID, Type: TypeReviewModerated, Title: "Your review was published", Key: "event-1"}))
+	assert.Nil(t, s.Notify(ctx, NotifyRequest{UserID: user.ID, Type: TypeReviewModerated, Title: "Your review was published", Key: "event-1"}))
+	if assert.Len(t, mail.sent, 2) {
+		assert.Equal(t, "jane@example.com", mail.sent[0].To)
+		assert.Equal(t, "Bukka Hut replied to your review", mail.sent[0].Subject)
+		assert.Contains(t, mail.sent[0].Text, "http://app.test/reviews/1")
+	}
+
+	count, _ := s.Count(ctx, true)
+	assert.Equal(t, 2, count)
+	items, _ := s.Query(ctx, false, 0, 10)
+	if assert.Len(t, items, 2) {
+		assert.Nil(t, s.MarkRead(ctx, items[0].ID.Hex()))
+	}
+	assert.Equal(t, apperrors.NotFound(""), s.MarkRead(ctx, "missing"))
+	assert.Equal(t, mongo.ErrNoDocuments, s.MarkRead(as(entity.User{ID: primitive.NewObjectID()}), items[1].ID.Hex()))
+	count, _ = s.Count(ctx, true)
+	assert.Equal(t, 1, count)
+	assert.Nil(t, s.MarkAllRead(ctx))
+	count, _ = s.Count(ctx, true)
+	assert.Equal(t, 0, count)
+}
+
+func Test_service_Preferences(t *testing.T) {
+	s, _, mail, user := newTestService(t)
+	ctx := as(user)
+
+	preferences, err := s.GetPreferences(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.EmailInstant, preferences.Email[TypeReviewReplied])
+
+	_, err = s.UpdatePreferences(ctx, Preferences{Email: map[string]string{"unknown": entity.EmailOff}})
+	assert.NotNil(t, err)
+	_, err = s.UpdatePreferences(ctx, Preferences{Email: map[string]string{TypeReviewReplied: "weekly"}})
+	assert.NotNil(t, err)
+	preferences, err = s.UpdatePreferences(ctx, Preferences{Email: map[string]string{
+		TypeReviewReplied:   entity.EmailDaily,
+		TypeReviewModerated: entity.EmailOff,
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.EmailDaily, preferences.Email[TypeReviewReplied])
+	assert.Equal(t, entity.EmailInstant, preferences.Email[TypeReviewCreated])
+
+	// notifications are still shown in the app, but only emailed in the digest or not at all
+	s.Notify(ctx, NotifyRequest{UserID: user.ID, Type: TypeReviewModerated, Title: "Your review was published"})
+	s.Notify(ctx, NotifyRequest{UserID: user.ID, Type: TypeReviewReplied, Title: "Bukka Hut replied", Link: "/reviews/1"})
+	s.Notify(ctx, NotifyRequest{UserID: user.ID, Type: TypeReviewReplied, Title: "Mama Put replied", Link: "/reviews/2"})
+	assert.Empty(t, mail.sent)
+	count, _ := s.Count(ctx, true)
+	assert.Equal(t, 3, count)
+
+	assert.Nil(t, s.SendDigests(context.Background()))
+	if assert.Len(t, mail.sent, 1) {
+		assert.Equal(t, "Your Trustank digest: 2 new notifications", mail.sent[0].Subject)
+		assert.Contains(t, mail.sent[0].Text, "* Bukka Hut replied")
+		assert.Contains(t, mail.sent[0].Text, "http://app.test/reviews/2")
+	}
+	// the digest is only sent once
+	assert.Nil(t, s.SendDigests(context.Background()))
+	assert.Len(t, mail.sent, 1)
+}
+
+func Test_service_HandleEvent(t *testing.T) {
+	s, _, mail, user := newTestService(t)
+	record, err := events.NewRecord(business.Registered{BusinessID: primitive.NewObjectID().Hex(), OwnerID: user.ID.Hex(), Name: "Bukka Hut"})
+	assert.Nil(t, err)
+
+	// events are delivered at least once, but notified once
+	assert.Nil(t, s.HandleEvent(context.Background(), record))
+	assert.Nil(t, s.HandleEvent(context.Background(), record))
+	count, _ := s.Count(as(user), false)
+	assert.Equal(t, 1, count)
+	if assert.Len(t, mail.sent, 1) {
+		assert.Equal(t, "Welcome to Trustank, Bukka Hut", mail.sent[0].Subject)
+	}
+}
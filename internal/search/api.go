@@ -0,0 +1,57 @@
+package search
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/pagination"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RegisterHandlers registers handlers for different HTTP requests.
+func RegisterHandlers(r *mux.Router, service Service, logger log.Logger) {
+	res := resource{service, logger}
+	r.HandleFunc("/api/v1/search", res.searchHandler).Methods("GET")
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// search businesses and categories: ?q=&type=businesses,categories&page=&per_page=
+func (r resource) searchHandler(w http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+	query := Query{
+		Text:    params.Get("q"),
+		Page:    parseInt(params.Get(pagination.PageVar), 1),
+		PerPage: parseInt(params.Get(pagination.PageSizeVar), 20),
+	}
+	for _, value := range params["type"] {
+		for _, t := range strings.Split(value, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				query.Types = append(query.Types, t)
+			}
+		}
+	}
+
+	result, err := r.service.Search(req.Context(), query)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+func parseInt(value string, defaultValue int) int {
+	if result, err := strconv.Atoi(value); err == nil {
+		return result
+	}
+	return defaultValue
+}
@@ -0,0 +1,91 @@
+package search
+
+import (
+	"context"
+	"github.com/ysodiqakanni/trustank-api/pkg/dbcontext"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository encapsulates the full-text queries against the searchable collections.
+// The text indexes are created by the repositories owning the collections.
+type Repository interface {
+	// SearchBusinesses returns the businesses matching the text query, most relevant first, and the total number of matches.
+	SearchBusinesses(ctx context.Context, text string, offset, limit int) ([]Hit, int, error)
+	// SearchCategories returns the categories matching the text query, most relevant first, and the total number of matches.
+	SearchCategories(ctx context.Context, text string, offset, limit int) ([]Hit, int, error)
+}
+
+// repository runs text searches in the database
+type repository struct {
+	businesses *mongo.Collection
+	categories *mongo.Collection
+	logger     log.Logger
+}
+
+// NewRepository creates a new search repository.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{
+		businesses: db.DB().Collection("businesses"),
+		categories: db.DB().Collection("business_categories"),
+		logger:     logger,
+	}
+}
+
+// document holds the fields shared by all searchable documents.
+type document struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Name        string             `bson:"name"`
+	Description string             `bson:"description"`
+	IconUrl     string             `bson:"iconUrl"`
+	Score       float64            `bson:"score"`
+}
+
+func (r repository) SearchBusinesses(ctx context.Context, text string, offset, limit int) ([]Hit, int, error) {
+	// businesses held for moderation are not listed
+	filter := bson.M{"$text": bson.M{"$search": text}, "moderation": nil}
+	return r.search(ctx, r.businesses, filter, offset, limit)
+}
+
+func (r repository) SearchCategories(ctx context.Context, text string, offset, limit int) ([]Hit, int, error) {
+	filter := bson.M{"$text": bson.M{"$search": text}, "isdeleted": bson.M{"$ne": true}}
+	return r.search(ctx, r.categories, filter, offset, limit)
+}
+
+func (r repository) search(ctx context.Context, collection *mongo.Collection, filter bson.M, offset, limit int) ([]Hit, int, error) {
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	score := bson.M{"$meta": "textScore"}
+	opts := options.Find().
+		SetProjection(bson.M{"name": 1, "description": 1, "iconUrl": 1, "score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []document
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, 0, err
+	}
+	hits := make([]Hit, 0, len(docs))
+	for _, doc := range docs {
+		hits = append(hits, Hit{
+			ID:          doc.ID,
+			Name:        doc.Name,
+			Description: doc.Description,
+			IconUrl:     doc.IconUrl,
+			Score:       doc.Score,
+		})
+	}
+	return hits, int(total), nil
+}
@@ -0,0 +1,128 @@
+package search
+
+import (
+	"context"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/ysodiqakanni/trustank-api/pkg/highlight"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/pagination"
+	"github.com/ysodiqakanni/trustank-api/pkg/tracing"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+)
+
+const (
+	// TypeBusiness and TypeCategory name the sections of the search results.
+	TypeBusiness = "businesses"
+	TypeCategory = "categories"
+
+	// snippetLength is the approximate length of the highlighted description snippets.
+	snippetLength = 160
+)
+
+// Service encapsulates the full-text search use cases.
+type Service interface {
+	// Search runs the query against every requested section. All sections are searched if none is given.
+	Search(ctx context.Context, query Query) (Result, error)
+}
+
+// Query represents a full-text search request.
+type Query struct {
+	Text    string
+	Types   []string
+	Page    int
+	PerPage int
+}
+
+// Validate validates the Query fields.
+func (m Query) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Text, validation.Required, validation.Length(1, 100)),
+		validation.Field(&m.Types, validation.Each(validation.In(TypeBusiness, TypeCategory))),
+	)
+}
+
+// Hit represents a document matching a search.
+type Hit struct {
+	ID          primitive.ObjectID `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	IconUrl     string             `json:"iconUrl,omitempty"`
+	// Score is the relevance of the document reported by the text index.
+	Score float64 `json:"score"`
+	// Highlights holds HTML-escaped snippets of the matching fields with the matched words wrapped in <mark> tags.
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// Result represents the paginated hits of every searched section.
+type Result struct {
+	Query    string                       `json:"query"`
+	Sections map[string]*pagination.Pages `json:"sections"`
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// NewService creates a new search service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// Search runs the query against every requested section.
+func (s service) Search(ctx context.Context, query Query) (Result, error) {
+	ctx, span := tracing.Start(ctx, "search.Search")
+	defer span.End()
+	query.Text = strings.TrimSpace(query.Text)
+	if err := query.Validate(); err != nil {
+		return Result{}, err
+	}
+	// only plain words reach the text index: quotes and negations in user input are not interpreted
+	terms := highlight.Terms(query.Text)
+	result := Result{Query: query.Text, Sections: map[string]*pagination.Pages{}}
+	if len(terms) == 0 {
+		return result, nil
+	}
+	text := strings.Join(terms, " ")
+
+	types := query.Types
+	if len(types) == 0 {
+		types = []string{TypeBusiness, TypeCategory}
+	}
+	for _, t := range types {
+		search := s.repo.SearchBusinesses
+		if t == TypeCategory {
+			search = s.repo.SearchCategories
+		}
+		// the total is only known once the section has been searched
+		pages := pagination.New(query.Page, query.PerPage, -1)
+		hits, total, err := search(ctx, text, pages.Offset(), pages.Limit())
+		if err != nil {
+			return Result{}, err
+		}
+		for i := range hits {
+			hits[i].Highlights = highlightHit(hits[i], terms)
+		}
+		pages.TotalCount = total
+		pages.PageCount = (total + pages.PerPage - 1) / pages.PerPage
+		pages.Items = hits
+		result.Sections[t] = pages
+	}
+	return result, nil
+}
+
+// highlightHit returns the highlighted snippets of the hit fields matching the terms.
+func highlightHit(hit Hit, terms []string) map[string]string {
+	highlights := map[string]string{}
+	if snippet, ok := highlight.Snippet(hit.Name, terms, snippetLength); ok {
+		highlights["name"] = snippet
+	}
+	if snippet, ok := highlight.Snippet(hit.Description, terms, snippetLength); ok {
+		highlights["description"] = snippet
+	}
+	if len(highlights) == 0 {
+		return nil
+	}
+	return highlights
+}
@@ -0,0 +1,64 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/pagination"
+)
+
+var errCRUD = errors.New("error crud")
+
+type mockRepository struct {
+	texts []string
+}
+
+func (m *mockRepository) SearchBusinesses(ctx context.Context, text string, offset, limit int) ([]Hit, int, error) {
+	m.texts = append(m.texts, text)
+	if text == "error" {
+		return nil, 0, errCRUD
+	}
+	return []Hit{{Name: "Mama's Bakery", Description: "Fresh bread every morning", Score: 2}}, 21, nil
+}
+
+func (m *mockRepository) SearchCategories(ctx context.Context, text string, offset, limit int) ([]Hit, int, error) {
+	m.texts = append(m.texts, text)
+	return []Hit{{Name: "Bakeries", Score: 1}}, 1, nil
+}
+
+func Test_service_Search(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, logger)
+
+	result, err := s.Search(context.Background(), Query{Text: ` Bakery ".*" -bread `, PerPage: 10, Page: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bakery bread", "bakery bread"}, repo.texts)
+	if assert.Len(t, result.Sections, 2) {
+		businesses := result.Sections[TypeBusiness]
+		assert.Equal(t, 2, businesses.Page)
+		assert.Equal(t, 21, businesses.TotalCount)
+		assert.Equal(t, 3, businesses.PageCount)
+		hits := businesses.Items.([]Hit)
+		assert.Equal(t, map[string]string{
+			"name":        "Mama&#39;s <mark>Bakery</mark>",
+			"description": "Fresh <mark>bread</mark> every morning",
+		}, hits[0].Highlights)
+		assert.Equal(t, 1, result.Sections[TypeCategory].TotalCount)
+	}
+
+	result, err = s.Search(context.Background(), Query{Text: "bakery", Types: []string{TypeCategory}})
+	assert.Nil(t, err)
+	assert.Len(t, result.Sections, 1)
+	assert.Equal(t, pagination.DefaultPageSize, result.Sections[TypeCategory].PerPage)
+
+	_, err = s.Search(context.Background(), Query{Text: "  "})
+	assert.NotNil(t, err)
+	_, err = s.Search(context.Background(), Query{Text: "bakery", Types: []string{"users"}})
+	assert.NotNil(t, err)
+	_, err = s.Search(context.Background(), Query{Text: "error"})
+	assert.Equal(t, errCRUD, err)
+}
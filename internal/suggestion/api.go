@@ -0,0 +1,31 @@
+package suggestion
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"net/http"
+	"strconv"
+)
+
+// RegisterHandlers registers handlers for different HTTP requests.
+func RegisterHandlers(r *mux.Router, service Service, logger log.Logger) {
+	res := resource{service, logger}
+	r.HandleFunc("/api/v1/suggest", res.suggestHandler).Methods("GET")
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// suggest businesses and categories as the user types: ?prefix=&limit=
+func (r resource) suggestHandler(w http.ResponseWriter, req *http.Request) {
+	limit, _ := strconv.Atoi(req.URL.Query().Get("limit"))
+	suggestions := r.service.Suggest(req.Context(), req.URL.Query().Get("prefix"), limit)
+
+	// suggestions change slowly, so browsers may reuse them for a short while
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(suggestions)
+}
@@ -0,0 +1,116 @@
+package suggestion
+
+import (
+	"context"
+	"github.com/ysodiqakanni/trustank-api/pkg/dbcontext"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/suggest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository loads the suggestible items from the data source.
+type Repository interface {
+	// LoadBusinesses returns a suggestion entry for every business that is not held for moderation.
+	LoadBusinesses(ctx context.Context) ([]suggest.Entry, error)
+	// LoadCategories returns a suggestion entry for every category that is not deleted,
+	// with the number of businesses in the category as its popularity.
+	LoadCategories(ctx context.Context) ([]suggest.Entry, error)
+}
+
+// repository reads businesses and categories from the database
+type repository struct {
+	businesses *mongo.Collection
+	categories *mongo.Collection
+	logger     log.Logger
+}
+
+// NewRepository creates a new suggestion repository.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{
+		businesses: db.DB().Collection("businesses"),
+		categories: db.DB().Collection("business_categories"),
+		logger:     logger,
+	}
+}
+
+type namedDocument struct {
+	ID   primitive.ObjectID `bson:"_id"`
+	Name string             `bson:"name"`
+}
+
+func (r repository) LoadBusinesses(ctx context.Context) ([]suggest.Entry, error) {
+	filter := bson.M{"moderation": nil}
+	cursor, err := r.businesses.Find(ctx, filter, options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var entries []suggest.Entry
+	for cursor.Next(ctx) {
+		var doc namedDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		// businesses have no popularity signal yet: they are ranked alphabetically
+		entries = append(entries, suggest.Entry{Type: TypeBusiness, ID: doc.ID.Hex(), Name: doc.Name})
+	}
+	return entries, cursor.Err()
+}
+
+func (r repository) LoadCategories(ctx context.Context) ([]suggest.Entry, error) {
+	counts, err := r.countBusinessesByCategory(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"isdeleted": bson.M{"$ne": true}}
+	cursor, err := r.categories.Find(ctx, filter, options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var entries []suggest.Entry
+	for cursor.Next(ctx) {
+		var doc namedDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		entries = append(entries, suggest.Entry{
+			Type:       TypeCategory,
+			ID:         doc.ID.Hex(),
+			Name:       doc.Name,
+			Popularity: float64(counts[doc.ID]),
+		})
+	}
+	return entries, cursor.Err()
+}
+
+// countBusinessesByCategory returns the number of businesses in each category.
+func (r repository) countBusinessesByCategory(ctx context.Context) (map[primitive.ObjectID]int, error) {
+	pipeline := []bson.M{
+		{"$group": bson.M{"_id": "$category_id", "count": bson.M{"$sum": 1}}},
+	}
+	cursor, err := r.businesses.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int                `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	counts := make(map[primitive.ObjectID]int, len(groups))
+	for _, g := range groups {
+		counts[g.ID] = g.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,128 @@
+package suggestion
+
+import (
+	"context"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/suggest"
+	"github.com/ysodiqakanni/trustank-api/pkg/tracing"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	// TypeBusiness and TypeCategory are the types of the suggested items.
+	TypeBusiness = "business"
+	TypeCategory = "category"
+
+	// DefaultLimit and MaxLimit bound the number of suggestions returned per type.
+	DefaultLimit = 5
+	MaxLimit     = 20
+)
+
+// Updater keeps the suggestions up to date when businesses and categories change,
+// without waiting for the next full rebuild of the index.
+type Updater interface {
+	BusinessChanged(business entity.Business)
+	CategoryChanged(category entity.BusinessCategory)
+	CategoryRemoved(id primitive.ObjectID)
+}
+
+// Service encapsulates the autocomplete use cases.
+type Service interface {
+	Updater
+	// Suggest returns the most popular businesses and categories whose names have a word starting with the prefix.
+	Suggest(ctx context.Context, prefix string, limit int) Suggestions
+	// Refresh rebuilds the whole index from the data source.
+	Refresh(ctx context.Context) error
+	// Run refreshes the index immediately and then at every interval until the context is canceled.
+	Run(ctx context.Context, interval time.Duration)
+}
+
+// Suggestions represents the suggestions for a prefix.
+type Suggestions struct {
+	Prefix     string          `json:"prefix"`
+	Businesses []suggest.Entry `json:"businesses"`
+	Categories []suggest.Entry `json:"categories"`
+}
+
+type service struct {
+	repo   Repository
+	index  *suggest.Index
+	logger log.Logger
+}
+
+// NewService creates a new suggestion service serving suggestions from an in-memory index.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, suggest.NewIndex(), logger}
+}
+
+func (s service) Suggest(ctx context.Context, prefix string, limit int) Suggestions {
+	ctx, span := tracing.Start(ctx, "suggestion.Suggest")
+	defer span.End()
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	return Suggestions{
+		Prefix:     prefix,
+		Businesses: s.index.Search(TypeBusiness, prefix, limit),
+		Categories: s.index.Search(TypeCategory, prefix, limit),
+	}
+}
+
+func (s service) Refresh(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "suggestion.Refresh")
+	defer span.End()
+	// changes made while the data source is read are replayed on top of what is read
+	rebuild := s.index.Rebuild()
+	defer rebuild.Abort()
+	businesses, err := s.repo.LoadBusinesses(ctx)
+	if err != nil {
+		return err
+	}
+	categories, err := s.repo.LoadCategories(ctx)
+	if err != nil {
+		return err
+	}
+	rebuild.Commit(append(businesses, categories...))
+	s.logger.With(ctx).Infof("suggestion index rebuilt with %d businesses and %d categories", len(businesses), len(categories))
+	return nil
+}
+
+func (s service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Refresh(ctx); err != nil {
+			s.logger.With(ctx).Errorf("failed to rebuild the suggestion index: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s service) BusinessChanged(business entity.Business) {
+	if business.Moderation != nil {
+		s.index.Remove(TypeBusiness, business.ID.Hex())
+		return
+	}
+	s.index.Upsert(suggest.Entry{Type: TypeBusiness, ID: business.ID.Hex(), Name: business.Name})
+}
+
+func (s service) CategoryChanged(category entity.BusinessCategory) {
+	if category.IsDeleted {
+		s.CategoryRemoved(category.ID)
+		return
+	}
+	s.index.Upsert(suggest.Entry{Type: TypeCategory, ID: category.ID.Hex(), Name: category.Name})
+}
+
+func (s service) CategoryRemoved(id primitive.ObjectID) {
+	s.index.Remove(TypeCategory, id.Hex())
+}
@@ -0,0 +1,59 @@
+package suggestion
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/suggest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type mockRepository struct {
+	err error
+}
+
+func (m mockRepository) LoadBusinesses(ctx context.Context) ([]suggest.Entry, error) {
+	return []suggest.Entry{{Type: TypeBusiness, ID: "1", Name: "Bukka Hut"}}, m.err
+}
+
+func (m mockRepository) LoadCategories(ctx context.Context) ([]suggest.Entry, error) {
+	return []suggest.Entry{
+		{Type: TypeCategory, ID: "1", Name: "Bakeries", Popularity: 2},
+		{Type: TypeCategory, ID: "2", Name: "Banks", Popularity: 7},
+	}, nil
+}
+
+func Test_service(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewService(mockRepository{}, logger)
+	assert.Empty(t, s.Suggest(context.Background(), "b", 0).Categories)
+
+	assert.Nil(t, s.Refresh(context.Background()))
+	result := s.Suggest(context.Background(), "b", 0)
+	assert.Equal(t, "b", result.Prefix)
+	assert.Len(t, result.Businesses, 1)
+	if assert.Len(t, result.Categories, 2) {
+		assert.Equal(t, "Banks", result.Categories[0].Name)
+	}
+	assert.Len(t, s.Suggest(context.Background(), "b", 1).Categories, 1)
+
+	// incremental updates are visible without a refresh
+	id := primitive.NewObjectID()
+	s.BusinessChanged(entity.Business{ID: id, Name: "Bread & Butter"})
+	assert.Len(t, s.Suggest(context.Background(), "br", 0).Businesses, 1)
+	s.BusinessChanged(entity.Business{ID: id, Name: "Bread & Butter", Moderation: &entity.Moderation{Status: entity.ModerationPending}})
+	assert.Empty(t, s.Suggest(context.Background(), "br", 0).Businesses)
+	category := entity.BusinessCategory{ID: id, Name: "Bars"}
+	s.CategoryChanged(category)
+	assert.Len(t, s.Suggest(context.Background(), "bar", 0).Categories, 1)
+	category.IsDeleted = true
+	s.CategoryChanged(category)
+	assert.Empty(t, s.Suggest(context.Background(), "bar", 0).Categories)
+
+	s = NewService(mockRepository{errors.New("db down")}, logger)
+	assert.NotNil(t, s.Refresh(context.Background()))
+}
@@ -9,6 +9,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"regexp"
 	"strings"
 )
 
@@ -44,7 +45,7 @@ func (r repository) Get(ctx context.Context, id primitive.ObjectID) (entity.User
 	return user, err
 }
 func (r repository) GetByEmail(ctx context.Context, email string) (entity.User, error) {
-	filter := bson.M{"email": bson.M{"$regex": primitive.Regex{Pattern: "^" + email + "$", Options: "i"}}}
+	filter := bson.M{"email": bson.M{"$regex": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(email) + "$", Options: "i"}}}
 	var user entity.User
 	err := r.collection.FindOne(ctx, filter).Decode(&user)
 
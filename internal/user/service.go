@@ -7,6 +7,7 @@ import (
 	"github.com/go-ozzo/ozzo-validation/v4/is"
 	"github.com/ysodiqakanni/trustank-api/internal/entity"
 	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/tracing"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"time"
 )
@@ -53,6 +54,8 @@ func NewService(repo Repository, logger log.Logger) Service {
 
 // Get returns the album with the specified the album ID.
 func (s service) Get(ctx context.Context, id primitive.ObjectID) (*User, error) {
+	ctx, span := tracing.Start(ctx, "user.Get")
+	defer span.End()
 	user, err := s.repo.Get(ctx, id)
 	if err != nil {
 		return nil, err
@@ -61,6 +64,8 @@ func (s service) Get(ctx context.Context, id primitive.ObjectID) (*User, error)
 }
 
 func (s service) GetByEmail(ctx context.Context, email string) (User, error) {
+	ctx, span := tracing.Start(ctx, "user.GetByEmail")
+	defer span.End()
 	user, err := s.repo.GetByEmail(ctx, email)
 	if err != nil {
 		return User{}, err
@@ -68,6 +73,8 @@ func (s service) GetByEmail(ctx context.Context, email string) (User, error) {
 	return User{user}, nil
 }
 func (s service) Create(ctx context.Context, req CreateUserRequest) (*User, error) {
+	ctx, span := tracing.Start(ctx, "user.Create")
+	defer span.End()
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/ysodiqakanni/trustank-api/internal/auth"
+	"github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/pagination"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+// RegisterHandlers registers handlers for different HTTP requests.
+// Businesses manage their webhooks with a JWT or with an API key checked by authenticateAPIKey.
+func RegisterHandlers(r *mux.Router, service Service, authenticateAPIKey func(ctx context.Context, key string) (primitive.ObjectID, error), logger log.Logger, secret string) {
+	res := resource{service, logger}
+	owner := func(h http.HandlerFunc) http.Handler {
+		return auth.APIKeyMiddleware(h, secret, authenticateAPIKey)
+	}
+
+	// Owner-scoped Endpoints: ownership is checked by the service
+	r.Handle("/api/v1/businesses/{id}/webhooks", owner(res.createHandler)).Methods("POST")
+	r.Handle("/api/v1/businesses/{id}/webhooks", owner(res.queryHandler)).Methods("GET")
+	r.Handle("/api/v1/businesses/{id}/webhooks/{webhookId}", owner(res.deleteHandler)).Methods("DELETE")
+	r.Handle("/api/v1/businesses/{id}/webhooks/{webhookId}/ping", owner(res.pingHandler)).Methods("POST")
+	r.Handle("/api/v1/businesses/{id}/webhooks/{webhookId}/deliveries", owner(res.queryDeliveriesHandler)).Methods("GET")
+	r.Handle("/api/v1/businesses/{id}/webhooks/{webhookId}/deliveries/{deliveryId}/redeliver", owner(res.redeliverHandler)).Methods("POST")
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// the secret is only returned in the response of this request
+func (r resource) createHandler(w http.ResponseWriter, req *http.Request) {
+	var input SubscriptionRequest
+
+	err := json.NewDecoder(req.Body).Decode(&input)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	subscription, err := r.service.CreateSubscription(req.Context(), mux.Vars(req)["id"], input)
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+func (r resource) queryHandler(w http.ResponseWriter, req *http.Request) {
+	subscriptions, err := r.service.QuerySubscriptions(req.Context(), mux.Vars(req)["id"])
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+func (r resource) deleteHandler(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	if err := r.service.DeleteSubscription(req.Context(), vars["id"], vars["webhookId"]); err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r resource) pingHandler(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	delivery, err := r.service.Ping(req.Context(), vars["id"], vars["webhookId"])
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// list the deliveries of a webhook with their attempts: ?page=&per_page=
+func (r resource) queryDeliveriesHandler(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	count, err := r.service.CountDeliveries(req.Context(), vars["id"], vars["webhookId"])
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+	pages := pagination.NewFromRequest(req, count)
+	deliveries, err := r.service.QueryDeliveries(req.Context(), vars["id"], vars["webhookId"], pages.Offset(), pages.Limit())
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+	pages.Items = deliveries
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(pages)
+}
+
+func (r resource) redeliverHandler(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	delivery, err := r.service.Redeliver(req.Context(), vars["id"], vars["webhookId"], vars["deliveryId"])
+	if err != nil {
+		r.logger.With(req.Context()).Info(err)
+		errors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
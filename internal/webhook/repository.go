@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"context"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	"github.com/ysodiqakanni/trustank-api/pkg/dbcontext"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// Repository encapsulates the logic to access webhook subscriptions and deliveries from the data source.
+type Repository interface {
+	// CreateSubscription saves a new subscription and returns its ID.
+	CreateSubscription(ctx context.Context, subscription entity.WebhookSubscription) (primitive.ObjectID, error)
+	// GetSubscription returns the subscription with the specified ID.
+	GetSubscription(ctx context.Context, id primitive.ObjectID) (entity.WebhookSubscription, error)
+	// QuerySubscriptions returns the subscriptions of a business.
+	QuerySubscriptions(ctx context.Context, businessId primitive.ObjectID) ([]entity.WebhookSubscription, error)
+	// DeleteSubscription deletes a subscription.
+	DeleteSubscription(ctx context.Context, id primitive.ObjectID) error
+	// CreateDelivery saves a new delivery.
+	CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) (primitive.ObjectID, error)
+	// GetDelivery returns the delivery with the specified ID.
+	GetDelivery(ctx context.Context, id primitive.ObjectID) (entity.WebhookDelivery, error)
+	// QueryDeliveries returns the deliveries of a subscription, newest first.
+	QueryDeliveries(ctx context.Context, subscriptionId primitive.ObjectID, offset, limit int) ([]entity.WebhookDelivery, error)
+	// CountDeliveries returns the number of deliveries of a subscription.
+	CountDeliveries(ctx context.Context, subscriptionId primitive.ObjectID) (int, error)
+	// ClaimDelivery returns a pending delivery due at the given time and postpones its next attempt until leaseUntil,
+	// so that no other worker attempts it meanwhile. A delivery whose worker dies is attempted again once the lease
+	// expires. mongo.ErrNoDocuments is returned if no delivery is due.
+	ClaimDelivery(ctx context.Context, now, leaseUntil time.Time) (entity.WebhookDelivery, error)
+	// UpdateDelivery saves the status and log of a delivery.
+	UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error
+}
+
+// repository persists webhooks in database
+type repository struct {
+	subscriptions *mongo.Collection
+	deliveries    *mongo.Collection
+	logger        log.Logger
+}
+
+// NewRepository creates a new webhook repository.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	r := repository{db.DB().Collection("webhook_subscriptions"), db.DB().Collection("webhook_deliveries"), logger}
+	r.ensureIndexes()
+	return r
+}
+
+// ensureIndexes creates the indexes required by the repository queries if they do not exist yet.
+func (r repository) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := r.subscriptions.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.M{"business_id": 1}}); err != nil {
+		r.logger.Errorf("failed to create webhook subscription indexes: %v", err)
+	}
+	_, err := r.deliveries.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "subscription_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		r.logger.Errorf("failed to create webhook delivery indexes: %v", err)
+	}
+}
+
+func (r repository) CreateSubscription(ctx context.Context, subscription entity.WebhookSubscription) (primitive.ObjectID, error) {
+	result, err := r.subscriptions.InsertOne(ctx, subscription)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return result.InsertedID.(primitive.ObjectID), nil
+}
+
+func (r repository) GetSubscription(ctx context.Context, id primitive.ObjectID) (entity.WebhookSubscription, error) {
+	var subscription entity.WebhookSubscription
+	err := r.subscriptions.FindOne(ctx, bson.M{"_id": id}).Decode(&subscription)
+	return subscription, err
+}
+
+func (r repository) QuerySubscriptions(ctx context.Context, businessId primitive.ObjectID) ([]entity.WebhookSubscription, error) {
+	cursor, err := r.subscriptions.Find(ctx, bson.M{"business_id": businessId}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	subscriptions := []entity.WebhookSubscription{}
+	err = cursor.All(ctx, &subscriptions)
+	return subscriptions, err
+}
+
+func (r repository) DeleteSubscription(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.subscriptions.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r repository) CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) (primitive.ObjectID, error) {
+	result, err := r.deliveries.InsertOne(ctx, delivery)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return result.InsertedID.(primitive.ObjectID), nil
+}
+
+func (r repository) GetDelivery(ctx context.Context, id primitive.ObjectID) (entity.WebhookDelivery, error) {
+	var delivery entity.WebhookDelivery
+	err := r.deliveries.FindOne(ctx, bson.M{"_id": id}).Decode(&delivery)
+	return delivery, err
+}
+
+func (r repository) QueryDeliveries(ctx context.Context, subscriptionId primitive.ObjectID, offset, limit int) ([]entity.WebhookDelivery, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := r.deliveries.Find(ctx, bson.M{"subscription_id": subscriptionId}, opts)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []entity.WebhookDelivery{}
+	err = cursor.All(ctx, &deliveries)
+	return deliveries, err
+}
+
+func (r repository) CountDeliveries(ctx context.Context, subscriptionId primitive.ObjectID) (int, error) {
+	count, err := r.deliveries.CountDocuments(ctx, bson.M{"subscription_id": subscriptionId})
+	return int(count), err
+}
+
+func (r repository) ClaimDelivery(ctx context.Context, now, leaseUntil time.Time) (entity.WebhookDelivery, error) {
+	filter := bson.M{"status": entity.DeliveryPending, "next_attempt_at": bson.M{"$lte": now}}
+	update := bson.M{"$set": bson.M{"next_attempt_at": leaseUntil}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.M{"next_attempt_at": 1}).
+		SetReturnDocument(options.After)
+	var delivery entity.WebhookDelivery
+	err := r.deliveries.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+	return delivery, err
+}
+
+func (r repository) UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	result, err := r.deliveries.ReplaceOne(ctx, bson.M{"_id": delivery.ID}, delivery)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -0,0 +1,465 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/ysodiqakanni/trustank-api/internal/business"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	apperrors "github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/tracing"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types sent to webhook subscriptions.
+const (
+	// EventPing is a test event sent on request to check that an endpoint works.
+	EventPing = "ping"
+	// EventInvitationOpened is sent when a customer follows the link of a review invitation.
+	EventInvitationOpened = "invitation.opened"
+	// EventInvitationUnsubscribed is sent when a customer unsubscribes from the invitations of a business.
+	EventInvitationUnsubscribed = "invitation.unsubscribed"
+)
+
+// EventTypes lists the event types that can be subscribed to.
+var EventTypes = []string{EventInvitationOpened, EventInvitationUnsubscribed}
+
+const (
+	// retryDelay is the delay before the first retry of a failed delivery. It doubles after each attempt.
+	retryDelay = 30 * time.Second
+	// maxRetryDelay is the longest delay between two attempts of a delivery.
+	maxRetryDelay = 6 * time.Hour
+	// leaseDuration is how long a claimed delivery is hidden from other workers.
+	leaseDuration = time.Minute
+	// maxLogSize is the number of attempts kept in the log of a delivery.
+	maxLogSize = 20
+	// deliveryConcurrency is the number of deliveries attempted at the same time.
+	deliveryConcurrency = 4
+)
+
+// Publisher notifies the webhook subscriptions of a business about an event.
+type Publisher interface {
+	// Publish queues the delivery of an event to the subscriptions of a business that subscribed to its type.
+	Publish(ctx context.Context, businessId primitive.ObjectID, eventType string, data interface{}) error
+}
+
+// Service encapsulates use case logic for webhooks. All methods but Publish and Run are scoped to the businesses
+// managed by the current user or API key.
+type Service interface {
+	Publisher
+	// CreateSubscription registers an endpoint and returns the subscription with its signing secret.
+	CreateSubscription(ctx context.Context, businessId string, req SubscriptionRequest) (Subscription, error)
+	// QuerySubscriptions returns the subscriptions of a business, without their secrets.
+	QuerySubscriptions(ctx context.Context, businessId string) ([]Subscription, error)
+	// DeleteSubscription deletes a subscription.
+	DeleteSubscription(ctx context.Context, businessId, subscriptionId string) error
+	// Ping queues a test event for a subscription.
+	Ping(ctx context.Context, businessId, subscriptionId string) (Delivery, error)
+	// QueryDeliveries returns the deliveries of a subscription, newest first.
+	QueryDeliveries(ctx context.Context, businessId, subscriptionId string, offset, limit int) ([]Delivery, error)
+	// CountDeliveries returns the number of deliveries of a subscription.
+	CountDeliveries(ctx context.Context, businessId, subscriptionId string) (int, error)
+	// Redeliver queues a delivery again, whatever its status, restarting its retries.
+	Redeliver(ctx context.Context, businessId, subscriptionId, deliveryId string) (Delivery, error)
+	// Run attempts the due deliveries at the given interval until the context is canceled.
+	Run(ctx context.Context, interval time.Duration)
+}
+
+// Businesses gives access to the businesses that the current user or API key manages.
+type Businesses interface {
+	GetOwned(ctx context.Context, businessId string) (business.Business, error)
+}
+
+// Subscription represents a webhook subscription.
+type Subscription struct {
+	entity.WebhookSubscription
+}
+
+// Delivery represents a webhook delivery.
+type Delivery struct {
+	entity.WebhookDelivery
+}
+
+// Event is the JSON payload sent to webhook endpoints.
+type Event struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	BusinessID string      `json:"business_id"`
+	CreatedAt  time.Time   `json:"created_at"`
+	Data       interface{} `json:"data"`
+}
+
+// SubscriptionRequest represents a request to create a webhook subscription.
+type SubscriptionRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// Validate validates the SubscriptionRequest fields.
+func (m SubscriptionRequest) Validate() error {
+	eventTypes := make([]interface{}, len(EventTypes))
+	for i, t := range EventTypes {
+		eventTypes[i] = t
+	}
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.URL, validation.Required, validation.Length(0, 2048), is.URL, validation.By(httpURL)),
+		validation.Field(&m.Events, validation.Required, validation.Each(validation.In(eventTypes...))),
+	)
+}
+
+func httpURL(value interface{}) error {
+	s, _ := value.(string)
+	if !strings.HasPrefix(s, "https://") && !strings.HasPrefix(s, "http://") {
+		return validation.NewError("validation_http_url", "must be an http or https URL")
+	}
+	return nil
+}
+
+type service struct {
+	repo        Repository
+	businesses  Businesses
+	client      *http.Client
+	maxAttempts int
+	logger      log.Logger
+}
+
+// NewService creates a new webhook service. Deliveries are sent with client, and are dead after maxAttempts failures.
+func NewService(repo Repository, businesses Businesses, client *http.Client, maxAttempts int, logger log.Logger) Service {
+	return service{repo, businesses, client, maxAttempts, logger}
+}
+
+func (s service) CreateSubscription(ctx context.Context, businessId string, req SubscriptionRequest) (Subscription, error) {
+	ctx, span := tracing.Start(ctx, "webhook.CreateSubscription")
+	defer span.End()
+	if err := req.Validate(); err != nil {
+		return Subscription{}, err
+	}
+	biz, err := s.businesses.GetOwned(ctx, businessId)
+	if err != nil {
+		return Subscription{}, err
+	}
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return Subscription{}, err
+	}
+	subscription := entity.WebhookSubscription{
+		BusinessID: biz.ID,
+		URL:        req.URL,
+		Events:     req.Events,
+		Secret:     "whsec_" + hex.EncodeToString(secret),
+		CreatedAt:  time.Now(),
+	}
+	if subscription.ID, err = s.repo.CreateSubscription(ctx, subscription); err != nil {
+		return Subscription{}, err
+	}
+	return Subscription{subscription}, nil
+}
+
+func (s service) QuerySubscriptions(ctx context.Context, businessId string) ([]Subscription, error) {
+	ctx, span := tracing.Start(ctx, "webhook.QuerySubscriptions")
+	defer span.End()
+	biz, err := s.businesses.GetOwned(ctx, businessId)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.repo.QuerySubscriptions(ctx, biz.ID)
+	if err != nil {
+		return nil, err
+	}
+	result := []Subscription{}
+	for _, item := range items {
+		item.Secret = ""
+		result = append(result, Subscription{item})
+	}
+	return result, nil
+}
+
+func (s service) DeleteSubscription(ctx context.Context, businessId, subscriptionId string) error {
+	ctx, span := tracing.Start(ctx, "webhook.DeleteSubscription")
+	defer span.End()
+	subscription, err := s.getSubscription(ctx, businessId, subscriptionId)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteSubscription(ctx, subscription.ID)
+}
+
+func (s service) Ping(ctx context.Context, businessId, subscriptionId string) (Delivery, error) {
+	ctx, span := tracing.Start(ctx, "webhook.Ping")
+	defer span.End()
+	subscription, err := s.getSubscription(ctx, businessId, subscriptionId)
+	if err != nil {
+		return Delivery{}, err
+	}
+	event := newEvent(subscription.BusinessID, EventPing, map[string]string{"subscription_id": subscription.ID.Hex()})
+	delivery, err := s.queue(ctx, subscription, event)
+	return Delivery{delivery}, err
+}
+
+func (s service) Publish(ctx context.Context, businessId primitive.ObjectID, eventType string, data interface{}) error {
+	ctx, span := tracing.Start(ctx, "webhook.Publish")
+	defer span.End()
+	subscriptions, err := s.repo.QuerySubscriptions(ctx, businessId)
+	if err != nil {
+		return err
+	}
+	// the event is shared by all the deliveries so that its ID is the same for every endpoint
+	event := newEvent(businessId, eventType, data)
+	for _, subscription := range subscriptions {
+		if !contains(subscription.Events, eventType) {
+			continue
+		}
+		if _, err := s.queue(ctx, subscription, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s service) QueryDeliveries(ctx context.Context, businessId, subscriptionId string, offset, limit int) ([]Delivery, error) {
+	ctx, span := tracing.Start(ctx, "webhook.QueryDeliveries")
+	defer span.End()
+	subscription, err := s.getSubscription(ctx, businessId, subscriptionId)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.repo.QueryDeliveries(ctx, subscription.ID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Delivery{}
+	for _, item := range items {
+		result = append(result, Delivery{item})
+	}
+	return result, nil
+}
+
+func (s service) CountDeliveries(ctx context.Context, businessId, subscriptionId string) (int, error) {
+	ctx, span := tracing.Start(ctx, "webhook.CountDeliveries")
+	defer span.End()
+	subscription, err := s.getSubscription(ctx, businessId, subscriptionId)
+	if err != nil {
+		return 0, err
+	}
+	return s.repo.CountDeliveries(ctx, subscription.ID)
+}
+
+func (s service) Redeliver(ctx context.Context, businessId, subscriptionId, deliveryId string) (Delivery, error) {
+	ctx, span := tracing.Start(ctx, "webhook.Redeliver")
+	defer span.End()
+	subscription, err := s.getSubscription(ctx, businessId, subscriptionId)
+	if err != nil {
+		return Delivery{}, err
+	}
+	id, err := primitive.ObjectIDFromHex(deliveryId)
+	if err != nil {
+		return Delivery{}, apperrors.NotFound("")
+	}
+	delivery, err := s.repo.GetDelivery(ctx, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+	if delivery.SubscriptionID != subscription.ID {
+		return Delivery{}, apperrors.NotFound("")
+	}
+	delivery.Status = entity.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	if err := s.repo.UpdateDelivery(ctx, delivery); err != nil {
+		return Delivery{}, err
+	}
+	return Delivery{delivery}, nil
+}
+
+func (s service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.deliverDue(ctx)
+		}
+	}
+}
+
+// deliverDue attempts all the deliveries that are due, a few at a time.
+func (s service) deliverDue(ctx context.Context) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, deliveryConcurrency)
+	for ctx.Err() == nil {
+		now := time.Now()
+		delivery, err := s.repo.ClaimDelivery(ctx, now, now.Add(leaseDuration))
+		if err != nil {
+			if err != mongo.ErrNoDocuments {
+				s.logger.Errorf("failed to claim webhook delivery: %s", err)
+			}
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := s.deliver(ctx, delivery); err != nil {
+				s.logger.Errorf("failed to deliver webhook %s: %s", delivery.ID.Hex(), err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// deliver makes an attempt to send a delivery to its endpoint and records the outcome.
+// An error is returned only if the outcome could not be recorded, in which case the delivery is attempted again
+// once its lease expires.
+func (s service) deliver(ctx context.Context, delivery entity.WebhookDelivery) error {
+	subscription, err := s.repo.GetSubscription(ctx, delivery.SubscriptionID)
+	if err == mongo.ErrNoDocuments {
+		delivery.Status = entity.DeliveryDead
+		delivery.Log = appendLog(delivery.Log, entity.DeliveryAttempt{At: time.Now(), Error: "the subscription was deleted"})
+		return s.repo.UpdateDelivery(ctx, delivery)
+	}
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	attempt := entity.DeliveryAttempt{At: start}
+	attempt.StatusCode, err = s.post(ctx, subscription, delivery, start)
+	attempt.Duration = time.Since(start).Milliseconds()
+	delivery.Attempts++
+	switch {
+	case err == nil && attempt.StatusCode >= 200 && attempt.StatusCode < 300:
+		delivery.Status = entity.DeliverySucceeded
+		delivery.DeliveredAt = &start
+	case delivery.Attempts >= s.maxAttempts:
+		delivery.Status = entity.DeliveryDead
+	default:
+		delivery.NextAttemptAt = start.Add(backoff(delivery.Attempts))
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	} else if delivery.Status != entity.DeliverySucceeded {
+		attempt.Error = fmt.Sprintf("unexpected response status %d", attempt.StatusCode)
+	}
+	delivery.Log = appendLog(delivery.Log, attempt)
+	return s.repo.UpdateDelivery(ctx, delivery)
+}
+
+// post sends the signed payload of a delivery and returns the response status.
+func (s service) post(ctx context.Context, subscription entity.WebhookSubscription, delivery entity.WebhookDelivery, at time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Trustank-Webhooks/1.0")
+	req.Header.Set("X-Trustank-Event", delivery.EventType)
+	req.Header.Set("X-Trustank-Delivery", delivery.ID.Hex())
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, at, body))
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// read a bit of the body so that the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+	return res.StatusCode, nil
+}
+
+// queue creates a pending delivery of an event to a subscription.
+func (s service) queue(ctx context.Context, subscription entity.WebhookSubscription, event Event) (entity.WebhookDelivery, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return entity.WebhookDelivery{}, err
+	}
+	delivery := entity.WebhookDelivery{
+		SubscriptionID: subscription.ID,
+		BusinessID:     subscription.BusinessID,
+		EventID:        event.ID,
+		EventType:      event.Type,
+		Payload:        string(payload),
+		Status:         entity.DeliveryPending,
+		NextAttemptAt:  event.CreatedAt,
+		Log:            []entity.DeliveryAttempt{},
+		CreatedAt:      event.CreatedAt,
+	}
+	delivery.ID, err = s.repo.CreateDelivery(ctx, delivery)
+	return delivery, err
+}
+
+// getSubscription returns a subscription of a business managed by the current user or API key.
+func (s service) getSubscription(ctx context.Context, businessId, subscriptionId string) (entity.WebhookSubscription, error) {
+	biz, err := s.businesses.GetOwned(ctx, businessId)
+	if err != nil {
+		return entity.WebhookSubscription{}, err
+	}
+	id, err := primitive.ObjectIDFromHex(subscriptionId)
+	if err != nil {
+		return entity.WebhookSubscription{}, apperrors.NotFound("")
+	}
+	subscription, err := s.repo.GetSubscription(ctx, id)
+	if err != nil {
+		return entity.WebhookSubscription{}, err
+	}
+	if subscription.BusinessID != biz.ID {
+		return entity.WebhookSubscription{}, apperrors.NotFound("")
+	}
+	return subscription, nil
+}
+
+func newEvent(businessId primitive.ObjectID, eventType string, data interface{}) Event {
+	return Event{
+		ID:         primitive.NewObjectID().Hex(),
+		Type:       eventType,
+		BusinessID: businessId.Hex(),
+		CreatedAt:  time.Now().UTC(),
+		Data:       data,
+	}
+}
+
+// backoff returns the delay before the next attempt of a delivery that failed the given number of times.
+func backoff(attempts int) time.Duration {
+	delay := retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// appendLog adds an attempt to a delivery log, dropping the oldest attempts beyond maxLogSize.
+func appendLog(log []entity.DeliveryAttempt, attempt entity.DeliveryAttempt) []entity.DeliveryAttempt {
+	log = append(log, attempt)
+	if len(log) > maxLogSize {
+		log = log[len(log)-maxLogSize:]
+	}
+	return log
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,282 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysodiqakanni/trustank-api/internal/business"
+	"github.com/ysodiqakanni/trustank-api/internal/entity"
+	apperrors "github.com/ysodiqakanni/trustank-api/internal/errors"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mockRepository struct {
+	sync.Mutex
+	subscriptions map[primitive.ObjectID]entity.WebhookSubscription
+	deliveries    map[primitive.ObjectID]entity.WebhookDelivery
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{
+		subscriptions: map[primitive.ObjectID]entity.WebhookSubscription{},
+		deliveries:    map[primitive.ObjectID]entity.WebhookDelivery{},
+	}
+}
+
+func (m *mockRepository) CreateSubscription(ctx context.Context, subscription entity.WebhookSubscription) (primitive.ObjectID, error) {
+	m.Lock()
+	defer m.Unlock()
+	subscription.ID = primitive.NewObjectID()
+	m.subscriptions[subscription.ID] = subscription
+	return subscription.ID, nil
+}
+
+func (m *mockRepository) GetSubscription(ctx context.Context, id primitive.ObjectID) (entity.WebhookSubscription, error) {
+	m.Lock()
+	defer m.Unlock()
+	if item, ok := m.subscriptions[id]; ok {
+		return item, nil
+	}
+	return entity.WebhookSubscription{}, mongo.ErrNoDocuments
+}
+
+func (m *mockRepository) QuerySubscriptions(ctx context.Context, businessId primitive.ObjectID) ([]entity.WebhookSubscription, error) {
+	m.Lock()
+	defer m.Unlock()
+	var result []entity.WebhookSubscription
+	for _, item := range m.subscriptions {
+		if item.BusinessID == businessId {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockRepository) DeleteSubscription(ctx context.Context, id primitive.ObjectID) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.subscriptions, id)
+	return nil
+}
+
+func (m *mockRepository) CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) (primitive.ObjectID, error) {
+	m.Lock()
+	defer m.Unlock()
+	delivery.ID = primitive.NewObjectID()
+	m.deliveries[delivery.ID] = delivery
+	return delivery.ID, nil
+}
+
+func (m *mockRepository) GetDelivery(ctx context.Context, id primitive.ObjectID) (entity.WebhookDelivery, error) {
+	m.Lock()
+	defer m.Unlock()
+	if item, ok := m.deliveries[id]; ok {
+		return item, nil
+	}
+	return entity.WebhookDelivery{}, mongo.ErrNoDocuments
+}
+
+func (m *mockRepository) QueryDeliveries(ctx context.Context, subscriptionId primitive.ObjectID, offset, limit int) ([]entity.WebhookDelivery, error) {
+	m.Lock()
+	defer m.Unlock()
+	var result []entity.WebhookDelivery
+	for _, item := range m.deliveries {
+		if item.SubscriptionID == subscriptionId {
+			result = append(result, item)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID.Hex() > result[j].ID.Hex() })
+	return result, nil
+}
+
+func (m *mockRepository) CountDeliveries(ctx context.Context, subscriptionId primitive.ObjectID) (int, error) {
+	items, _ := m.QueryDeliveries(ctx, subscriptionId, 0, 0)
+	return len(items), nil
+}
+
+func (m *mockRepository) ClaimDelivery(ctx context.Context, now, leaseUntil time.Time) (entity.WebhookDelivery, error) {
+	m.Lock()
+	defer m.Unlock()
+	for id, item := range m.deliveries {
+		if item.Status == entity.DeliveryPending && !item.NextAttemptAt.After(now) {
+			item.NextAttemptAt = leaseUntil
+			m.deliveries[id] = item
+			return item, nil
+		}
+	}
+	return entity.WebhookDelivery{}, mongo.ErrNoDocuments
+}
+
+func (m *mockRepository) UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.deliveries[delivery.ID]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	m.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+// due makes all the pending deliveries due now, as if their retry delay had elapsed.
+func (m *mockRepository) due() {
+	m.Lock()
+	defer m.Unlock()
+	for id, item := range m.deliveries {
+		item.NextAttemptAt = time.Now().Add(-time.Second)
+		m.deliveries[id] = item
+	}
+}
+
+type mockBusinesses struct {
+	business entity.Business
+}
+
+func (m mockBusinesses) GetOwned(ctx context.Context, businessId string) (business.Business, error) {
+	if businessId != m.business.ID.Hex() {
+		return business.Business{}, apperrors.Forbidden("")
+	}
+	return business.Business{Business: m.business}, nil
+}
+
+// receiver is a webhook endpoint that verifies signatures and answers with the configured status.
+type receiver struct {
+	sync.Mutex
+	secret string
+	status int
+	events []Event
+}
+
+func (m *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := Verify(m.secret, req.Header.Get(SignatureHeader), body, time.Minute); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var event Event
+	json.Unmarshal(body, &event)
+	m.events = append(m.events, event)
+	w.WriteHeader(m.status)
+}
+
+func Test_service(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	biz := entity.Business{ID: primitive.NewObjectID(), Name: "Bukka Hut"}
+	repo := newMockRepository()
+	s := NewService(repo, mockBusinesses{biz}, NewHTTPClient(true), 3, logger).(service)
+	endpoint := &receiver{status: http.StatusOK}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	// validation and ownership
+	_, err := s.CreateSubscription(ctx, biz.ID.Hex(), SubscriptionRequest{URL: "ftp://example.com", Events: EventTypes})
+	assert.NotNil(t, err)
+	_, err = s.CreateSubscription(ctx, biz.ID.Hex(), SubscriptionRequest{URL: server.URL, Events: []string{"review.created"}})
+	assert.NotNil(t, err)
+	_, err = s.CreateSubscription(ctx, primitive.NewObjectID().Hex(), SubscriptionRequest{URL: server.URL, Events: EventTypes})
+	assert.NotNil(t, err)
+
+	subscription, err := s.CreateSubscription(ctx, biz.ID.Hex(), SubscriptionRequest{URL: server.URL, Events: []string{EventInvitationOpened}})
+	assert.Nil(t, err)
+	assert.Contains(t, subscription.Secret, "whsec_")
+	endpoint.secret = subscription.Secret
+	subscriptions, _ := s.QuerySubscriptions(ctx, biz.ID.Hex())
+	if assert.Len(t, subscriptions, 1) {
+		assert.Empty(t, subscriptions[0].Secret)
+	}
+
+	// only the subscribed events are delivered
+	assert.Nil(t, s.Publish(ctx, biz.ID, EventInvitationOpened, map[string]string{"invitation_id": "1"}))
+	assert.Nil(t, s.Publish(ctx, biz.ID, EventInvitationUnsubscribed, nil))
+	s.deliverDue(ctx)
+	if assert.Len(t, endpoint.events, 1) {
+		assert.Equal(t, EventInvitationOpened, endpoint.events[0].Type)
+		assert.Equal(t, biz.ID.Hex(), endpoint.events[0].BusinessID)
+	}
+	deliveries, _ := s.QueryDeliveries(ctx, biz.ID.Hex(), subscription.ID.Hex(), 0, 10)
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, entity.DeliverySucceeded, deliveries[0].Status)
+		assert.Len(t, deliveries[0].Log, 1)
+	}
+
+	// failures are retried later, then the delivery is dead
+	endpoint.status = http.StatusInternalServerError
+	ping, err := s.Ping(ctx, biz.ID.Hex(), subscription.ID.Hex())
+	assert.Nil(t, err)
+	s.deliverDue(ctx)
+	delivery, _ := repo.GetDelivery(ctx, ping.ID)
+	assert.Equal(t, entity.DeliveryPending, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.True(t, delivery.NextAttemptAt.After(time.Now().Add(20*time.Second)))
+	s.deliverDue(ctx)
+	delivery, _ = repo.GetDelivery(ctx, ping.ID)
+	assert.Equal(t, 1, delivery.Attempts)
+	for i := 0; i < 2; i++ {
+		repo.due()
+		s.deliverDue(ctx)
+	}
+	delivery, _ = repo.GetDelivery(ctx, ping.ID)
+	assert.Equal(t, entity.DeliveryDead, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Equal(t, "unexpected response status 500", delivery.Log[2].Error)
+
+	// a dead delivery can be sent again
+	endpoint.status = http.StatusNoContent
+	_, err = s.Redeliver(ctx, biz.ID.Hex(), subscription.ID.Hex(), primitive.NewObjectID().Hex())
+	assert.NotNil(t, err)
+	_, err = s.Redeliver(ctx, biz.ID.Hex(), subscription.ID.Hex(), ping.ID.Hex())
+	assert.Nil(t, err)
+	s.deliverDue(ctx)
+	delivery, _ = repo.GetDelivery(ctx, ping.ID)
+	assert.Equal(t, entity.DeliverySucceeded, delivery.Status)
+	assert.Len(t, delivery.Log, 4)
+	count, _ := s.CountDeliveries(ctx, biz.ID.Hex(), subscription.ID.Hex())
+	assert.Equal(t, 2, count)
+
+	// deliveries of deleted subscriptions are dropped
+	ping, _ = s.Ping(ctx, biz.ID.Hex(), subscription.ID.Hex())
+	assert.Nil(t, s.DeleteSubscription(ctx, biz.ID.Hex(), subscription.ID.Hex()))
+	s.deliverDue(ctx)
+	delivery, _ = repo.GetDelivery(ctx, ping.ID)
+	assert.Equal(t, entity.DeliveryDead, delivery.Status)
+}
+
+func Test_service_PrivateAddress(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	biz := entity.Business{ID: primitive.NewObjectID()}
+	repo := newMockRepository()
+	s := NewService(repo, mockBusinesses{biz}, NewHTTPClient(false), 3, logger).(service)
+	endpoint := &receiver{status: http.StatusOK}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	subscription, _ := s.CreateSubscription(ctx, biz.ID.Hex(), SubscriptionRequest{URL: server.URL, Events: EventTypes})
+	ping, _ := s.Ping(ctx, biz.ID.Hex(), subscription.ID.Hex())
+	s.deliverDue(ctx)
+	delivery, _ := repo.GetDelivery(ctx, ping.ID)
+	assert.Empty(t, endpoint.events)
+	assert.Equal(t, entity.DeliveryPending, delivery.Status)
+	if assert.Len(t, delivery.Log, 1) {
+		assert.Contains(t, delivery.Log[0].Error, ErrPrivateAddress.Error())
+	}
+}
+
+func Test_backoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, backoff(1))
+	assert.Equal(t, time.Minute, backoff(2))
+	assert.Equal(t, 4*time.Minute, backoff(4))
+	assert.Equal(t, 6*time.Hour, backoff(20))
+}
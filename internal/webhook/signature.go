@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader is the header holding the signature of a webhook payload, in the form "t=<unix time>,v1=<hex HMAC>".
+const SignatureHeader = "X-Trustank-Signature"
+
+// ErrInvalidSignature is returned by Verify when a signature does not match the payload or is too old.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the signature header value of a payload sent at the given time. The signature is the HMAC-SHA256
+// of the Unix time, a dot and the payload, so that a captured request cannot be replayed later.
+func Sign(secret string, at time.Time, payload []byte) string {
+	t := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, payload))
+}
+
+// Verify checks a signature header against a payload. Signatures older than tolerance are rejected.
+func Verify(secret, header string, payload []byte, tolerance time.Duration) error {
+	var t string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			t = kv[1]
+		case "v1":
+			if sig, err := hex.DecodeString(kv[1]); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+	expected := mac(secret, t, payload)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func mac(secret, t string, payload []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(t + "."))
+	h.Write(payload)
+	return h.Sum(nil)
+}
@@ -0,0 +1,19 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	payload := []byte(`{"type":"ping"}`)
+	now := time.Now()
+	header := Sign("whsec_1", now, payload)
+	assert.Nil(t, Verify("whsec_1", header, payload, 5*time.Minute))
+	assert.Equal(t, ErrInvalidSignature, Verify("whsec_2", header, payload, 5*time.Minute))
+	assert.Equal(t, ErrInvalidSignature, Verify("whsec_1", header, []byte(`{"type":"pong"}`), 5*time.Minute))
+	assert.Equal(t, ErrInvalidSignature, Verify("whsec_1", Sign("whsec_1", now.Add(-time.Hour), payload), payload, 5*time.Minute))
+	assert.Equal(t, ErrInvalidSignature, Verify("whsec_1", "v1=abc", payload, 5*time.Minute))
+}
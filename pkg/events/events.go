@@ -0,0 +1,101 @@
+// Package events provides typed domain events stored in a transactional outbox and dispatched to in-process
+// handlers by a relay.
+//
+// Events are written to the outbox with the same context as the domain change, so that with a Mongo session
+// context they are committed or aborted together with it. The relay then delivers them at least once to the
+// handlers subscribed to their type, in order for each aggregate. Handlers must therefore be idempotent.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Record statuses.
+const (
+	// StatusPending is the status of a record waiting to be dispatched, or to be retried after a failure.
+	StatusPending = "pending"
+	// StatusDispatched is the status of a record that all the handlers processed.
+	StatusDispatched = "dispatched"
+	// StatusFailed is the status of a record that the handlers kept failing to process.
+	StatusFailed = "failed"
+)
+
+// Event is a domain event. Events of the same aggregate are dispatched in the order they were published.
+type Event interface {
+	// EventType returns the name handlers subscribe to, such as "business.registered".
+	EventType() string
+	// AggregateID returns the ID of the entity the event is about.
+	AggregateID() string
+}
+
+// Record is an event stored in the outbox.
+type Record struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Type        string             `json:"type" bson:"type"`
+	AggregateID string             `json:"aggregate_id" bson:"aggregate_id"`
+	// Payload is the event encoded in JSON.
+	Payload       string     `json:"payload" bson:"payload"`
+	Status        string     `json:"status" bson:"status"`
+	Attempts      int        `json:"attempts" bson:"attempts"`
+	LastError     string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at" bson:"created_at"`
+	DispatchedAt  *time.Time `json:"dispatched_at,omitempty" bson:"dispatched_at,omitempty"`
+}
+
+// Decode decodes the payload of the record into the event it was created from.
+func (r Record) Decode(event interface{}) error {
+	return json.Unmarshal([]byte(r.Payload), event)
+}
+
+// NewRecord creates a pending record for an event.
+func NewRecord(event Event) (Record, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return Record{}, err
+	}
+	now := time.Now()
+	return Record{
+		ID:            primitive.NewObjectID(),
+		Type:          event.EventType(),
+		AggregateID:   event.AggregateID(),
+		Payload:       string(payload),
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}, nil
+}
+
+// Publisher publishes domain events.
+type Publisher interface {
+	// Publish writes events to the outbox. When ctx is a Mongo session context, the events are part of its
+	// transaction.
+	Publish(ctx context.Context, events ...Event) error
+}
+
+// Outbox is a Publisher writing events to a Store.
+type Outbox struct {
+	store Store
+}
+
+// NewOutbox creates an Outbox writing events to the given store.
+func NewOutbox(store Store) *Outbox {
+	return &Outbox{store}
+}
+
+// Publish writes events to the outbox.
+func (o *Outbox) Publish(ctx context.Context, events ...Event) error {
+	records := make([]Record, 0, len(events))
+	for _, event := range events {
+		record, err := NewRecord(event)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+	return o.store.Add(ctx, records...)
+}
@@ -0,0 +1,136 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+)
+
+type renamed struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (e renamed) EventType() string   { return "business.renamed" }
+func (e renamed) AggregateID() string { return e.ID }
+
+// pending returns the pending records of a memory store, oldest first.
+func pending(store Store) []Record {
+	var records []Record
+	for _, record := range store.(*memoryStore).records {
+		if record.Status == StatusPending {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID.Hex() < records[j].ID.Hex() })
+	return records
+}
+
+// due makes all the pending records of a store due now, as if their retry delay had elapsed.
+func due(t *testing.T, store Store) {
+	for _, record := range pending(store) {
+		record.NextAttemptAt = time.Now().Add(-time.Second)
+		assert.Nil(t, store.Update(context.Background(), record))
+	}
+}
+
+func TestRelay(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	store := NewMemoryStore()
+	relay := NewRelay(store, logger)
+
+	var handled []string
+	fail := true
+	relay.Subscribe("business.renamed", func(ctx context.Context, record Record) error {
+		var event renamed
+		if err := record.Decode(&event); err != nil {
+			return err
+		}
+		if event.Name == "Bukka" && fail {
+			return errors.New("index down")
+		}
+		handled = append(handled, event.ID+":"+event.Name)
+		return nil
+	})
+
+	outbox := NewOutbox(store)
+	assert.Nil(t, outbox.Publish(ctx, renamed{"1", "Bukka"}, renamed{"2", "Mama Put"}, renamed{"1", "Bukka Hut"}))
+
+	// a failed event holds back the later events of its aggregate only
+	assert.Equal(t, 2, relay.dispatchPending(ctx))
+	assert.Equal(t, []string{"2:Mama Put"}, handled)
+	assert.Equal(t, 0, relay.dispatchPending(ctx))
+	records := pending(store)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, 1, records[0].Attempts)
+		assert.Equal(t, "index down", records[0].LastError)
+		assert.True(t, records[0].NextAttemptAt.After(time.Now()))
+	}
+
+	fail = false
+	due(t, store)
+	assert.Equal(t, 1, relay.dispatchPending(ctx))
+	assert.Equal(t, 1, relay.dispatchPending(ctx))
+	assert.Equal(t, []string{"2:Mama Put", "1:Bukka", "1:Bukka Hut"}, handled)
+	assert.Empty(t, pending(store))
+}
+
+func TestRelay_Failed(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	store := NewMemoryStore()
+	relay := NewRelay(store, logger)
+	relay.Subscribe("business.renamed", func(ctx context.Context, record Record) error {
+		panic("boom")
+	})
+	assert.Nil(t, NewOutbox(store).Publish(ctx, renamed{"1", "Bukka"}))
+
+	for i := 0; i < maxAttempts; i++ {
+		due(t, store)
+		assert.Equal(t, 1, relay.dispatchPending(ctx))
+	}
+	assert.Empty(t, pending(store))
+
+	// events without handlers are simply marked as dispatched
+	assert.Nil(t, NewOutbox(store).Publish(ctx, renamed{"2", "Mama Put"}))
+	relay = NewRelay(store, logger)
+	assert.Equal(t, 1, relay.dispatchPending(ctx))
+}
+
+func TestRelay_Backoff(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	store := NewMemoryStore()
+	relay := NewRelay(store, logger)
+	var handled []string
+	relay.Subscribe("business.renamed", func(ctx context.Context, record Record) error {
+		handled = append(handled, record.AggregateID)
+		return nil
+	})
+
+	// more than a batch of older records waiting for a retry
+	for i := 0; i < batchSize+10; i++ {
+		record, _ := NewRecord(renamed{strconv.Itoa(i), "Bukka"})
+		record.Attempts = 5
+		record.NextAttemptAt = time.Now().Add(time.Hour)
+		assert.Nil(t, store.Add(ctx, record))
+	}
+	assert.Nil(t, NewOutbox(store).Publish(ctx, renamed{"new", "Mama Put"}))
+
+	assert.Equal(t, 1, relay.dispatchPending(ctx))
+	assert.Equal(t, []string{"new"}, handled)
+	assert.Len(t, pending(store), batchSize+10)
+}
+
+func Test_backoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, backoff(1))
+	assert.Equal(t, 40*time.Second, backoff(3))
+	assert.Equal(t, time.Hour, backoff(30))
+}
@@ -0,0 +1,152 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/metrics"
+	"github.com/ysodiqakanni/trustank-api/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// maxAttempts is the number of times a record is dispatched before it is marked as failed.
+	maxAttempts = 10
+	// retryDelay is the delay before the first retry of a record. It doubles after each attempt.
+	retryDelay = 10 * time.Second
+	// maxRetryDelay is the longest delay between two attempts of a record.
+	maxRetryDelay = time.Hour
+	// leaseDuration is how long a claimed record is hidden from other relays.
+	leaseDuration = time.Minute
+	// batchSize is the number of pending records read at a time.
+	batchSize = 100
+)
+
+// eventsDispatched counts the dispatch attempts of the records by event type and resulting status.
+var eventsDispatched = metrics.NewCounter("outbox_events_dispatched_total", "Number of outbox dispatch attempts by event type and resulting status.", "type", "status")
+
+// Handler processes an event. The event can be decoded with Record.Decode. Since a record is dispatched again
+// when one of its handlers fails, handlers must be idempotent.
+type Handler func(ctx context.Context, record Record) error
+
+// Relay dispatches the records of an outbox to the handlers subscribed to their type.
+type Relay struct {
+	store    Store
+	logger   log.Logger
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+// NewRelay creates a Relay dispatching the records of the given store.
+func NewRelay(store Store, logger log.Logger) *Relay {
+	return &Relay{store: store, logger: logger, handlers: map[string][]Handler{}}
+}
+
+// Subscribe registers a handler for the events of the given type.
+func (r *Relay) Subscribe(eventType string, handler Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[eventType] = append(r.handlers[eventType], handler)
+}
+
+// Run dispatches the pending records at the given interval until the context is canceled.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// keep going while records are dispatched, as the next records of their aggregates may be waiting
+			for ctx.Err() == nil && r.dispatchPending(ctx) > 0 {
+			}
+		}
+	}
+}
+
+// dispatchPending dispatches the oldest pending record of each aggregate, if it is due, and returns the number of
+// records processed. Later records of an aggregate wait until the earlier ones are dispatched or have failed.
+func (r *Relay) dispatchPending(ctx context.Context) int {
+	records, err := r.store.Due(ctx, time.Now(), batchSize)
+	if err != nil {
+		r.logger.Errorf("failed to read the outbox: %s", err)
+		return 0
+	}
+	processed := 0
+	for _, record := range records {
+		now := time.Now()
+		if ok, err := r.store.Claim(ctx, record.ID, now, now.Add(leaseDuration)); err != nil || !ok {
+			if err != nil {
+				r.logger.Errorf("failed to claim outbox record %s: %s", record.ID.Hex(), err)
+			}
+			continue
+		}
+		if err := r.dispatch(ctx, record); err != nil {
+			r.logger.Errorf("failed to update outbox record %s: %s", record.ID.Hex(), err)
+			continue
+		}
+		processed++
+	}
+	return processed
+}
+
+// dispatch calls the handlers of a record and saves the outcome.
+func (r *Relay) dispatch(ctx context.Context, record Record) error {
+	r.mu.RLock()
+	handlers := r.handlers[record.Type]
+	r.mu.RUnlock()
+
+	ctx, span := tracing.Start(ctx, "event "+record.Type)
+	defer span.End()
+	span.SetAttributes(attribute.String("event.id", record.ID.Hex()))
+	var err error
+	for _, handler := range handlers {
+		if err = call(ctx, handler, record); err != nil {
+			break
+		}
+	}
+	tracing.RecordError(span, err)
+	record.Attempts++
+	now := time.Now()
+	switch {
+	case err == nil:
+		record.Status = StatusDispatched
+		record.DispatchedAt = &now
+		record.LastError = ""
+	case record.Attempts >= maxAttempts:
+		r.logger.Errorf("giving up %s event %s after %d attempts: %s", record.Type, record.ID.Hex(), record.Attempts, err)
+		record.Status = StatusFailed
+		record.LastError = err.Error()
+	default:
+		record.NextAttemptAt = now.Add(backoff(record.Attempts))
+		record.LastError = err.Error()
+	}
+	eventsDispatched.Inc(record.Type, record.Status)
+	return r.store.Update(ctx, record)
+}
+
+// call runs a handler, turning a panic into an error so that a faulty handler does not stop the relay.
+func call(ctx context.Context, handler Handler, record Record) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("handler panic: %v", p)
+		}
+	}()
+	return handler(ctx, record)
+}
+
+// backoff returns the delay before the next attempt of a record that failed the given number of times.
+func backoff(attempts int) time.Duration {
+	delay := retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
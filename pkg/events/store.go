@@ -0,0 +1,171 @@
+package events
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ysodiqakanni/trustank-api/pkg/dbcontext"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Store persists outbox records.
+type Store interface {
+	// Add saves new records. It must use ctx so that the records are part of the transaction of the caller, if any.
+	Add(ctx context.Context, records ...Record) error
+	// Due returns up to limit records, oldest first, that are the oldest pending record of their aggregate and are
+	// due at the given time. The later records of an aggregate are held back until the earlier ones are done.
+	Due(ctx context.Context, now time.Time, limit int) ([]Record, error)
+	// Claim postpones the next attempt of a pending record due at the given time until leaseUntil, so that no
+	// other relay dispatches it meanwhile. It returns false if the record was not due or is not pending anymore.
+	Claim(ctx context.Context, id primitive.ObjectID, now, leaseUntil time.Time) (bool, error)
+	// Update saves the status of a record.
+	Update(ctx context.Context, record Record) error
+}
+
+type mongoStore struct {
+	collection *mongo.Collection
+	logger     log.Logger
+}
+
+// NewMongoStore creates a Store persisting records in the "outbox" collection.
+func NewMongoStore(db *dbcontext.DB, logger log.Logger) Store {
+	s := mongoStore{db.DB().Collection("outbox"), logger}
+	s.ensureIndexes()
+	return s
+}
+
+// ensureIndexes creates the indexes required by the store queries if they do not exist yet.
+func (s mongoStore) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "aggregate_id", Value: 1}, {Key: "_id", Value: 1}}},
+		// dispatched records are only kept for a week, for troubleshooting
+		{Keys: bson.M{"dispatched_at": 1}, Options: options.Index().SetExpireAfterSeconds(7 * 24 * 3600)},
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create outbox indexes: %v", err)
+	}
+}
+
+func (s mongoStore) Add(ctx context.Context, records ...Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(records))
+	for i, record := range records {
+		docs[i] = record
+	}
+	_, err := s.collection.InsertMany(ctx, docs)
+	return err
+}
+
+func (s mongoStore) Due(ctx context.Context, now time.Time, limit int) ([]Record, error) {
+	// the due date is checked after grouping, so that records in backoff do not crowd out the other aggregates
+	cursor, err := s.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": StatusPending}}},
+		{{Key: "$sort", Value: bson.D{{Key: "aggregate_id", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$aggregate_id", "record": bson.M{"$first": "$$ROOT"}}}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$record"}}},
+		{{Key: "$match", Value: bson.M{"next_attempt_at": bson.M{"$lte": now}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$limit", Value: limit}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var records []Record
+	err = cursor.All(ctx, &records)
+	return records, err
+}
+
+func (s mongoStore) Claim(ctx context.Context, id primitive.ObjectID, now, leaseUntil time.Time) (bool, error) {
+	filter := bson.M{"_id": id, "status": StatusPending, "next_attempt_at": bson.M{"$lte": now}}
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"next_attempt_at": leaseUntil}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (s mongoStore) Update(ctx context.Context, record Record) error {
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": record.ID}, record)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[primitive.ObjectID]Record
+}
+
+// NewMemoryStore creates a Store kept in memory. It is meant for tests, and ignores transactions.
+func NewMemoryStore() Store {
+	return &memoryStore{records: map[primitive.ObjectID]Record{}}
+}
+
+func (s *memoryStore) Add(ctx context.Context, records ...Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		s.records[record.ID] = record
+	}
+	return nil
+}
+
+func (s *memoryStore) Due(ctx context.Context, now time.Time, limit int) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	heads := map[string]Record{}
+	for _, record := range s.records {
+		head, ok := heads[record.AggregateID]
+		if record.Status == StatusPending && (!ok || record.ID.Hex() < head.ID.Hex()) {
+			heads[record.AggregateID] = record
+		}
+	}
+	var records []Record
+	for _, record := range heads {
+		if !record.NextAttemptAt.After(now) {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID.Hex() < records[j].ID.Hex() })
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+func (s *memoryStore) Claim(ctx context.Context, id primitive.ObjectID, now, leaseUntil time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[id]
+	if !ok || record.Status != StatusPending || record.NextAttemptAt.After(now) {
+		return false, nil
+	}
+	record.NextAttemptAt = leaseUntil
+	s.records[id] = record
+	return true, nil
+}
+
+func (s *memoryStore) Update(ctx context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[record.ID]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	s.records[record.ID] = record
+	return nil
+}
@@ -0,0 +1,74 @@
+// Package geocode provides address geocoding behind an interface so that no feature depends on an external service.
+package geocode
+
+import (
+	"context"
+	"errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"strings"
+	"unicode"
+)
+
+// ErrNotFound is returned when an address cannot be geocoded.
+var ErrNotFound = errors.New("geocode: address not found")
+
+// Coordinates represents a position on Earth in decimal degrees.
+type Coordinates struct {
+	Lat float64 `yaml:"lat" json:"lat"`
+	Lng float64 `yaml:"lng" json:"lng"`
+}
+
+// Geocoder converts a free-form address into coordinates.
+type Geocoder interface {
+	// Geocode returns the coordinates of the given address. ErrNotFound is returned if the address is unknown.
+	Geocode(ctx context.Context, address string) (Coordinates, error)
+}
+
+// Fixture is a known address and its coordinates.
+type Fixture struct {
+	Address     string `yaml:"address"`
+	Coordinates `yaml:",inline"`
+}
+
+type static struct {
+	entries map[string]Coordinates
+}
+
+// NewStatic creates a geocoder that resolves addresses from a fixed list of fixtures.
+// Addresses are matched case-insensitively, ignoring punctuation and extra whitespace.
+func NewStatic(fixtures ...Fixture) Geocoder {
+	entries := make(map[string]Coordinates, len(fixtures))
+	for _, f := range fixtures {
+		entries[normalize(f.Address)] = f.Coordinates
+	}
+	return static{entries}
+}
+
+// LoadStatic creates a static geocoder using the fixtures listed in the given YAML file.
+func LoadStatic(file string) (Geocoder, error) {
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var fixtures []Fixture
+	if err := yaml.Unmarshal(bytes, &fixtures); err != nil {
+		return nil, err
+	}
+	return NewStatic(fixtures...), nil
+}
+
+// Geocode returns the coordinates of a known address.
+func (g static) Geocode(ctx context.Context, address string) (Coordinates, error) {
+	if c, ok := g.entries[normalize(address)]; ok {
+		return c, nil
+	}
+	return Coordinates{}, ErrNotFound
+}
+
+// normalize lower-cases an address and reduces it to space-separated words.
+func normalize(address string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(address), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
@@ -0,0 +1,45 @@
+package geocode
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatic(t *testing.T) {
+	g := NewStatic(Fixture{"1 Main Street, Lagos", Coordinates{6.45, 3.39}})
+
+	c, err := g.Geocode(context.Background(), "  1 main street lagos ")
+	assert.Nil(t, err)
+	assert.Equal(t, Coordinates{6.45, 3.39}, c)
+
+	_, err = g.Geocode(context.Background(), "2 Main Street, Lagos")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestLoadStatic(t *testing.T) {
+	f, err := ioutil.TempFile("", "geocode*.yml")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("- address: 10 Downing Street, London\n  lat: 51.5034\n  lng: -0.1276\n")
+	f.Close()
+
+	g, err := LoadStatic(f.Name())
+	if assert.Nil(t, err) {
+		c, err := g.Geocode(context.Background(), "10 Downing Street London")
+		assert.Nil(t, err)
+		assert.Equal(t, Coordinates{51.5034, -0.1276}, c)
+	}
+
+	_, err = LoadStatic(f.Name() + ".missing")
+	assert.NotNil(t, err)
+}
+
+func Test_normalize(t *testing.T) {
+	assert.Equal(t, "12 b rue de l église paris", normalize("12-B, Rue de l'Église   PARIS"))
+}
@@ -0,0 +1,121 @@
+// Package highlight extracts search terms from user queries and highlights them in text snippets.
+package highlight
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// OpenTag and CloseTag surround every highlighted term in a snippet.
+	OpenTag  = "<mark>"
+	CloseTag = "</mark>"
+	// maxTerms limits how many terms are taken from a single query.
+	maxTerms = 10
+)
+
+// Terms splits a user query into lower-cased words, dropping punctuation, operators and duplicates.
+// The result is safe to use in text search queries because it contains only letters and digits.
+func Terms(query string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), isSeparator) {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+		if len(terms) == maxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// Snippet returns an HTML-escaped excerpt of text of about maxLen characters around the first
+// occurrence of any of the terms, with every word starting with a term wrapped in OpenTag and CloseTag.
+// False is returned if none of the terms occurs in the text.
+func Snippet(text string, terms []string, maxLen int) (string, bool) {
+	words := splitWords(text)
+	first := -1
+	for i, w := range words {
+		if w.isWord && matches(w.text, terms) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	// start a few words before the first match and stop once the snippet is long enough
+	start := first
+	for length := 0; start > 0 && length < maxLen/4; {
+		start--
+		length += utf8.RuneCountInString(words[start].text)
+	}
+	for start < first && !words[start].isWord {
+		start++
+	}
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	length, end := 0, start
+	for ; end < len(words) && (length < maxLen || end <= first); end++ {
+		w := words[end]
+		if w.isWord && matches(w.text, terms) {
+			b.WriteString(OpenTag + html.EscapeString(w.text) + CloseTag)
+		} else {
+			b.WriteString(html.EscapeString(w.text))
+		}
+		length += utf8.RuneCountInString(w.text)
+	}
+	if end < len(words) {
+		b.WriteString("…")
+	}
+	return strings.TrimSpace(b.String()), true
+}
+
+type token struct {
+	text   string
+	isWord bool
+}
+
+// splitWords splits text into alternating word and separator tokens that concatenate back into text.
+func splitWords(text string) []token {
+	var tokens []token
+	start := 0
+	for i, r := range text {
+		if i == 0 {
+			continue
+		}
+		prev, _ := utf8.DecodeLastRuneInString(text[:i])
+		if isSeparator(prev) != isSeparator(r) {
+			tokens = append(tokens, token{text[start:i], !isSeparator(prev)})
+			start = i
+		}
+	}
+	if start < len(text) {
+		last, _ := utf8.DecodeLastRuneInString(text)
+		tokens = append(tokens, token{text[start:], !isSeparator(last)})
+	}
+	return tokens
+}
+
+// matches reports whether the word starts with one of the terms, so that "bakeries" matches "bake".
+func matches(word string, terms []string) bool {
+	word = strings.ToLower(word)
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
@@ -0,0 +1,32 @@
+package highlight
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTerms(t *testing.T) {
+	assert.Equal(t, []string{"best", "pizza", "in", "lagos"}, Terms(`  Best "pizza" -in LAGOS, best!`))
+	assert.Equal(t, []string{"a", "b", "c"}, Terms(`.*a|(b)+c$`))
+	assert.Empty(t, Terms(`"" -- $^`))
+	assert.Len(t, Terms("1 2 3 4 5 6 7 8 9 10 11 12"), maxTerms)
+}
+
+func TestSnippet(t *testing.T) {
+	s, ok := Snippet("Fresh bread & cakes from the bakery", []string{"bake"}, 100)
+	assert.True(t, ok)
+	assert.Equal(t, "Fresh bread &amp; cakes from the <mark>bakery</mark>", s)
+
+	s, ok = Snippet("We are a family business. Our bakery opened in 1990 and has served <b>thousands</b> of customers since then.",
+		[]string{"bakery", "customers"}, 30)
+	assert.True(t, ok)
+	assert.Equal(t, "…business. Our <mark>bakery</mark> opened in…", s)
+
+	_, ok = Snippet("Nothing to see here", []string{"bakery"}, 30)
+	assert.False(t, ok)
+
+	s, ok = Snippet("Pâtisserie Élysée", []string{"élysée"}, 30)
+	assert.True(t, ok)
+	assert.Equal(t, "Pâtisserie <mark>Élysée</mark>", s)
+}
@@ -0,0 +1,175 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// exifSegment builds a big-endian EXIF APP1 segment holding an orientation tag and a GPS-like text tag.
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	ifd := make([]byte, 2+12*2+4)
+	binary.BigEndian.PutUint16(ifd, 2)
+	binary.BigEndian.PutUint16(ifd[2:], 0x0112)
+	binary.BigEndian.PutUint16(ifd[4:], 3)
+	binary.BigEndian.PutUint32(ifd[6:], 1)
+	binary.BigEndian.PutUint16(ifd[10:], orientation)
+	binary.BigEndian.PutUint16(ifd[14:], 0x010f)
+	binary.BigEndian.PutUint16(ifd[16:], 2)
+	binary.BigEndian.PutUint32(ifd[18:], 4)
+	copy(ifd[22:], "Cam")
+	payload := append([]byte("Exif\x00\x00"), append(tiff, ifd...)...)
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// testJPEG encodes a w x h JPEG whose left half is red, with extra segments inserted after the SOI marker.
+func testJPEG(t *testing.T, w, h int, segments ...[]byte) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}))
+	data := buf.Bytes()
+	var extra []byte
+	for _, s := range segments {
+		extra = append(extra, s...)
+	}
+	return append(append(append([]byte{}, data[:2]...), extra...), data[2:]...)
+}
+
+func TestStripMetadata_JPEG(t *testing.T) {
+	comment := []byte{0xff, 0xfe, 0, 7, 'h', 'e', 'l', 'l', 'o'}
+	data := testJPEG(t, 32, 16, exifSegment(1), comment)
+	stripped, err := StripMetadata(data)
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(stripped, []byte("Exif")))
+	assert.False(t, bytes.Contains(stripped, []byte("hello")))
+	assert.Equal(t, len(data)-len(exifSegment(1))-len(comment), len(stripped))
+	img, err := jpeg.Decode(bytes.NewReader(stripped))
+	if assert.Nil(t, err) {
+		assert.Equal(t, image.Rect(0, 0, 32, 16), img.Bounds())
+	}
+
+	// a photo taken with the camera rotated is turned upright before the orientation is removed
+	stripped, err = StripMetadata(testJPEG(t, 32, 16, exifSegment(6)))
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(stripped, []byte("Exif")))
+	img, err = jpeg.Decode(bytes.NewReader(stripped))
+	if assert.Nil(t, err) {
+		assert.Equal(t, image.Rect(0, 0, 16, 32), img.Bounds())
+		// rotating 90 degrees clockwise moves the red left half to the top
+		r, _, b, _ := img.At(8, 4).RGBA()
+		assert.True(t, r > b)
+		r, _, b, _ = img.At(8, 28).RGBA()
+		assert.True(t, b > r)
+	}
+
+	_, err = StripMetadata(data[:20])
+	assert.Equal(t, ErrInvalidImage, err)
+}
+
+func pngChunk(typ string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], typ)
+	chunk = append(chunk, data...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	return append(chunk, crc...)
+}
+
+func TestStripMetadata_PNG(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))))
+	data := buf.Bytes()
+	// insert a text chunk after the IHDR chunk
+	ihdrEnd := len(pngSignature) + 25
+	text := pngChunk("tEXt", []byte("Location\x00Lagos"))
+	withText := append(append(append([]byte{}, data[:ihdrEnd]...), text...), data[ihdrEnd:]...)
+
+	stripped, err := StripMetadata(withText)
+	assert.Nil(t, err)
+	assert.Equal(t, data, stripped)
+	_, err = png.Decode(bytes.NewReader(stripped))
+	assert.Nil(t, err)
+}
+
+func TestStripMetadata_WebP(t *testing.T) {
+	chunk := func(typ string, data string) []byte {
+		c := make([]byte, 8)
+		copy(c, typ)
+		binary.LittleEndian.PutUint32(c[4:], uint32(len(data)))
+		c = append(c, data...)
+		if len(data)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+	riff := func(chunks ...[]byte) []byte {
+		data := []byte("RIFF\x00\x00\x00\x00WEBP")
+		for _, c := range chunks {
+			data = append(data, c...)
+		}
+		binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+		return data
+	}
+	vp8x := "\x0c\x00\x00\x00\x01\x00\x00\x01\x00\x00"
+	data := riff(chunk("VP8X", vp8x), chunk("VP8L", "pixels"), chunk("EXIF", "gps"), chunk("XMP ", "<x/>"))
+
+	stripped, err := StripMetadata(data)
+	assert.Nil(t, err)
+	assert.Equal(t, riff(chunk("VP8X", "\x00"+vp8x[1:]), chunk("VP8L", "pixels")), stripped)
+}
+
+func TestStripMetadata_Other(t *testing.T) {
+	data := []byte("GIF89a...")
+	stripped, err := StripMetadata(data)
+	assert.Nil(t, err)
+	assert.Equal(t, data, stripped)
+}
+
+func TestOrient(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	img.SetGray(0, 0, color.Gray{255})
+	want := map[int]image.Point{2: {2, 0}, 3: {2, 1}, 4: {0, 1}, 5: {0, 0}, 6: {1, 0}, 7: {1, 2}, 8: {0, 2}}
+	for o, p := range want {
+		r, _, _, _ := orient(img, o).At(p.X, p.Y).RGBA()
+		assert.Equal(t, uint32(0xffff), r, "orientation %d", o)
+	}
+	assert.Equal(t, img, orient(img, 1))
+}
+
+func TestStripMetadata_TooLarge(t *testing.T) {
+	// a valid JPEG whose frame header declares 65535 x 65535 pixels
+	data := testJPEG(t, 16, 16)
+	sof := bytes.Index(data, []byte{0xff, 0xc0})
+	if !assert.True(t, sof > 0) {
+		return
+	}
+	binary.BigEndian.PutUint16(data[sof+5:], 0xffff)
+	binary.BigEndian.PutUint16(data[sof+7:], 0xffff)
+
+	// a photo is only decoded when it has to be rotated
+	_, err := StripMetadata(data)
+	assert.Nil(t, err)
+	rotated := append(append([]byte{0xff, 0xd8}, exifSegment(6)...), data[2:]...)
+	_, err = StripMetadata(rotated)
+	assert.Equal(t, ErrTooLarge, err)
+}
@@ -0,0 +1,245 @@
+// Package imaging removes metadata from uploaded images, using only the standard library.
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+)
+
+var (
+	// ErrInvalidImage is returned when an image is truncated or malformed.
+	ErrInvalidImage = errors.New("invalid image")
+	// ErrTooLarge is returned when the dimensions of an image exceed MaxPixels.
+	ErrTooLarge = errors.New("image dimensions too large")
+)
+
+const (
+	// MaxPixels is the largest number of pixels of an image that is decoded. A small file can declare huge
+	// dimensions and make the decoder allocate gigabytes.
+	MaxPixels = 50 * 1000 * 1000
+	// jpegQuality is the quality used when a JPEG image has to be encoded again.
+	jpegQuality = 90
+)
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	// pngMetadataChunks are the PNG chunks that may hold personal information such as a location or a camera serial.
+	pngMetadataChunks = map[string]bool{"tEXt": true, "zTXt": true, "iTXt": true, "eXIf": true, "tIME": true}
+)
+
+// StripMetadata removes the EXIF, XMP, IPTC and comment metadata of a JPEG, PNG or WebP image, which may reveal
+// where and with which device a photo was taken. Other formats are returned unchanged.
+// JPEG photos rotated by their EXIF orientation are rotated for real before the orientation is removed.
+func StripMetadata(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return stripJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNG(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return stripWebP(data)
+	}
+	return data, nil
+}
+
+// stripJPEG removes the metadata segments of a JPEG image, keeping the JFIF header, ICC color profile and
+// Adobe color transform segments that affect rendering.
+func stripJPEG(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	orientation := 1
+	for i := 2; ; {
+		if i+2 > len(data) || data[i] != 0xff {
+			return nil, ErrInvalidImage
+		}
+		marker := data[i+1]
+		// fill bytes and standalone markers have no length
+		if marker == 0xff {
+			i++
+			continue
+		}
+		if marker == 0x01 || marker >= 0xd0 && marker <= 0xd7 {
+			out.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			return nil, ErrInvalidImage
+		}
+		segment := data[i:end]
+		payload := segment[4:]
+		switch {
+		case marker == 0xda:
+			// start of scan: the compressed image data follows until the end of the file
+			out.Write(data[i:])
+			if orientation > 1 {
+				return reorientJPEG(out.Bytes(), orientation)
+			}
+			return out.Bytes(), nil
+		case marker == 0xe1:
+			if o, ok := exifOrientation(payload); ok {
+				orientation = o
+			}
+		case marker == 0xe0, marker == 0xee, marker == 0xe2 && bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00")):
+			out.Write(segment)
+		case marker >= 0xe3 && marker <= 0xef, marker == 0xfe:
+			// other application segments and comments
+		default:
+			out.Write(segment)
+		}
+		i = end
+	}
+}
+
+// reorientJPEG decodes a JPEG image, applies an EXIF orientation to its pixels and encodes it again.
+func reorientJPEG(data []byte, orientation int) ([]byte, error) {
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	// a small file can declare huge dimensions, so they are checked before the pixels are decoded
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, orient(img, orientation), &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// exifOrientation reads the orientation tag of the first IFD of an EXIF APP1 payload.
+func exifOrientation(payload []byte) (int, bool) {
+	if !bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+		return 0, false
+	}
+	tiff := payload[6:]
+	if len(tiff) < 8 {
+		return 0, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0, false
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0, false
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			return o, o >= 1 && o <= 8
+		}
+	}
+	return 0, false
+}
+
+// stripPNG removes the text, EXIF and modification time chunks of a PNG image.
+func stripPNG(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+	for i := len(pngSignature); i < len(data); {
+		if i+12 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i+12 {
+			return nil, ErrInvalidImage
+		}
+		if !pngMetadataChunks[string(data[i+4:i+8])] {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	return out.Bytes(), nil
+}
+
+// stripWebP removes the EXIF and XMP chunks of a WebP image and clears their flags in the extended header.
+func stripWebP(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		// chunks are padded to an even size
+		end := i + 8 + size + size%2
+		if end > len(data) || end < i+8 {
+			return nil, ErrInvalidImage
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+	return result, nil
+}
+
+// orient applies an EXIF orientation (1 to 8) to an image so that it displays upright without the tag.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,124 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// any day matches when the day of month or the day of week is "*", following the usual cron rule that a
+	// restricted day of month and day of week match when either does
+	anyDom, anyDow bool
+}
+
+// cronShortcuts maps the predefined schedules to their expressions.
+var cronShortcuts = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// ParseSchedule parses a standard five-field cron expression ("minute hour day-of-month month day-of-week"),
+// where each field is "*", a value, a range "a-b", a list "a,b" or a step "*/n" or "a-b/n". Days of week go from
+// 0 (Sunday) to 6, 7 also being Sunday. The predefined schedules @hourly, @daily, @weekly, @monthly and @yearly
+// are accepted too.
+func ParseSchedule(spec string) (Schedule, error) {
+	if s, ok := cronShortcuts[strings.TrimSpace(spec)]; ok {
+		spec = s
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("cron: expected 5 fields in %q", spec)
+	}
+	var s Schedule
+	var err error
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := []*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, field := range fields {
+		if *sets[i], err = parseField(field, bounds[i][0], bounds[i][1]); err != nil {
+			return Schedule{}, fmt.Errorf("cron: %q: %s", spec, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.anyDom, s.anyDow = fields[2] == "*", fields[4] == "*"
+	return s, nil
+}
+
+// parseField returns the set of values of a field as a bit set.
+func parseField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			step, part = n, part[:i]
+		}
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				// "a/n" means from a to the maximum
+				to = max
+			}
+			if from < min || to > max || from > to {
+				return 0, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+			}
+		}
+		for v := from; v <= to; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// Next returns the first time matching the schedule strictly after the given time, in its location.
+// The zero time is returned if nothing matches within five years, e.g. for February 30th.
+func (s Schedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, m, d := t.Date()
+		switch {
+		case s.month&(1<<uint(m)) == 0:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s Schedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.anyDom || s.anyDow {
+		return dom && dow
+	}
+	return dom || dow
+}
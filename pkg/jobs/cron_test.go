@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := ParseSchedule(spec)
+		assert.NotNil(t, err, spec)
+	}
+
+	at := func(s string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", s)
+		return t
+	}
+	tests := []struct {
+		spec  string
+		after string
+		want  string
+	}{
+		{"* * * * *", "2021-06-01 10:00", "2021-06-01 10:01"},
+		{"*/15 * * * *", "2021-06-01 10:07", "2021-06-01 10:15"},
+		{"30 2 * * *", "2021-06-01 10:00", "2021-06-02 02:30"},
+		{"@daily", "2021-12-31 23:59", "2022-01-01 00:00"},
+		{"0 9 * * 1-5", "2021-06-04 10:00", "2021-06-07 09:00"},
+		{"0 0 * * 7", "2021-06-01 00:00", "2021-06-06 00:00"},
+		{"0 0 13 * 5", "2021-06-01 00:00", "2021-06-04 00:00"},
+		{"0 0 29 2 *", "2021-03-01 00:00", "2024-02-29 00:00"},
+		{"0,30 8-9 1 */6 *", "2021-01-01 09:30", "2021-07-01 08:00"},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.spec)
+		if assert.Nil(t, err, tt.spec) {
+			assert.Equal(t, at(tt.want), schedule.Next(at(tt.after)), tt.spec)
+		}
+	}
+
+	schedule, _ := ParseSchedule("0 0 30 2 *")
+	assert.True(t, schedule.Next(at("2021-01-01 00:00")).IsZero())
+}
@@ -0,0 +1,184 @@
+// Package jobs provides a persistent background job queue.
+//
+// Jobs are enqueued with a type and a JSON payload, optionally delayed or scheduled at a given time, and run by
+// a Runner calling the handler registered for their type. A running job is leased: if its worker crashes, the
+// job becomes visible again once the lease expires and is run again. Failed jobs are retried with exponential
+// backoff, so handlers must be idempotent.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Job statuses.
+const (
+	// StatusQueued is the status of a job waiting to run, or to be retried after a failure.
+	StatusQueued = "queued"
+	// StatusRunning is the status of a job leased by a worker.
+	StatusRunning = "running"
+	// StatusSucceeded is the status of a job whose handler returned no error.
+	StatusSucceeded = "succeeded"
+	// StatusFailed is the status of a job that failed on each of its attempts.
+	StatusFailed = "failed"
+	// StatusCanceled is the status of a job canceled before it ran.
+	StatusCanceled = "canceled"
+)
+
+// DefaultMaxAttempts is the number of times a job is attempted unless the MaxAttempts option is given.
+const DefaultMaxAttempts = 5
+
+var (
+	// ErrNotFound is returned when a job does not exist.
+	ErrNotFound = errors.New("jobs: job not found")
+	// ErrDuplicate is returned when a job is enqueued with the key of an existing job.
+	ErrDuplicate = errors.New("jobs: duplicate job key")
+	// ErrStatus is returned when a job cannot be retried or canceled in its current status.
+	ErrStatus = errors.New("jobs: the job status does not allow this operation")
+)
+
+// Job is a unit of background work.
+type Job struct {
+	ID   primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Type string             `json:"type" bson:"type"`
+	// Payload is the argument of the job encoded in JSON.
+	Payload string `json:"payload" bson:"payload"`
+	// Key optionally identifies the job so that it is not enqueued twice.
+	Key         string `json:"key,omitempty" bson:"key,omitempty"`
+	Status      string `json:"status" bson:"status"`
+	Attempts    int    `json:"attempts" bson:"attempts"`
+	MaxAttempts int    `json:"max_attempts" bson:"max_attempts"`
+	// RunAt is when a queued job is due, or when the lease of a running job expires.
+	RunAt      time.Time  `json:"run_at" bson:"run_at"`
+	LastError  string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty" bson:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+}
+
+// Decode decodes the payload of the job.
+func (j Job) Decode(payload interface{}) error {
+	return json.Unmarshal([]byte(j.Payload), payload)
+}
+
+// Option configures a job being enqueued.
+type Option func(*Job)
+
+// Delay runs the job after the given delay.
+func Delay(d time.Duration) Option {
+	return func(j *Job) { j.RunAt = time.Now().Add(d) }
+}
+
+// At runs the job at the given time.
+func At(t time.Time) Option {
+	return func(j *Job) { j.RunAt = t }
+}
+
+// MaxAttempts sets the number of times the job is attempted before it fails.
+func MaxAttempts(n int) Option {
+	return func(j *Job) { j.MaxAttempts = n }
+}
+
+// Key identifies the job so that enqueuing another job with the same key returns ErrDuplicate.
+func Key(key string) Option {
+	return func(j *Job) { j.Key = key }
+}
+
+// Filter selects jobs. Empty fields match every job.
+type Filter struct {
+	Type   string
+	Status string
+}
+
+// Queue enqueues and manages jobs.
+type Queue struct {
+	store Store
+}
+
+// NewQueue creates a Queue storing jobs in the given store.
+func NewQueue(store Store) *Queue {
+	return &Queue{store}
+}
+
+// Enqueue adds a job of the given type. The payload is encoded in JSON.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}, opts ...Option) (Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Job{}, err
+	}
+	now := time.Now()
+	job := Job{
+		Type:        jobType,
+		Payload:     string(data),
+		Status:      StatusQueued,
+		MaxAttempts: DefaultMaxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+	}
+	for _, opt := range opts {
+		opt(&job)
+	}
+	job.ID, err = q.store.Add(ctx, job)
+	return job, err
+}
+
+// Get returns the job with the specified ID.
+func (q *Queue) Get(ctx context.Context, id primitive.ObjectID) (Job, error) {
+	return q.store.Get(ctx, id)
+}
+
+// Query returns the jobs matching the filter, newest first.
+func (q *Queue) Query(ctx context.Context, filter Filter, offset, limit int) ([]Job, error) {
+	return q.store.Query(ctx, filter, offset, limit)
+}
+
+// Count returns the number of jobs matching the filter.
+func (q *Queue) Count(ctx context.Context, filter Filter) (int, error) {
+	return q.store.Count(ctx, filter)
+}
+
+// Retry queues a failed or canceled job again, restarting its attempts.
+func (q *Queue) Retry(ctx context.Context, id primitive.ObjectID) (Job, error) {
+	job, err := q.store.Get(ctx, id)
+	if err != nil {
+		return Job{}, err
+	}
+	if job.Status != StatusFailed && job.Status != StatusCanceled {
+		return Job{}, ErrStatus
+	}
+	next := job
+	next.Status = StatusQueued
+	next.Attempts = 0
+	next.RunAt = time.Now()
+	next.FinishedAt = nil
+	return next, q.swap(ctx, job, next)
+}
+
+// Cancel cancels a queued job. Running jobs cannot be canceled.
+func (q *Queue) Cancel(ctx context.Context, id primitive.ObjectID) (Job, error) {
+	job, err := q.store.Get(ctx, id)
+	if err != nil {
+		return Job{}, err
+	}
+	if job.Status != StatusQueued {
+		return Job{}, ErrStatus
+	}
+	now := time.Now()
+	next := job
+	next.Status = StatusCanceled
+	next.FinishedAt = &now
+	return next, q.swap(ctx, job, next)
+}
+
+// swap saves a job, reporting a concurrent change of its status as ErrStatus.
+func (q *Queue) swap(ctx context.Context, old, job Job) error {
+	ok, err := q.store.CompareAndSwap(ctx, old, job)
+	if err == nil && !ok {
+		err = ErrStatus
+	}
+	return err
+}
@@ -0,0 +1,214 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type export struct {
+	BusinessID string `json:"business_id"`
+}
+
+// due makes the job due now, as if its retry delay or lease had elapsed.
+func due(t *testing.T, store Store, id primitive.ObjectID) {
+	job, _ := store.Get(context.Background(), id)
+	next := job
+	next.RunAt = time.Now().Add(-time.Second)
+	ok, err := store.CompareAndSwap(context.Background(), job, next)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+}
+
+func TestRunner(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	store := NewMemoryStore()
+	queue := NewQueue(store)
+	runner := NewRunner(store, logger)
+
+	var exported []string
+	failures := 1
+	runner.Handle("export", func(ctx context.Context, job Job) error {
+		var payload export
+		if err := job.Decode(&payload); err != nil {
+			return err
+		}
+		if failures > 0 {
+			failures--
+			return errors.New("storage down")
+		}
+		exported = append(exported, payload.BusinessID)
+		return nil
+	}, time.Minute)
+
+	// delayed jobs wait
+	delayed, err := queue.Enqueue(ctx, "export", export{"2"}, Delay(time.Hour))
+	assert.Nil(t, err)
+	job, err := queue.Enqueue(ctx, "export", export{"1"}, Key("export:1"))
+	assert.Nil(t, err)
+	_, err = queue.Enqueue(ctx, "export", export{"1"}, Key("export:1"))
+	assert.Equal(t, ErrDuplicate, err)
+
+	// failures are retried later
+	assert.True(t, runner.runNext(ctx))
+	job, _ = queue.Get(ctx, job.ID)
+	assert.Equal(t, StatusQueued, job.Status)
+	assert.Equal(t, "storage down", job.LastError)
+	assert.True(t, job.RunAt.After(time.Now().Add(20*time.Second)))
+	assert.False(t, runner.runNext(ctx))
+
+	due(t, store, job.ID)
+	assert.True(t, runner.runNext(ctx))
+	job, _ = queue.Get(ctx, job.ID)
+	assert.Equal(t, StatusSucceeded, job.Status)
+	assert.Equal(t, 2, job.Attempts)
+	assert.Equal(t, []string{"1"}, exported)
+
+	// queued jobs can be canceled, and canceled or failed jobs retried
+	_, err = queue.Cancel(ctx, job.ID)
+	assert.Equal(t, ErrStatus, err)
+	_, err = queue.Cancel(ctx, delayed.ID)
+	assert.Nil(t, err)
+	_, err = queue.Retry(ctx, delayed.ID)
+	assert.Nil(t, err)
+	assert.True(t, runner.runNext(ctx))
+	assert.Equal(t, []string{"1", "2"}, exported)
+	_, err = queue.Retry(ctx, primitive.NewObjectID())
+	assert.Equal(t, ErrNotFound, err)
+
+	count, _ := queue.Count(ctx, Filter{Status: StatusSucceeded})
+	assert.Equal(t, 2, count)
+	jobs, _ := queue.Query(ctx, Filter{Type: "export"}, 0, 1)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, job.ID, jobs[0].ID)
+	}
+}
+
+func TestRunner_Lease(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	store := NewMemoryStore()
+	runner := NewRunner(store, logger)
+	runner.Handle("digest", func(ctx context.Context, job Job) error { return nil }, 30*time.Minute)
+
+	var leased time.Time
+	runner.Handle("email", func(ctx context.Context, job Job) error {
+		current, _ := store.Get(ctx, job.ID)
+		leased = current.RunAt
+		return nil
+	}, time.Minute)
+	job, _ := NewQueue(store).Enqueue(ctx, "email", "a")
+
+	// the job is leased for its own timeout, not for the longest one
+	assert.True(t, runner.runNext(ctx))
+	assert.True(t, leased.Before(time.Now().Add(time.Minute+leaseMargin)))
+	assert.True(t, leased.After(time.Now().Add(time.Minute)))
+	job, _ = store.Get(ctx, job.ID)
+	assert.Equal(t, StatusSucceeded, job.Status)
+}
+
+func TestRunner_Failures(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	store := NewMemoryStore()
+	queue := NewQueue(store)
+	runner := NewRunner(store, logger)
+	runner.Handle("recompute", func(ctx context.Context, job Job) error {
+		panic("boom")
+	}, 0)
+
+	job, _ := queue.Enqueue(ctx, "recompute", nil, MaxAttempts(2))
+	assert.True(t, runner.runNext(ctx))
+	due(t, store, job.ID)
+	assert.True(t, runner.runNext(ctx))
+	job, _ = queue.Get(ctx, job.ID)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Equal(t, "handler panic: boom", job.LastError)
+
+	// a job whose worker crashed is claimed again once its lease expires
+	job, _ = queue.Enqueue(ctx, "recompute", nil)
+	claimed, ok, _ := store.Claim(ctx, []string{"recompute"}, time.Now(), time.Now().Add(time.Minute))
+	assert.True(t, ok)
+	assert.False(t, runner.runNext(ctx))
+	due(t, store, job.ID)
+	assert.True(t, runner.runNext(ctx))
+	job, _ = queue.Get(ctx, job.ID)
+	assert.Equal(t, claimed.Attempts+1, job.Attempts)
+
+	// jobs without handlers are left alone
+	unknown, _ := queue.Enqueue(ctx, "unknown", nil)
+	assert.False(t, runner.runNext(ctx))
+	unknown, _ = queue.Get(ctx, unknown.ID)
+	assert.Equal(t, StatusQueued, unknown.Status)
+}
+
+func TestRunner_Schedule(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	store := NewMemoryStore()
+	runner := NewRunner(store, logger)
+	other := NewRunner(store, logger)
+
+	assert.NotNil(t, runner.Schedule("every day", "digest", nil))
+	assert.Nil(t, runner.Schedule("@hourly", "digest", nil))
+	assert.Nil(t, other.Schedule("@hourly", "digest", nil))
+	runner.enqueueRecurring(ctx)
+	count, _ := store.Count(ctx, Filter{})
+	assert.Equal(t, 0, count)
+
+	// pretend the next occurrence is due for both runners, it is enqueued once
+	next := runner.recurring[0].next
+	runner.recurring[0].next = next.Add(-time.Hour)
+	other.recurring[0].next = next.Add(-time.Hour)
+	runner.enqueueRecurring(ctx)
+	other.enqueueRecurring(ctx)
+	count, _ = store.Count(ctx, Filter{Type: "digest"})
+	assert.Equal(t, 1, count)
+	assert.Equal(t, next, runner.recurring[0].next)
+}
+
+func TestRunner_Run(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := NewMemoryStore()
+	runner := NewRunner(store, logger)
+	done := make(chan string, 3)
+	runner.Handle("email", func(ctx context.Context, job Job) error {
+		var to string
+		job.Decode(&to)
+		done <- to
+		return nil
+	}, time.Second)
+	for _, to := range []string{"a", "b", "c"} {
+		NewQueue(store).Enqueue(context.Background(), "email", to)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		runner.Run(ctx, 2, 5*time.Millisecond)
+		close(stopped)
+	}()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("the jobs did not run")
+		}
+	}
+	cancel()
+	<-stopped
+	count, _ := store.Count(context.Background(), Filter{Status: StatusSucceeded})
+	assert.Equal(t, 3, count)
+}
+
+func Test_backoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, backoff(1))
+	assert.Equal(t, 2*time.Minute, backoff(3))
+	assert.Equal(t, time.Hour, backoff(30))
+}
@@ -0,0 +1,121 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/ysodiqakanni/trustank-api/pkg/dbcontext"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoStore struct {
+	collection *mongo.Collection
+	logger     log.Logger
+}
+
+// NewMongoStore creates a Store persisting jobs in the "jobs" collection.
+func NewMongoStore(db *dbcontext.DB, logger log.Logger) Store {
+	s := mongoStore{db.DB().Collection("jobs"), logger}
+	s.ensureIndexes()
+	return s
+}
+
+// ensureIndexes creates the indexes required by the store queries if they do not exist yet.
+func (s mongoStore) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "run_at", Value: 1}}},
+		{Keys: bson.M{"type": 1}},
+		{Keys: bson.M{"key": 1}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		// succeeded jobs are only kept for a week, failed ones stay until they are retried
+		{
+			Keys: bson.M{"finished_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(7 * 24 * 3600).
+				SetPartialFilterExpression(bson.M{"status": StatusSucceeded}),
+		},
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create job indexes: %v", err)
+	}
+}
+
+func (s mongoStore) Add(ctx context.Context, job Job) (primitive.ObjectID, error) {
+	result, err := s.collection.InsertOne(ctx, job)
+	if mongo.IsDuplicateKeyError(err) {
+		return primitive.NilObjectID, ErrDuplicate
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return result.InsertedID.(primitive.ObjectID), nil
+}
+
+func (s mongoStore) Get(ctx context.Context, id primitive.ObjectID) (Job, error) {
+	var job Job
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return Job{}, ErrNotFound
+	}
+	return job, err
+}
+
+func (s mongoStore) Query(ctx context.Context, filter Filter, offset, limit int) ([]Job, error) {
+	opts := options.Find().SetSort(bson.M{"_id": -1}).SetSkip(int64(offset)).SetLimit(int64(limit))
+	cursor, err := s.collection.Find(ctx, s.filter(filter), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	jobs := []Job{}
+	err = cursor.All(ctx, &jobs)
+	return jobs, err
+}
+
+func (s mongoStore) Count(ctx context.Context, filter Filter) (int, error) {
+	count, err := s.collection.CountDocuments(ctx, s.filter(filter))
+	return int(count), err
+}
+
+func (s mongoStore) Claim(ctx context.Context, types []string, now, leaseUntil time.Time) (Job, bool, error) {
+	filter := bson.M{
+		"type":   bson.M{"$in": types},
+		"status": bson.M{"$in": []string{StatusQueued, StatusRunning}},
+		"run_at": bson.M{"$lte": now},
+	}
+	update := bson.M{
+		"$set": bson.M{"status": StatusRunning, "run_at": leaseUntil, "started_at": now},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.M{"run_at": 1}).SetReturnDocument(options.After)
+	var job Job
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return Job{}, false, nil
+	}
+	return job, err == nil, err
+}
+
+func (s mongoStore) CompareAndSwap(ctx context.Context, old, job Job) (bool, error) {
+	filter := bson.M{"_id": old.ID, "status": old.Status, "attempts": old.Attempts}
+	result, err := s.collection.ReplaceOne(ctx, filter, job)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+func (s mongoStore) filter(filter Filter) bson.M {
+	query := bson.M{}
+	if filter.Type != "" {
+		query["type"] = filter.Type
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	return query
+}
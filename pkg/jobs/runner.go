@@ -0,0 +1,280 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"github.com/ysodiqakanni/trustank-api/pkg/metrics"
+	"github.com/ysodiqakanni/trustank-api/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// DefaultTimeout is how long a handler may run unless another timeout is given when it is registered.
+	DefaultTimeout = 5 * time.Minute
+	// leaseMargin is added to the timeout of a handler to get the lease of its jobs, so that a job is not claimed
+	// again while its handler is still returning.
+	leaseMargin = 30 * time.Second
+	// retryDelay is the delay before the first retry of a job. It doubles after each attempt.
+	retryDelay = 30 * time.Second
+	// maxRetryDelay is the longest delay between two attempts of a job.
+	maxRetryDelay = time.Hour
+)
+
+var (
+	jobsProcessed = metrics.NewCounter("jobs_processed_total", "Number of job attempts by type and resulting status.", "type", "status")
+	jobDuration   = metrics.NewHistogram("job_duration_seconds", "Duration of job attempts by type.",
+		[]float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300}, "type")
+)
+
+// Handler runs a job. The payload of the job can be decoded with Job.Decode. The context is canceled once the
+// timeout of the handler elapses.
+type Handler func(ctx context.Context, job Job) error
+
+type registration struct {
+	handler Handler
+	timeout time.Duration
+}
+
+// recurring is a job enqueued on a cron schedule.
+type recurring struct {
+	spec     string
+	schedule Schedule
+	jobType  string
+	payload  string
+	next     time.Time
+}
+
+// Runner runs the jobs of a store with the registered handlers.
+type Runner struct {
+	store     Store
+	logger    log.Logger
+	mu        sync.RWMutex
+	handlers  map[string]registration
+	recurring []*recurring
+}
+
+// NewRunner creates a Runner running the jobs of the given store.
+func NewRunner(store Store, logger log.Logger) *Runner {
+	return &Runner{store: store, logger: logger, handlers: map[string]registration{}}
+}
+
+// Handle registers the handler of a job type. A zero timeout means DefaultTimeout.
+func (r *Runner) Handle(jobType string, handler Handler, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[jobType] = registration{handler, timeout}
+}
+
+// Schedule enqueues a job of the given type each time the cron expression matches, in UTC. When several runners
+// share a store, the job is enqueued once per occurrence. Occurrences missed while no runner was running are
+// not caught up.
+func (r *Runner) Schedule(spec, jobType string, payload interface{}) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recurring = append(r.recurring, &recurring{spec, schedule, jobType, string(data), schedule.Next(time.Now().UTC())})
+	return nil
+}
+
+// Run runs jobs with the given number of workers, each polling the store at the given interval when it is idle,
+// until the context is canceled. It returns once the jobs being run are finished.
+func (r *Runner) Run(ctx context.Context, workers int, interval time.Duration) {
+	var wg sync.WaitGroup
+	wg.Add(workers + 1)
+	go func() {
+		defer wg.Done()
+		r.poll(ctx, interval, r.enqueueRecurring)
+	}()
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			r.poll(ctx, interval, func(ctx context.Context) {
+				// keep working while there are due jobs
+				for ctx.Err() == nil && r.runNext(ctx) {
+				}
+			})
+		}()
+	}
+	wg.Wait()
+}
+
+// poll calls f at the given interval until the context is canceled.
+func (r *Runner) poll(ctx context.Context, interval time.Duration, f func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f(ctx)
+		}
+	}
+}
+
+// enqueueRecurring enqueues the recurring jobs that are due. The key of the job is made of its schedule and its
+// time, so that other runners sharing the store do not enqueue it again.
+func (r *Runner) enqueueRecurring(ctx context.Context) {
+	now := time.Now().UTC()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rec := range r.recurring {
+		if rec.next.IsZero() || rec.next.After(now) {
+			continue
+		}
+		job := Job{
+			Type:        rec.jobType,
+			Payload:     rec.payload,
+			Key:         "cron:" + rec.jobType + ":" + rec.spec + ":" + strconv.FormatInt(rec.next.Unix(), 10),
+			Status:      StatusQueued,
+			MaxAttempts: DefaultMaxAttempts,
+			RunAt:       rec.next,
+			CreatedAt:   now,
+		}
+		if _, err := r.store.Add(ctx, job); err != nil && err != ErrDuplicate {
+			r.logger.Errorf("failed to enqueue recurring %s job: %s", rec.jobType, err)
+			continue
+		}
+		rec.next = rec.schedule.Next(now)
+	}
+}
+
+// runNext claims and runs a due job. It returns false if no job was due.
+func (r *Runner) runNext(ctx context.Context) bool {
+	r.mu.RLock()
+	types := make([]string, 0, len(r.handlers))
+	for t := range r.handlers {
+		types = append(types, t)
+	}
+	r.mu.RUnlock()
+	if len(types) == 0 {
+		return false
+	}
+
+	now := time.Now()
+	// the claim covers the longest timeout, as the type of the job is not known before it is claimed. The lease is
+	// then shortened to the timeout of the job, so that the job of a crashed worker is retried soon.
+	job, ok, err := r.store.Claim(ctx, types, now, now.Add(r.maxTimeout()+leaseMargin))
+	if err != nil {
+		r.logger.Errorf("failed to claim a job: %s", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	leased := job
+	leased.RunAt = now.Add(r.timeout(job.Type) + leaseMargin)
+	if ok, err := r.store.CompareAndSwap(ctx, job, leased); err != nil {
+		r.logger.Errorf("failed to lease %s job %s: %s", job.Type, job.ID.Hex(), err)
+	} else if ok {
+		job = leased
+	}
+	r.run(job)
+	return true
+}
+
+// run runs a claimed job and saves its outcome. The job runs to the end even if the runner is stopped meanwhile.
+func (r *Runner) run(job Job) {
+	r.mu.RLock()
+	reg := r.handlers[job.Type]
+	r.mu.RUnlock()
+
+	var err error
+	// a job whose lease expired too many times, e.g. because it crashes its worker, is not run again
+	if job.Attempts > job.MaxAttempts {
+		err = fmt.Errorf("the job was interrupted %d times", job.Attempts-1)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), reg.timeout)
+		ctx, span := tracing.Start(ctx, "job "+job.Type)
+		span.SetAttributes(attribute.String("job.id", job.ID.Hex()), attribute.Int("job.attempt", job.Attempts))
+		start := time.Now()
+		err = call(ctx, reg.handler, job)
+		jobDuration.Observe(time.Since(start).Seconds(), job.Type)
+		tracing.RecordError(span, err)
+		span.End()
+		cancel()
+	}
+
+	next := job
+	now := time.Now()
+	switch {
+	case err == nil:
+		next.Status = StatusSucceeded
+		next.FinishedAt = &now
+		next.LastError = ""
+	case job.Attempts >= job.MaxAttempts:
+		r.logger.Errorf("%s job %s failed after %d attempts: %s", job.Type, job.ID.Hex(), job.Attempts, err)
+		next.Status = StatusFailed
+		next.FinishedAt = &now
+		next.LastError = err.Error()
+	default:
+		next.Status = StatusQueued
+		next.RunAt = now.Add(backoff(job.Attempts))
+		next.LastError = err.Error()
+	}
+	jobsProcessed.Inc(job.Type, next.Status)
+	ok, err := r.store.CompareAndSwap(context.Background(), job, next)
+	if err != nil {
+		r.logger.Errorf("failed to save %s job %s: %s", job.Type, job.ID.Hex(), err)
+	} else if !ok {
+		r.logger.Errorf("%s job %s ran past its lease and was claimed again", job.Type, job.ID.Hex())
+	}
+}
+
+// timeout returns the timeout of the handler of a job type.
+func (r *Runner) timeout(jobType string) time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.handlers[jobType].timeout
+}
+
+// maxTimeout returns the longest timeout of the registered handlers.
+func (r *Runner) maxTimeout() time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	max := time.Duration(0)
+	for _, reg := range r.handlers {
+		if reg.timeout > max {
+			max = reg.timeout
+		}
+	}
+	return max
+}
+
+// call runs a handler, turning a panic into an error so that a faulty handler does not stop its worker.
+func call(ctx context.Context, handler Handler, job Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("handler panic: %v", p)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// backoff returns the delay before the next attempt of a job that failed the given number of times.
+func backoff(attempts int) time.Duration {
+	delay := retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
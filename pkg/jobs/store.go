@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Store persists jobs.
+type Store interface {
+	// Add saves a new job and returns its ID. ErrDuplicate is returned if a job with the same key exists.
+	Add(ctx context.Context, job Job) (primitive.ObjectID, error)
+	// Get returns the job with the specified ID, or ErrNotFound.
+	Get(ctx context.Context, id primitive.ObjectID) (Job, error)
+	// Query returns the jobs matching the filter, newest first.
+	Query(ctx context.Context, filter Filter, offset, limit int) ([]Job, error)
+	// Count returns the number of jobs matching the filter.
+	Count(ctx context.Context, filter Filter) (int, error)
+	// Claim leases the job of one of the given types that is due the earliest: a queued job due at the given
+	// time, or a running job whose lease expired. The job is marked as running until leaseUntil and its attempts
+	// are incremented. It returns false if no job is due.
+	Claim(ctx context.Context, types []string, now, leaseUntil time.Time) (Job, bool, error)
+	// CompareAndSwap replaces a job with job if its status and attempts are still those of old. It returns false
+	// if the job changed meanwhile, for example because its lease expired and another worker claimed it.
+	CompareAndSwap(ctx context.Context, old, job Job) (bool, error)
+}
+
+type memoryStore struct {
+	mu   sync.Mutex
+	jobs map[primitive.ObjectID]Job
+}
+
+// NewMemoryStore creates a Store kept in memory. It is meant for tests.
+func NewMemoryStore() Store {
+	return &memoryStore{jobs: map[primitive.ObjectID]Job{}}
+}
+
+func (s *memoryStore) Add(ctx context.Context, job Job) (primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.Key != "" {
+		for _, j := range s.jobs {
+			if j.Key == job.Key {
+				return primitive.NilObjectID, ErrDuplicate
+			}
+		}
+	}
+	job.ID = primitive.NewObjectID()
+	s.jobs[job.ID] = job
+	return job.ID, nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, id primitive.ObjectID) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.jobs[id]; ok {
+		return job, nil
+	}
+	return Job{}, ErrNotFound
+}
+
+func (s *memoryStore) Query(ctx context.Context, filter Filter, offset, limit int) ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := []Job{}
+	for _, job := range s.jobs {
+		if (filter.Type == "" || job.Type == filter.Type) && (filter.Status == "" || job.Status == filter.Status) {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID.Hex() > jobs[j].ID.Hex() })
+	if offset > len(jobs) {
+		offset = len(jobs)
+	}
+	jobs = jobs[offset:]
+	if limit >= 0 && limit < len(jobs) {
+		jobs = jobs[:limit]
+	}
+	return jobs, nil
+}
+
+func (s *memoryStore) Count(ctx context.Context, filter Filter) (int, error) {
+	jobs, err := s.Query(ctx, filter, 0, -1)
+	return len(jobs), err
+}
+
+func (s *memoryStore) Claim(ctx context.Context, types []string, now, leaseUntil time.Time) (Job, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found *Job
+	for _, job := range s.jobs {
+		job := job
+		if (job.Status != StatusQueued && job.Status != StatusRunning) || job.RunAt.After(now) || !contains(types, job.Type) {
+			continue
+		}
+		if found == nil || job.RunAt.Before(found.RunAt) {
+			found = &job
+		}
+	}
+	if found == nil {
+		return Job{}, false, nil
+	}
+	found.Status = StatusRunning
+	found.Attempts++
+	found.RunAt = leaseUntil
+	found.StartedAt = &now
+	s.jobs[found.ID] = *found
+	return *found, true, nil
+}
+
+func (s *memoryStore) CompareAndSwap(ctx context.Context, old, job Job) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.jobs[old.ID]
+	if !ok || current.Status != old.Status || current.Attempts != old.Attempts {
+		return false, nil
+	}
+	s.jobs[old.ID] = job
+	return true, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
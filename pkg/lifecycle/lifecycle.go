@@ -0,0 +1,132 @@
+// Package lifecycle runs the background workers of the application and shuts the application down gracefully.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+)
+
+// Manager tracks whether the application is ready to serve requests and the background workers it runs.
+type Manager struct {
+	logger  log.Logger
+	ready   int32
+	mu      sync.Mutex
+	workers []*worker
+}
+
+type worker struct {
+	name   string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a Manager. The application is not ready until SetReady is called.
+func New(logger log.Logger) *Manager {
+	return &Manager{logger: logger}
+}
+
+// Ready returns whether the application is ready to serve requests.
+func (m *Manager) Ready() bool {
+	return atomic.LoadInt32(&m.ready) == 1
+}
+
+// SetReady sets whether the application is ready to serve requests.
+func (m *Manager) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&m.ready, v)
+}
+
+// CheckServer returns an error when the application is not ready to serve requests, such as while it drains them
+// before shutting down.
+func (m *Manager) CheckServer(ctx context.Context) error {
+	if !m.Ready() {
+		return errors.New("not ready")
+	}
+	return nil
+}
+
+// CheckWorkers returns an error listing the background workers that are no longer running.
+func (m *Manager) CheckWorkers(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var stopped []string
+	for _, w := range m.workers {
+		select {
+		case <-w.done:
+			stopped = append(stopped, w.name)
+		default:
+		}
+	}
+	if len(stopped) > 0 {
+		return errors.New("stopped: " + strings.Join(stopped, ", "))
+	}
+	return nil
+}
+
+// Go runs a background worker until the application shuts down. The worker must return once its context is
+// canceled, after finishing the work in progress.
+func (m *Manager) Go(name string, run func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &worker{name: name, cancel: cancel, done: make(chan struct{})}
+	m.mu.Lock()
+	m.workers = append(m.workers, w)
+	m.mu.Unlock()
+	go func() {
+		defer close(w.done)
+		run(ctx)
+	}()
+}
+
+// Shutdown gracefully shuts the application down before the context is done:
+//
+//  1. the application reports that it is not ready, and keeps serving requests for the given delay so that
+//     load balancers stop sending it new ones;
+//  2. the server stops accepting connections and waits for the requests in progress;
+//  3. the background workers are stopped one at a time, in the reverse order of their start, so that a worker
+//     is stopped before the ones it may depend on.
+//
+// Workers still running when the context is done are abandoned, and the error of the context is returned.
+func (m *Manager) Shutdown(ctx context.Context, server *http.Server, delay time.Duration) error {
+	m.SetReady(false)
+	if delay > 0 {
+		m.logger.Infof("waiting %s before shutting down the server", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	m.mu.Lock()
+	workers := m.workers
+	m.mu.Unlock()
+	var result error
+	if err := server.Shutdown(ctx); err != nil {
+		m.logger.Errorf("failed to shut down the server: %s", err)
+		result = err
+	}
+
+	for i := len(workers) - 1; i >= 0; i-- {
+		w := workers[i]
+		w.cancel()
+		select {
+		case <-w.done:
+			m.logger.Infof("stopped %s", w.name)
+		case <-ctx.Done():
+			m.logger.Errorf("gave up waiting for %s to stop", w.name)
+			if result == nil {
+				result = ctx.Err()
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,72 @@
+package lifecycle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+)
+
+func TestManager_Shutdown(t *testing.T) {
+	logger, _ := log.NewForTest()
+	m := New(logger)
+	assert.False(t, m.Ready())
+	assert.NotNil(t, m.CheckServer(context.Background()))
+	m.SetReady(true)
+	assert.True(t, m.Ready())
+	assert.Nil(t, m.CheckServer(context.Background()))
+
+	var mu sync.Mutex
+	var order []string
+	record := func(step string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, step)
+	}
+	for _, name := range []string{"relay", "jobs"} {
+		name := name
+		m.Go(name, func(ctx context.Context) {
+			<-ctx.Done()
+			// finishing the work in progress
+			time.Sleep(10 * time.Millisecond)
+			record(name)
+		})
+	}
+
+	// a request in progress when the shutdown starts is served
+	started, release := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-release
+		assert.False(t, m.Ready())
+		record("request")
+	}))
+	defer server.Close()
+	go http.Get(server.URL)
+	<-started
+	time.AfterFunc(20*time.Millisecond, func() { close(release) })
+
+	assert.Nil(t, m.CheckWorkers(context.Background()))
+	assert.Nil(t, m.Shutdown(context.Background(), server.Config, 10*time.Millisecond))
+	assert.Equal(t, []string{"request", "jobs", "relay"}, order)
+	assert.EqualError(t, m.CheckWorkers(context.Background()), "stopped: relay, jobs")
+}
+
+func TestManager_Shutdown_timeout(t *testing.T) {
+	logger, _ := log.NewForTest()
+	m := New(logger)
+	m.Go("stuck", func(ctx context.Context) {
+		select {}
+	})
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, m.Shutdown(ctx, server.Config, 0))
+}
@@ -4,6 +4,7 @@ package log
 import (
 	"context"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"go.uber.org/zap/zaptest/observer"
@@ -62,6 +63,7 @@ func NewForTest() (Logger, *observer.ObservedLogs) {
 //
 // If the context contains request ID and/or correlation ID information (recorded via WithRequestID()
 // and WithCorrelationID()), they will be added to every log message generated by the new logger.
+// So will the trace and span IDs of the span in the context, if any.
 //
 // The arguments should be specified as a sequence of name, value pairs with names being strings.
 // The arguments will also be added to every log message generated by the logger.
@@ -73,6 +75,9 @@ func (l *logger) With(ctx context.Context, args ...interface{}) Logger {
 		if id, ok := ctx.Value(correlationIDKey).(string); ok {
 			args = append(args, zap.String("correlation_id", id))
 		}
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			args = append(args, zap.String("trace_id", sc.TraceID().String()), zap.String("span_id", sc.SpanID().String()))
+		}
 	}
 	if len(args) > 0 {
 		return &logger{l.SugaredLogger.With(args...)}
@@ -93,6 +98,14 @@ func WithRequest(ctx context.Context, req *http.Request) context.Context {
 	return ctx
 }
 
+// Middleware is a router middleware recording the request ID and correlation ID of each request in its context,
+// as WithRequest does.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req.WithContext(WithRequest(req.Context(), req)))
+	})
+}
+
 // getCorrelationID extracts the correlation ID from the HTTP request
 func getCorrelationID(req *http.Request) string {
 	return req.Header.Get("X-Correlation-ID")
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 )
@@ -57,6 +59,33 @@ func Test_logger_With(t *testing.T) {
 	assert.False(t, reflect.DeepEqual(l3, l2))
 }
 
+func Test_logger_With_span(t *testing.T) {
+	l, entries := NewForTest()
+	l.With(context.Background()).Info("msg")
+	fields := entries.TakeAll()[0].ContextMap()
+	assert.NotContains(t, fields, "trace_id")
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	l.With(ctx).Info("msg")
+	fields = entries.TakeAll()[0].ContextMap()
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", fields["trace_id"])
+	assert.Equal(t, "00f067aa0ba902b7", fields["span_id"])
+}
+
+func TestMiddleware(t *testing.T) {
+	var ctx context.Context
+	Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx = req.Context()
+	})).ServeHTTP(httptest.NewRecorder(), buildRequest("abc", "123"))
+	assert.Equal(t, "abc", ctx.Value(requestIDKey).(string))
+	assert.Equal(t, "123", ctx.Value(correlationIDKey).(string))
+}
+
 func buildRequest(requestID, correlationID string) *http.Request {
 	req, _ := http.NewRequest("GET", "http://example.com", bytes.NewBufferString(""))
 	if requestID != "" {
@@ -0,0 +1,42 @@
+// Package mailer sends emails.
+//
+// Messages are rendered from localized templates, and are sent by SMTP, written to an mbox file during development
+// or logged. In production, they are sent through the job queue so that callers never wait for the mail server,
+// and addresses that bounced or unsubscribed are suppressed.
+package mailer
+
+import (
+	"context"
+
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+)
+
+// Message is an email message.
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	// Text is the plain text body. HTML is an optional alternative HTML body.
+	Text string `json:"text"`
+	HTML string `json:"html,omitempty"`
+	// Headers holds extra headers such as List-Unsubscribe.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Mailer sends email messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type logMailer struct {
+	logger log.Logger
+}
+
+// NewLog creates a Mailer that logs messages instead of sending them. It is meant for development.
+func NewLog(logger log.Logger) Mailer {
+	return logMailer{logger}
+}
+
+func (m logMailer) Send(ctx context.Context, msg Message) error {
+	m.logger.With(ctx).Infof("email to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
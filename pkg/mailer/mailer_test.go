@@ -0,0 +1,207 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ysodiqakanni/trustank-api/pkg/jobs"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+)
+
+// writeFiles creates files with the given contents under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"en/layout.txt":   `{{template "content" .}}{{block "footer" .}} -- Trustank{{end}}`,
+		"en/layout.html":  `<body>{{template "content" .}}</body>`,
+		"en/welcome.txt":  `{{define "subject"}}Welcome {{.}}{{end}}{{define "content"}}Hello {{.}}{{end}}`,
+		"en/welcome.html": `{{define "content"}}<p>Hello {{.}}</p>{{end}}`,
+		"en/reset.txt":    `{{define "subject"}}Reset{{end}}{{define "content"}}Reset it{{end}}{{define "footer"}} -- The team{{end}}`,
+		"fr/welcome.txt":  `{{define "subject"}}Bienvenue {{.}}{{end}}{{define "content"}}Bonjour {{.}}{{end}}`,
+	})
+	templates, err := LoadTemplates(dir, "en")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	msg, err := templates.Render("en", "welcome", "<Jane>")
+	assert.Nil(t, err)
+	assert.Equal(t, "Welcome <Jane>", msg.Subject)
+	assert.Equal(t, "Hello <Jane> -- Trustank\n", msg.Text)
+	assert.Equal(t, "<body><p>Hello &lt;Jane&gt;</p></body>", msg.HTML)
+
+	// blocks of the layout can be overridden
+	msg, _ = templates.Render("en", "reset", nil)
+	assert.Equal(t, "Reset it -- The team\n", msg.Text)
+	assert.Empty(t, msg.HTML)
+
+	// locales fall back to their language, then to the default locale
+	msg, _ = templates.Render("fr_CA", "welcome", "Jane")
+	assert.Equal(t, "Bienvenue Jane", msg.Subject)
+	assert.Equal(t, "Bonjour Jane\n", msg.Text)
+	msg, _ = templates.Render("fr", "reset", nil)
+	assert.Equal(t, "Reset", msg.Subject)
+	_, err = templates.Render("en", "missing", nil)
+	assert.NotNil(t, err)
+
+	writeFiles(t, dir, map[string]string{"de/welcome.txt": `{{define "content"}}Hallo{{end}}`})
+	_, err = LoadTemplates(dir, "en")
+	assert.NotNil(t, err)
+}
+
+func TestTemplates_Repository(t *testing.T) {
+	templates, err := LoadTemplates("../../templates/mail", "en")
+	if !assert.Nil(t, err) {
+		return
+	}
+	msg, err := templates.Render("en", "invitation", map[string]interface{}{
+		"CustomerName":   "Jane",
+		"BusinessName":   "Bukka Hut",
+		"OrderRef":       "A-1",
+		"ReviewURL":      "http://app.test/invitations/token",
+		"UnsubscribeURL": "http://app.test/invitations/token/unsubscribe",
+		"ExpiresAt":      time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "How was your experience with Bukka Hut?", msg.Subject)
+	assert.Contains(t, msg.Text, "This link expires on 1 June 2021.")
+	assert.Contains(t, msg.HTML, `href="http://app.test/invitations/token/unsubscribe"`)
+}
+
+func TestMbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mbox")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mail.mbox")
+	m := NewMbox(path, "Trustank <no-reply@trustank.test>")
+
+	assert.Nil(t, m.Send(context.Background(), Message{
+		To:      "jane@example.com",
+		Subject: "Café",
+		Text:    "Hello\nFrom the team",
+		Headers: map[string]string{"List-Unsubscribe": "<http://app.test/u>\r\nBcc: x@example.com"},
+	}))
+	assert.Nil(t, m.Send(context.Background(), Message{To: "john@example.com", Subject: "Hi", Text: "Hi", HTML: "<p>Hi</p>"}))
+
+	data, _ := ioutil.ReadFile(path)
+	messages := strings.Split(string(data), "\nFrom MAILER-DAEMON ")
+	if !assert.Len(t, messages, 2) {
+		return
+	}
+	assert.Contains(t, messages[0], "\n>From the team")
+	msg, err := mail.ReadMessage(strings.NewReader(messages[0][strings.Index(messages[0], "\n")+1:]))
+	if assert.Nil(t, err) {
+		subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		assert.Equal(t, "Café", subject)
+		assert.Equal(t, "<http://app.test/u>Bcc: x@example.com", msg.Header.Get("List-Unsubscribe"))
+		assert.Empty(t, msg.Header.Get("Bcc"))
+		assert.Contains(t, msg.Header.Get("Message-Id"), "@trustank.test>")
+	}
+	assert.Contains(t, messages[1], "Content-Type: multipart/alternative;")
+	assert.Contains(t, messages[1], "<p>Hi</p>")
+}
+
+func TestSMTP_Timeout(t *testing.T) {
+	// a server that accepts connections but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	m := NewSMTP(SMTPConfig{Host: "127.0.0.1", Port: addr.Port, From: "no-reply@trustank.test"})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = m.Send(ctx, Message{To: "jane@example.com", Subject: "Hi", Text: "Hi"})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+type mockMailer struct {
+	sent []Message
+	err  error
+}
+
+func (m *mockMailer) Send(ctx context.Context, msg Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestQueued(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	store := jobs.NewMemoryStore()
+	suppressions := NewMemorySuppressions()
+	m := NewQueued(jobs.NewQueue(store), suppressions)
+	sender := &mockMailer{}
+	handler := SendJob(sender, suppressions, logger)
+	run := func() error {
+		job, ok, err := store.Claim(ctx, []string{JobSend}, time.Now(), time.Now().Add(time.Minute))
+		if !ok || err != nil {
+			return errors.New("no job")
+		}
+		return handler(ctx, job)
+	}
+
+	assert.Nil(t, m.Send(ctx, Message{To: "jane@example.com", Subject: "Hi", Headers: map[string]string{"X-Tag": "a"}}))
+	assert.Empty(t, sender.sent)
+	assert.Nil(t, run())
+	if assert.Len(t, sender.sent, 1) {
+		assert.Equal(t, "a", sender.sent[0].Headers["X-Tag"])
+	}
+
+	// temporary failures are retried by the job runner
+	sender.err = &textproto.Error{Code: 421, Msg: "try again later"}
+	assert.Nil(t, m.Send(ctx, Message{To: "jane@example.com"}))
+	assert.NotNil(t, run())
+
+	// permanent failures suppress the address
+	sender.err = &textproto.Error{Code: 550, Msg: "no such user"}
+	assert.Nil(t, m.Send(ctx, Message{To: "john@example.com"}))
+	assert.Nil(t, run())
+	suppressed, _ := suppressions.IsSuppressed(ctx, "JOHN@example.com")
+	assert.True(t, suppressed)
+	assert.Equal(t, ErrSuppressed, m.Send(ctx, Message{To: "john@example.com"}))
+
+	assert.Nil(t, suppressions.Unsuppress(ctx, "john@example.com"))
+	assert.Nil(t, m.Send(ctx, Message{To: "john@example.com"}))
+}
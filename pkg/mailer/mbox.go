@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type mboxMailer struct {
+	mu   sync.Mutex
+	path string
+	from string
+}
+
+// NewMbox creates a Mailer appending messages to an mbox file, which mail clients can open. It is meant for
+// development and tests.
+func NewMbox(path, from string) Mailer {
+	return &mboxMailer{path: path, from: from}
+}
+
+func (m *mboxMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, err := msg.encode(m.from, now)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("From MAILER-DAEMON " + now.UTC().Format(time.ANSIC) + "\n")
+	for _, line := range strings.Split(strings.Replace(string(data), "\r\n", "\n", -1), "\n") {
+		// lines starting with "From " would be taken for the start of another message
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			buf.WriteString(">")
+		}
+		buf.WriteString(line + "\n")
+	}
+	buf.WriteString("\n")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
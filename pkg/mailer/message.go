@@ -0,0 +1,101 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// encode returns the message in the Internet Message Format, sent by from at the given date.
+func (m Message) encode(from string, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	headers := map[string]string{
+		"From":         from,
+		"To":           m.To,
+		"Subject":      mime.QEncoding.Encode("utf-8", m.Subject),
+		"Date":         date.Format(time.RFC1123Z),
+		"Message-ID":   messageID(from),
+		"MIME-Version": "1.0",
+	}
+	for k, v := range m.Headers {
+		headers[textproto.CanonicalMIMEHeaderKey(k)] = v
+	}
+
+	if m.HTML == "" {
+		headers["Content-Type"] = "text/plain; charset=utf-8"
+		headers["Content-Transfer-Encoding"] = "quoted-printable"
+		writeHeaders(&buf, headers)
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(pw, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	headers["Content-Type"] = "multipart/alternative; boundary=" + w.Boundary()
+	writeHeaders(&buf, headers)
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+// writeHeaders writes the headers in a stable order followed by the blank line ending them.
+func writeHeaders(w io.Writer, headers map[string]string) {
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// header values must not contain line breaks, which would let them inject other headers
+		v := strings.NewReplacer("\r", "", "\n", "").Replace(headers[k])
+		fmt.Fprintf(w, "%s: %s\r\n", k, v)
+	}
+	io.WriteString(w, "\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, strings.Replace(content, "\n", "\r\n", -1)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// messageID generates a unique Message-ID in the domain of the sender.
+func messageID(from string) string {
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = strings.TrimRight(from[i+1:], ">")
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ysodiqakanni/trustank-api/pkg/jobs"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+)
+
+// JobSend is the type of the jobs sending the messages of a queued Mailer.
+const JobSend = "mail.send"
+
+// ErrSuppressed is returned when a message is sent to an address of the suppression list.
+var ErrSuppressed = errors.New("mailer: the recipient address is suppressed")
+
+type queuedMailer struct {
+	queue        *jobs.Queue
+	suppressions Suppressions
+}
+
+// NewQueued creates a Mailer enqueuing messages as JobSend jobs, which the handler returned by SendJob sends.
+// Messages to suppressed addresses are rejected with ErrSuppressed.
+func NewQueued(queue *jobs.Queue, suppressions Suppressions) Mailer {
+	return queuedMailer{queue, suppressions}
+}
+
+func (m queuedMailer) Send(ctx context.Context, msg Message) error {
+	if suppressed, err := m.suppressions.IsSuppressed(ctx, msg.To); err != nil {
+		return err
+	} else if suppressed {
+		return ErrSuppressed
+	}
+	_, err := m.queue.Enqueue(ctx, JobSend, msg)
+	return err
+}
+
+// SendJob returns the handler of JobSend jobs, sending their message with mailer. Messages to addresses
+// suppressed since they were queued are dropped, and addresses permanently rejected by the mail server are
+// added to the suppression list.
+func SendJob(mailer Mailer, suppressions Suppressions, logger log.Logger) jobs.Handler {
+	return func(ctx context.Context, job jobs.Job) error {
+		var msg Message
+		if err := job.Decode(&msg); err != nil {
+			return err
+		}
+		if suppressed, err := suppressions.IsSuppressed(ctx, msg.To); err != nil {
+			return err
+		} else if suppressed {
+			logger.Infof("dropped email to suppressed address %s: %s", msg.To, msg.Subject)
+			return nil
+		}
+		err := mailer.Send(ctx, msg)
+		if IsPermanent(err) {
+			logger.Infof("suppressing %s after a permanent failure: %s", msg.To, err)
+			return suppressions.Suppress(ctx, msg.To, ReasonBounced)
+		}
+		return err
+	}
+}
@@ -0,0 +1,113 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// SMTPConfig configures the SMTP mailer.
+type SMTPConfig struct {
+	Host string
+	Port int
+	// Username and Password authenticate with PLAIN auth when Username is set. The server must support TLS.
+	Username string
+	Password string
+	// From is the sender of the messages, such as "Trustank <no-reply@trustank.com>".
+	From string
+}
+
+type smtpMailer struct {
+	config SMTPConfig
+}
+
+// NewSMTP creates a Mailer sending messages to an SMTP server.
+func NewSMTP(config SMTPConfig) Mailer {
+	return smtpMailer{config}
+}
+
+func (m smtpMailer) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(m.config.From)
+	if err != nil {
+		return err
+	}
+	data, err := msg.encode(m.config.From, time.Now())
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	// closing the connection when the context is done stops a slow or hung server from holding the sender past
+	// its timeout, after which the message may be sent again
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+	if err := m.send(conn, auth, from.Address, msg.To, data); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// send sends a message over an SMTP connection like smtp.SendMail, upgrading the connection to TLS when the
+// server supports it.
+func (m smtpMailer) send(conn net.Conn, auth smtp.Auth, from, to string, data []byte) error {
+	c, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.config.Host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// IsPermanent reports whether a sending error is a permanent SMTP failure, such as an unknown mailbox, meaning
+// that sending the message again would fail too.
+func IsPermanent(err error) bool {
+	e, ok := err.(*textproto.Error)
+	return ok && e.Code >= 500 && e.Code < 600
+}
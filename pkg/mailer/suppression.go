@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ysodiqakanni/trustank-api/pkg/dbcontext"
+	"github.com/ysodiqakanni/trustank-api/pkg/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Suppression reasons.
+const (
+	// ReasonBounced is the reason of addresses whose mail server permanently rejected a message.
+	ReasonBounced = "bounced"
+	// ReasonUnsubscribed is the reason of addresses whose owner asked not to receive any email.
+	ReasonUnsubscribed = "unsubscribed"
+	// ReasonComplained is the reason of addresses whose owner reported a message as spam.
+	ReasonComplained = "complained"
+)
+
+// Suppressions is the list of addresses that no message must be sent to.
+type Suppressions interface {
+	// IsSuppressed reports whether an address is in the list.
+	IsSuppressed(ctx context.Context, email string) (bool, error)
+	// Suppress adds an address to the list for the given reason.
+	Suppress(ctx context.Context, email, reason string) error
+	// Unsuppress removes an address from the list.
+	Unsuppress(ctx context.Context, email string) error
+}
+
+type mongoSuppressions struct {
+	collection *mongo.Collection
+	logger     log.Logger
+}
+
+// NewMongoSuppressions creates a suppression list stored in the "mail_suppressions" collection.
+func NewMongoSuppressions(db *dbcontext.DB, logger log.Logger) Suppressions {
+	s := mongoSuppressions{db.DB().Collection("mail_suppressions"), logger}
+	s.ensureIndexes()
+	return s
+}
+
+// ensureIndexes creates the indexes required by the list queries if they do not exist yet.
+func (s mongoSuppressions) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.M{"email": 1}, Options: options.Index().SetUnique(true)})
+	if err != nil {
+		s.logger.Errorf("failed to create mail suppression indexes: %v", err)
+	}
+}
+
+func (s mongoSuppressions) IsSuppressed(ctx context.Context, email string) (bool, error) {
+	count, err := s.collection.CountDocuments(ctx, bson.M{"email": normalizeEmail(email)})
+	return count > 0, err
+}
+
+func (s mongoSuppressions) Suppress(ctx context.Context, email, reason string) error {
+	filter := bson.M{"email": normalizeEmail(email)}
+	update := bson.M{"$set": bson.M{"reason": reason, "created_at": time.Now()}}
+	_, err := s.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s mongoSuppressions) Unsuppress(ctx context.Context, email string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"email": normalizeEmail(email)})
+	return err
+}
+
+type memorySuppressions struct {
+	mu     sync.RWMutex
+	emails map[string]string
+}
+
+// NewMemorySuppressions creates a suppression list kept in memory. It is meant for tests.
+func NewMemorySuppressions() Suppressions {
+	return &memorySuppressions{emails: map[string]string{}}
+}
+
+func (s *memorySuppressions) IsSuppressed(ctx context.Context, email string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.emails[normalizeEmail(email)]
+	return ok, nil
+}
+
+func (s *memorySuppressions) Suppress(ctx context.Context, email, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emails[normalizeEmail(email)] = reason
+	return nil
+}
+
+func (s *memorySuppressions) Unsuppress(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.emails, normalizeEmail(email))
+	return nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,159 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	// layoutName is the base name of the layout files of a locale. The layout renders the "content" template
+	// defined by each message.
+	layoutName = "layout"
+	// subjectTemplate is the name of the template defining the subject in the text template of a message.
+	subjectTemplate = "subject"
+	// contentTemplate is the name of the template defining the body of a message.
+	contentTemplate = "content"
+)
+
+// template is a message template in a locale.
+type template struct {
+	text *texttemplate.Template
+	// html is nil for messages without an HTML version.
+	html *htmltemplate.Template
+}
+
+// Templates renders localized messages.
+type Templates struct {
+	defaultLocale string
+	locales       map[string]map[string]template
+}
+
+// LoadTemplates loads the message templates of a directory holding one subdirectory per locale, such as "en" or
+// "fr-CA". Each message has a text template "<name>.txt" defining the "subject" and "content" templates, and an
+// optional HTML template "<name>.html" defining "content". The optional "layout.txt" and "layout.html" files of
+// the locale wrap the content of every message, which they include with {{template "content" .}}. A layout can
+// also declare overridable sections with {{block "name" .}}default{{end}}.
+//
+// Messages missing in a locale fall back to its language, then to the default locale.
+func LoadTemplates(dir, defaultLocale string) (*Templates, error) {
+	t := &Templates{defaultLocale: defaultLocale, locales: map[string]map[string]template{}}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		templates, err := loadLocale(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		t.locales[normalizeLocale(entry.Name())] = templates
+	}
+	return t, nil
+}
+
+// loadLocale loads the message templates of a locale directory.
+func loadLocale(dir string) (map[string]template, error) {
+	textLayout, htmlLayout := filepath.Join(dir, layoutName+".txt"), filepath.Join(dir, layoutName+".html")
+	names, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	templates := map[string]template{}
+	for _, path := range names {
+		name := strings.TrimSuffix(filepath.Base(path), ".txt")
+		if name == layoutName {
+			continue
+		}
+		var tmpl template
+		if tmpl.text, err = texttemplate.ParseFiles(withLayout(textLayout, path)...); err != nil {
+			return nil, err
+		}
+		if tmpl.text.Lookup(subjectTemplate) == nil {
+			return nil, fmt.Errorf("mailer: %s does not define a subject", path)
+		}
+		htmlPath := filepath.Join(dir, name+".html")
+		if exists(htmlPath) {
+			if tmpl.html, err = htmltemplate.ParseFiles(withLayout(htmlLayout, htmlPath)...); err != nil {
+				return nil, err
+			}
+		}
+		templates[name] = tmpl
+	}
+	return templates, nil
+}
+
+// withLayout returns the files to parse for a message, with the layout first if there is one.
+func withLayout(layout, path string) []string {
+	if exists(layout) {
+		return []string{layout, path}
+	}
+	return []string{path}
+}
+
+// root returns the name of the template to execute to render a message: the layout, or the content of the
+// message if there is no layout.
+func root(name string) string {
+	if strings.HasPrefix(name, layoutName+".") {
+		return name
+	}
+	return contentTemplate
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Render renders a message in the given locale. The recipient of the returned message is not set.
+func (t *Templates) Render(locale, name string, data interface{}) (Message, error) {
+	tmpl, ok := t.lookup(locale, name)
+	if !ok {
+		return Message{}, fmt.Errorf("mailer: no %q template", name)
+	}
+	var subject, text bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, subjectTemplate, data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, root(tmpl.text.Name()), data); err != nil {
+		return Message{}, err
+	}
+	msg := Message{Subject: strings.TrimSpace(subject.String()), Text: strings.TrimSpace(text.String()) + "\n"}
+	if tmpl.html != nil {
+		var html bytes.Buffer
+		if err := tmpl.html.ExecuteTemplate(&html, root(tmpl.html.Name()), data); err != nil {
+			return Message{}, err
+		}
+		msg.HTML = html.String()
+	}
+	return msg, nil
+}
+
+// lookup finds the template of a message in a locale, its language or the default locale.
+func (t *Templates) lookup(locale, name string) (template, bool) {
+	locale = normalizeLocale(locale)
+	candidates := []string{locale}
+	if i := strings.Index(locale, "-"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, normalizeLocale(t.defaultLocale))
+	for _, l := range candidates {
+		if tmpl, ok := t.locales[l][name]; ok {
+			return tmpl, true
+		}
+	}
+	return template{}, false
+}
+
+// normalizeLocale turns locales such as "fr_CA" or "FR-ca" into "fr-ca".
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.Replace(locale, "_", "-", -1))
+}
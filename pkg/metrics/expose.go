@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the media type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler returns an HTTP handler responding with the metrics of the registry.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		w.Header().Set("Cache-Control", "no-store")
+		r.WriteTo(w)
+	})
+}
+
+// WriteTo writes the metrics of the registry in the Prometheus text exposition format, sorted by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	all := make([]metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		all = append(all, m)
+	}
+	r.mu.Unlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].desc().name < all[j].desc().name })
+
+	cw := &countingWriter{w: w}
+	b := bufio.NewWriter(cw)
+	for _, m := range all {
+		d := m.desc()
+		b.WriteString("# HELP " + d.name + " " + helpEscaper.Replace(d.help) + "\n")
+		b.WriteString("# TYPE " + d.name + " " + d.kind + "\n")
+		d.mu.Lock()
+		series := d.sorted()
+		d.mu.Unlock()
+		for _, s := range series {
+			if h, ok := m.(*Histogram); ok {
+				writeHistogram(b, h, s)
+				continue
+			}
+			writeSample(b, d.name, d.labels, s.labelValues, "", s.value)
+		}
+	}
+	err := b.Flush()
+	return cw.n, err
+}
+
+// writeHistogram writes the cumulative buckets, the sum and the count of a histogram series.
+func writeHistogram(b *bufio.Writer, h *Histogram, s series) {
+	d := h.d
+	var count uint64
+	for i, upper := range h.buckets {
+		count += s.counts[i]
+		writeSample(b, d.name+"_bucket", d.labels, s.labelValues, formatFloat(upper), float64(count))
+	}
+	count += s.counts[len(h.buckets)]
+	writeSample(b, d.name+"_bucket", d.labels, s.labelValues, "+Inf", float64(count))
+	writeSample(b, d.name+"_sum", d.labels, s.labelValues, "", s.sum)
+	writeSample(b, d.name+"_count", d.labels, s.labelValues, "", float64(count))
+}
+
+// writeSample writes a line of the exposition format. le is the upper bound of a histogram bucket, if any.
+func writeSample(b *bufio.Writer, name string, labels, values []string, le string, value float64) {
+	b.WriteString(name)
+	if len(labels) > 0 || le != "" {
+		b.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(label + `="` + labelEscaper.Replace(values[i]) + `"`)
+		}
+		if le != "" {
+			if len(labels) > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(`le="` + le + `"`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString(" " + formatFloat(value) + "\n")
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ysodiqakanni/trustank-api/pkg/response"
+)
+
+// unmatchedRoute is the route label of the requests that match no route, so that unknown paths do not create
+// a series each.
+const unmatchedRoute = "unmatched"
+
+// HTTP records the requests served by a gorilla/mux router.
+type HTTP struct {
+	requests *Counter
+	duration *Histogram
+	inFlight *Gauge
+}
+
+// NewHTTP creates the HTTP request metrics in a registry.
+func NewHTTP(r *Registry) *HTTP {
+	return &HTTP{
+		requests: r.NewCounter("http_requests_total", "Number of HTTP requests by route, method and status.", "route", "method", "status"),
+		duration: r.NewHistogram("http_request_duration_seconds", "Duration of HTTP requests by route, method and status.", nil, "route", "method", "status"),
+		inFlight: r.NewGauge("http_requests_in_flight", "Number of HTTP requests being served."),
+	}
+}
+
+// Instrument records the requests of a router: the requests matching a route are labeled with its path template,
+// such as /api/v1/businesses/{id}, and the other ones with "unmatched".
+func (m *HTTP) Instrument(r *mux.Router) {
+	r.Use(m.Middleware)
+	notFound, methodNotAllowed := r.NotFoundHandler, r.MethodNotAllowedHandler
+	if notFound == nil {
+		notFound = http.NotFoundHandler()
+	}
+	if methodNotAllowed == nil {
+		methodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		})
+	}
+	r.NotFoundHandler = m.Middleware(notFound)
+	r.MethodNotAllowedHandler = m.Middleware(methodNotAllowed)
+}
+
+// Middleware records the requests served by next. The route is read from the gorilla/mux route of the request.
+func (m *HTTP) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		rw := response.NewStatusWriter(w)
+		next.ServeHTTP(rw, req)
+
+		route := unmatchedRoute
+		if current := mux.CurrentRoute(req); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		labels := []string{route, method(req.Method), strconv.Itoa(rw.Status())}
+		m.requests.Inc(labels...)
+		m.duration.Observe(time.Since(start).Seconds(), labels...)
+	})
+}
+
+// method returns the method label of a request, grouping the non-standard methods.
+func method(m string) string {
+	switch m {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS":
+		return m
+	}
+	return "OTHER"
+}
@@ -0,0 +1,242 @@
+// Package metrics records counters, gauges and histograms and exposes them in the Prometheus text exposition format.
+//
+// Metrics are usually declared as package variables registered in the Default registry:
+//
+//	var loginsTotal = metrics.NewCounter("trustank_logins_total", "Number of logins by result.", "result")
+//
+//	loginsTotal.Inc("failed")
+//
+// The values of the labels are given in the order of their names when the metric is declared.
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of the buckets of a histogram of durations in seconds, from 5ms to 10s.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry that the metrics declared with the package functions are registered in.
+var Default = NewRegistry()
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Registry holds a set of metrics.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}}
+}
+
+// metric is implemented by the types of metrics.
+type metric interface {
+	desc() *desc
+}
+
+// register adds a metric to the registry. It panics if the name is invalid or already used, as these are
+// programming errors.
+func (r *Registry) register(m metric) {
+	d := m.desc()
+	for _, name := range append([]string{d.name}, d.labels...) {
+		if !namePattern.MatchString(name) {
+			panic(fmt.Sprintf("metrics: invalid name %q", name))
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[d.name]; ok {
+		panic(fmt.Sprintf("metrics: %s is already registered", d.name))
+	}
+	r.metrics[d.name] = m
+}
+
+// desc describes a metric and holds the values of its series, one per combination of label values.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// the counts of the buckets and the sum of a histogram
+	counts []uint64
+	sum    float64
+}
+
+func newDesc(name, help, kind string, labels []string) *desc {
+	d := &desc{name: name, help: help, kind: kind, labels: labels, series: map[string]*series{}}
+	return d
+}
+
+// get returns the series of the given label values, creating it if needed. The lock must be held.
+func (d *desc) get(labelValues []string) *series {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := d.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		d.series[key] = s
+	}
+	return s
+}
+
+// sorted returns a copy of the series sorted by label values. The lock must be held.
+func (d *desc) sorted() []series {
+	keys := make([]string, 0, len(d.series))
+	for key := range d.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]series, len(keys))
+	for i, key := range keys {
+		s := *d.series[key]
+		s.counts = append([]uint64(nil), s.counts...)
+		result[i] = s
+	}
+	return result
+}
+
+// Counter is a value that only goes up, such as a number of requests.
+type Counter struct {
+	d *desc
+}
+
+// NewCounter creates a counter with the given label names and registers it.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newDesc(name, help, "counter", labels)}
+	r.register(c)
+	if len(labels) == 0 {
+		c.Add(0)
+	}
+	return c
+}
+
+// NewCounter creates a counter registered in the Default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+func (c *Counter) desc() *desc { return c.d }
+
+// Inc adds one to the counter of the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a value to the counter of the given label values. It panics if the value is negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("metrics: %s cannot decrease", c.d.name))
+	}
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.get(labelValues).value += v
+}
+
+// Gauge is a value that goes up and down, such as a number of open connections.
+type Gauge struct {
+	d *desc
+}
+
+// NewGauge creates a gauge with the given label names and registers it.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newDesc(name, help, "gauge", labels)}
+	r.register(g)
+	if len(labels) == 0 {
+		g.Add(0)
+	}
+	return g
+}
+
+// NewGauge creates a gauge registered in the Default registry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+func (g *Gauge) desc() *desc { return g.d }
+
+// Set sets the gauge of the given label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.d.mu.Lock()
+	defer g.d.mu.Unlock()
+	g.d.get(labelValues).value = v
+}
+
+// Add adds a value, which may be negative, to the gauge of the given label values.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.d.mu.Lock()
+	defer g.d.mu.Unlock()
+	g.d.get(labelValues).value += v
+}
+
+// Inc adds one to the gauge of the given label values.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec subtracts one from the gauge of the given label values.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Histogram counts observations, such as request durations, in buckets.
+type Histogram struct {
+	d       *desc
+	buckets []float64
+}
+
+// NewHistogram creates a histogram with the given bucket upper bounds and label names and registers it.
+// DefaultBuckets are used when buckets is nil.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: the buckets of %s are not sorted", name))
+	}
+	for _, label := range labels {
+		if label == "le" {
+			panic(fmt.Sprintf("metrics: %s cannot have a label named le", name))
+		}
+	}
+	h := &Histogram{newDesc(name, help, "histogram", labels), append([]float64(nil), buckets...)}
+	r.register(h)
+	return h
+}
+
+// NewHistogram creates a histogram registered in the Default registry.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+func (h *Histogram) desc() *desc { return h.d }
+
+// Observe records a value in the histogram of the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.d.mu.Lock()
+	defer h.d.mu.Unlock()
+	s := h.d.get(labelValues)
+	if s.counts == nil {
+		// one count per bucket and a last one for +Inf
+		s.counts = make([]uint64, len(h.buckets)+1)
+	}
+	i := sort.SearchFloat64s(h.buckets, v)
+	s.counts[i]++
+	s.sum += v
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// expose returns the exposition of a registry.
+func expose(r *Registry) string {
+	var b strings.Builder
+	r.WriteTo(&b)
+	return b.String()
+}
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	logins := r.NewCounter("trustank_logins_total", "Number of logins\nby result.", "result")
+	jobs := r.NewGauge("jobs_running", "Number of jobs being run.")
+	duration := r.NewHistogram("job_duration_seconds", "Duration of jobs.", []float64{0.1, 1}, "type")
+	r.NewCounter("events_total", "Number of events.", "type")
+
+	logins.Inc("failed")
+	logins.Add(2, "succeeded")
+	logins.Inc("failed")
+	logins.Inc(`quote " backslash \ newline` + "\n")
+	jobs.Inc()
+	jobs.Inc()
+	jobs.Dec()
+	duration.Observe(0.05, "mail.send")
+	duration.Observe(0.1, "mail.send")
+	duration.Observe(3, "mail.send")
+
+	assert.Equal(t, `# HELP events_total Number of events.
+# TYPE events_total counter
+# HELP job_duration_seconds Duration of jobs.
+# TYPE job_duration_seconds histogram
+job_duration_seconds_bucket{type="mail.send",le="0.1"} 2
+job_duration_seconds_bucket{type="mail.send",le="1"} 2
+job_duration_seconds_bucket{type="mail.send",le="+Inf"} 3
+job_duration_seconds_sum{type="mail.send"} 3.15
+job_duration_seconds_count{type="mail.send"} 3
+# HELP jobs_running Number of jobs being run.
+# TYPE jobs_running gauge
+jobs_running 1
+# HELP trustank_logins_total Number of logins\nby result.
+# TYPE trustank_logins_total counter
+trustank_logins_total{result="failed"} 2
+trustank_logins_total{result="quote \" backslash \\ newline\n"} 1
+trustank_logins_total{result="succeeded"} 2
+`, expose(r))
+
+	assert.Panics(t, func() { r.NewGauge("jobs_running", "Duplicate.") })
+	assert.Panics(t, func() { r.NewGauge("jobs-running", "Invalid name.") })
+	assert.Panics(t, func() { logins.Inc() })
+	assert.Panics(t, func() { logins.Add(-1, "failed") })
+	assert.Panics(t, func() { r.NewHistogram("h", "Unsorted buckets.", []float64{1, 0.1}) })
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("requests_total", "Number of requests.").Inc()
+	res := httptest.NewRecorder()
+	r.Handler().ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, ContentType, res.Header().Get("Content-Type"))
+	assert.Contains(t, res.Body.String(), "\nrequests_total 1\n")
+}
+
+func TestHTTP(t *testing.T) {
+	reg := NewRegistry()
+	router := mux.NewRouter()
+	router.HandleFunc("/businesses/{id}", func(w http.ResponseWriter, req *http.Request) {
+		assert.Contains(t, expose(reg), "\nhttp_requests_in_flight 1\n")
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("the response writer cannot be flushed")
+		}
+		w.WriteHeader(http.StatusCreated)
+	}).Methods("POST")
+	NewHTTP(reg).Instrument(router)
+
+	for _, req := range []struct{ method, path string }{
+		{"POST", "/businesses/1"},
+		{"POST", "/businesses/2"},
+		{"GET", "/businesses/1"},
+		{"GET", "/unknown/path"},
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	out := expose(reg)
+	assert.Contains(t, out, `http_requests_total{route="/businesses/{id}",method="POST",status="201"} 2`)
+	assert.Contains(t, out, `http_requests_total{route="unmatched",method="GET",status="405"} 1`)
+	assert.Contains(t, out, `http_requests_total{route="unmatched",method="GET",status="404"} 1`)
+	assert.Contains(t, out, `http_request_duration_seconds_count{route="/businesses/{id}",method="POST",status="201"} 2`)
+	assert.Contains(t, out, "\nhttp_requests_in_flight 0\n")
+}
+
+func TestMongo(t *testing.T) {
+	reg := NewRegistry()
+	m := NewMongo(reg)
+	commands, pool := m.CommandMonitor(), m.PoolMonitor()
+
+	commands.Succeeded(context.Background(), &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", Duration: 20 * time.Millisecond}})
+	commands.Failed(context.Background(), &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "insert", Duration: time.Millisecond}})
+	for _, e := range []string{event.ConnectionCreated, event.ConnectionCreated, event.GetSucceeded, event.GetSucceeded, event.ConnectionReturned, event.ConnectionClosed} {
+		pool.Event(&event.PoolEvent{Type: e, Address: "db:27017"})
+	}
+	pool.Event(&event.PoolEvent{Type: event.GetFailed, Reason: event.ReasonTimedOut})
+
+	out := expose(reg)
+	assert.Contains(t, out, `mongodb_command_duration_seconds_bucket{command="find",le="0.025"} 1`)
+	assert.Contains(t, out, `mongodb_command_duration_seconds_count{command="insert"} 1`)
+	assert.Contains(t, out, `mongodb_command_errors_total{command="insert"} 1`)
+	assert.Contains(t, out, `mongodb_pool_connections{address="db:27017"} 1`)
+	assert.Contains(t, out, `mongodb_pool_connections_in_use{address="db:27017"} 1`)
+	assert.Contains(t, out, `mongodb_pool_checkout_failures_total{reason="timeout"} 1`)
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// Mongo records the commands and the connection pool of a MongoDB client through the monitors of the driver.
+type Mongo struct {
+	duration         *Histogram
+	errors           *Counter
+	connections      *Gauge
+	inUse            *Gauge
+	checkoutFailures *Counter
+}
+
+// NewMongo creates the MongoDB metrics in a registry.
+func NewMongo(r *Registry) *Mongo {
+	return &Mongo{
+		duration:         r.NewHistogram("mongodb_command_duration_seconds", "Duration of MongoDB commands by command name.", nil, "command"),
+		errors:           r.NewCounter("mongodb_command_errors_total", "Number of failed MongoDB commands by command name.", "command"),
+		connections:      r.NewGauge("mongodb_pool_connections", "Number of open connections to MongoDB by server address.", "address"),
+		inUse:            r.NewGauge("mongodb_pool_connections_in_use", "Number of connections to MongoDB checked out of the pool by server address.", "address"),
+		checkoutFailures: r.NewCounter("mongodb_pool_checkout_failures_total", "Number of failures to check a connection to MongoDB out of the pool by reason.", "reason"),
+	}
+}
+
+// CommandMonitor returns a monitor to set with options.ClientOptions.SetMonitor.
+func (m *Mongo) CommandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			m.duration.Observe(e.Duration.Seconds(), e.CommandName)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			m.duration.Observe(e.Duration.Seconds(), e.CommandName)
+			m.errors.Inc(e.CommandName)
+		},
+	}
+}
+
+// PoolMonitor returns a monitor to set with options.ClientOptions.SetPoolMonitor.
+func (m *Mongo) PoolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				m.connections.Inc(e.Address)
+			case event.ConnectionClosed:
+				m.connections.Dec(e.Address)
+			case event.GetSucceeded:
+				m.inUse.Inc(e.Address)
+			case event.ConnectionReturned:
+				m.inUse.Dec(e.Address)
+			case event.GetFailed:
+				m.checkoutFailures.Inc(e.Reason)
+			}
+		},
+	}
+}
@@ -0,0 +1,29 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusWriter(t *testing.T) {
+	res := httptest.NewRecorder()
+	w := NewStatusWriter(res)
+	assert.Equal(t, http.StatusOK, w.Status())
+	w.WriteHeader(http.StatusNotFound)
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte("missing"))
+	w.Flush()
+	assert.Equal(t, http.StatusNotFound, w.Status())
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.True(t, res.Flushed)
+	assert.Equal(t, res, w.Unwrap())
+
+	// the status of a body written without a header is 200, and cannot change afterwards
+	w = NewStatusWriter(httptest.NewRecorder())
+	w.Write([]byte("ok"))
+	w.WriteHeader(http.StatusBadGateway)
+	assert.Equal(t, http.StatusOK, w.Status())
+}
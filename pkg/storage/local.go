@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// contentTypeSuffix is appended to an object's file name to keep its content type next to the data.
+const contentTypeSuffix = ".content-type"
+
+type local struct {
+	root string
+}
+
+// NewLocal creates a storage that keeps objects as files under the given root directory.
+// It is meant for development and tests; objects are served through the application rather than directly.
+func NewLocal(root string) Storage {
+	return local{root}
+}
+
+// Put stores the content read from r under the given key, replacing any existing object.
+func (s local) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	name, err := s.filename(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so that readers never see a partially written object
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if contentType != "" {
+		if err := ioutil.WriteFile(name+contentTypeSuffix, []byte(contentType), 0644); err != nil {
+			return err
+		}
+	} else if err := os.Remove(name + contentTypeSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Get returns the object stored under the given key.
+func (s local) Get(ctx context.Context, key string) (*Object, error) {
+	name, err := s.filename(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, ErrNotFound
+	}
+	return &Object{
+		ReadCloser:  f,
+		ContentType: s.contentType(name, f),
+		Size:        info.Size(),
+	}, nil
+}
+
+// Delete removes the object stored under the given key.
+func (s local) Delete(ctx context.Context, key string) error {
+	name, err := s.filename(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(name + contentTypeSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// URL always returns an empty string because local objects must be served by the application.
+func (s local) URL(ctx context.Context, key string) (string, error) {
+	if _, err := cleanKey(key); err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+// filename returns the path of the file holding the object with the given key.
+func (s local) filename(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(key, contentTypeSuffix) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// contentType determines the content type of a stored file, falling back to its extension and content.
+func (s local) contentType(name string, f *os.File) string {
+	if data, err := ioutil.ReadFile(name + contentTypeSuffix); err == nil && len(data) > 0 {
+		return string(data)
+	}
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "application/octet-stream"
+	}
+	return http.DetectContentType(buf[:n])
+}
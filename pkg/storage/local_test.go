@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	s := NewLocal(dir)
+	ctx := context.Background()
+
+	_, err = s.Get(ctx, "icons/missing.png")
+	assert.Equal(t, ErrNotFound, err)
+
+	err = s.Put(ctx, "icons/a", bytes.NewBufferString("hello"), "image/png")
+	assert.Nil(t, err)
+	obj, err := s.Get(ctx, "icons/a")
+	if assert.Nil(t, err) {
+		data, _ := ioutil.ReadAll(obj)
+		obj.Close()
+		assert.Equal(t, "hello", string(data))
+		assert.Equal(t, "image/png", obj.ContentType)
+		assert.Equal(t, int64(5), obj.Size)
+	}
+
+	// replacing an object without a content type falls back to sniffing the content
+	err = s.Put(ctx, "icons/a", bytes.NewBufferString("plain text"), "")
+	assert.Nil(t, err)
+	obj, err = s.Get(ctx, "icons/a")
+	if assert.Nil(t, err) {
+		obj.Close()
+		assert.Equal(t, "text/plain; charset=utf-8", obj.ContentType)
+	}
+
+	u, err := s.URL(ctx, "icons/a")
+	assert.Nil(t, err)
+	assert.Empty(t, u)
+
+	assert.Nil(t, s.Delete(ctx, "icons/a"))
+	assert.Nil(t, s.Delete(ctx, "icons/a"))
+	_, err = s.Get(ctx, "icons/a")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestLocal_InvalidKey(t *testing.T) {
+	s := NewLocal(os.TempDir())
+	ctx := context.Background()
+	for _, key := range []string{"", "/", "../secret", "a/../../b", `a\b`, "a.content-type"} {
+		assert.Equal(t, ErrInvalidKey, s.Put(ctx, key, bytes.NewBufferString("x"), ""), key)
+		_, err := s.Get(ctx, key)
+		assert.Equal(t, ErrInvalidKey, err, key)
+	}
+}
+
+func Test_cleanKey(t *testing.T) {
+	key, err := cleanKey("/icons//a.png")
+	assert.Nil(t, err)
+	assert.Equal(t, "icons/a.png", key)
+}
@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signingAlgorithm   = "AWS4-HMAC-SHA256"
+	unsignedPayload    = "UNSIGNED-PAYLOAD"
+	amzDateFormat      = "20060102T150405Z"
+	defaultURLExpiry   = 15 * time.Minute
+	maxPresignedExpiry = 7 * 24 * time.Hour
+)
+
+// S3Config configures an S3-compatible storage (AWS S3, MinIO, DigitalOcean Spaces, etc.).
+type S3Config struct {
+	// Endpoint is the base URL of the S3 API, e.g. "https://s3.us-east-1.amazonaws.com" or "http://localhost:9000".
+	Endpoint string
+	// Region is the region used for request signing. Defaults to "us-east-1".
+	Region string
+	// Bucket is the name of the bucket holding the objects. Objects are addressed in path style.
+	Bucket string
+	// AccessKey and SecretKey are the credentials used to sign requests.
+	AccessKey string
+	SecretKey string
+	// PublicURL is an optional base URL (e.g. a CDN) serving the bucket publicly.
+	// When empty, URL returns presigned URLs instead.
+	PublicURL string
+	// URLExpiry is the validity of presigned URLs. Defaults to 15 minutes.
+	URLExpiry time.Duration
+}
+
+type s3 struct {
+	cfg    S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3 creates a storage backed by an S3-compatible object store.
+// If client is nil, http.DefaultClient is used.
+func NewS3(cfg S3Config, client *http.Client) Storage {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.URLExpiry <= 0 {
+		cfg.URLExpiry = defaultURLExpiry
+	}
+	if cfg.URLExpiry > maxPresignedExpiry {
+		cfg.URLExpiry = maxPresignedExpiry
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	cfg.PublicURL = strings.TrimRight(cfg.PublicURL, "/")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return s3{cfg, client, time.Now}
+}
+
+// Put uploads the content read from r under the given key.
+// The content is buffered in memory so that the payload can be signed.
+func (s s3) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	req, err := s.newRequest(ctx, http.MethodPut, key, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(data))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	sum := sha256.Sum256(data)
+	s.sign(req, hex.EncodeToString(sum[:]))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return responseError(res)
+	}
+	return nil
+}
+
+// Get downloads the object stored under the given key.
+func (s s3) Get(ctx context.Context, key string) (*Object, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, emptyPayloadHash())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	if res.StatusCode/100 != 2 {
+		defer res.Body.Close()
+		return nil, responseError(res)
+	}
+	return &Object{
+		ReadCloser:  res.Body,
+		ContentType: res.Header.Get("Content-Type"),
+		Size:        res.ContentLength,
+	}, nil
+}
+
+// Delete removes the object stored under the given key.
+func (s s3) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	s.sign(req, emptyPayloadHash())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 && res.StatusCode != http.StatusNotFound {
+		return responseError(res)
+	}
+	return nil
+}
+
+// URL returns the public URL of the object if a public base URL is configured, or a presigned GET URL otherwise.
+func (s s3) URL(ctx context.Context, key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	if s.cfg.PublicURL != "" {
+		return s.cfg.PublicURL + "/" + uriEncode(key, false), nil
+	}
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	return s.presign(http.MethodGet, u, s.cfg.URLExpiry), nil
+}
+
+// objectURL returns the path-style URL of the object with the given (already cleaned) key.
+func (s s3) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(s.cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/" + s.cfg.Bucket + "/" + key
+	u.RawPath = "/" + uriEncode(s.cfg.Bucket, false) + "/" + uriEncode(key, false)
+	return u, nil
+}
+
+func (s s3) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	return req.WithContext(ctx), nil
+}
+
+// sign adds AWS signature version 4 authorization headers to the request.
+func (s s3) sign(req *http.Request, payloadHash string) {
+	t := s.now().UTC()
+	req.Header.Set("X-Amz-Date", t.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") || name == "range" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := s.scope(t)
+	signature := s.signature(t, scope, canonicalRequest)
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm, s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+// presign returns the given URL with AWS signature version 4 query parameters that authorize the request.
+func (s s3) presign(method string, u *url.URL, expiry time.Duration) string {
+	t := s.now().UTC()
+	scope := s.scope(t)
+
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", signingAlgorithm)
+	query.Set("X-Amz-Credential", s.cfg.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", t.Format(amzDateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiry/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalURI(u),
+		canonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	signature := s.signature(t, scope, canonicalRequest)
+
+	signed := *u
+	signed.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + signature
+	return signed.String()
+}
+
+func (s s3) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+func (s s3) signature(t time.Time, scope, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		signingAlgorithm,
+		t.Format(amzDateFormat),
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func emptyPayloadHash() string {
+	sum := sha256.Sum256(nil)
+	return hex.EncodeToString(sum[:])
+}
+
+func canonicalURI(u *url.URL) string {
+	p := u.EscapedPath()
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes s as required by AWS signature version 4.
+// Slashes are kept as is unless encodeSlash is true.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// responseError builds an error from an unsuccessful S3 response.
+func responseError(res *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("storage: s3 request failed with status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,56 @@
+// Package storage provides a pluggable blob storage abstraction with local filesystem and S3-compatible backends.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrNotFound is returned when the requested object does not exist in the storage.
+var ErrNotFound = errors.New("storage: object not found")
+
+// ErrInvalidKey is returned when an object key is empty or tries to escape the storage root.
+var ErrInvalidKey = errors.New("storage: invalid object key")
+
+// Storage stores and retrieves binary objects (blobs) identified by slash-separated keys.
+type Storage interface {
+	// Put stores the content read from r under the given key, replacing any existing object.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get returns the object stored under the given key. The caller must close the returned object.
+	// ErrNotFound is returned if the object does not exist.
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete removes the object stored under the given key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns a URL from which the object can be downloaded directly by a client.
+	// An empty string is returned if the storage cannot serve objects by itself.
+	URL(ctx context.Context, key string) (string, error)
+}
+
+// Object represents a stored object being read.
+type Object struct {
+	io.ReadCloser
+	// ContentType is the MIME type of the object.
+	ContentType string
+	// Size is the size of the object in bytes, or -1 if unknown.
+	Size int64
+}
+
+// cleanKey normalizes the given key and makes sure it does not refer outside of the storage root.
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." {
+			return "", ErrInvalidKey
+		}
+	}
+	cleaned := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if cleaned == "" {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,253 @@
+// Package suggest provides an in-memory prefix index for autocomplete (typeahead) suggestions.
+package suggest
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Entry is a suggestible item such as a business or a category.
+type Entry struct {
+	Type string `json:"-"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Popularity ranks the entries matching the same prefix: the most popular come first.
+	Popularity float64 `json:"popularity"`
+}
+
+// Index is a concurrency-safe in-memory prefix index. Every word of an entry name is indexed,
+// so that "piz" suggests both "Pizza Hut" and "Mama's Pizza".
+type Index struct {
+	mu      sync.RWMutex
+	keys    []key             // sorted by text, then by entry reference
+	entries map[string]*Entry // indexed by entry reference (type and ID)
+	// builds is the number of rebuilds in progress. While it is positive, every mutation is
+	// appended to the journal so that it can be replayed on top of the rebuilt content.
+	builds  int
+	journal []mutation
+}
+
+// key is an indexed suffix of an entry name, starting at one of its words.
+type key struct {
+	text string
+	ref  string
+}
+
+// mutation is an Upsert or a Remove recorded while a rebuild is in progress.
+type mutation struct {
+	entry  Entry
+	remove bool
+}
+
+// Rebuild is a rebuild of the index in progress. See Index.Rebuild.
+type Rebuild struct {
+	idx  *Index
+	from int // length of the journal when the rebuild started
+	done bool
+}
+
+// NewIndex creates an empty index.
+func NewIndex() *Index {
+	return &Index{entries: map[string]*Entry{}}
+}
+
+// Build replaces the whole content of the index with the given entries.
+func (idx *Index) Build(entries []Entry) {
+	idx.Rebuild().Commit(entries)
+}
+
+// Rebuild starts replacing the whole content of the index. It must be called before reading the
+// entries from the data source: the Upserts and Removes made until Commit are replayed on top of
+// the entries passed to Commit, so that no change is lost. Abort must be called if the entries
+// cannot be read; it does nothing once the rebuild is committed.
+func (idx *Index) Rebuild() *Rebuild {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.builds++
+	return &Rebuild{idx: idx, from: len(idx.journal)}
+}
+
+// Commit replaces the content of the index with the given entries and replays the mutations
+// made since the rebuild started.
+func (b *Rebuild) Commit(entries []Entry) {
+	keys := make([]key, 0, len(entries))
+	byRef := make(map[string]*Entry, len(entries))
+	for i := range entries {
+		e := entries[i]
+		r := ref(e.Type, e.ID)
+		byRef[r] = &e
+		for _, text := range suffixes(e.Name) {
+			keys = append(keys, key{text, r})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+
+	idx := b.idx
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if b.done {
+		return
+	}
+	idx.keys, idx.entries = keys, byRef
+	for _, m := range idx.journal[b.from:] {
+		if m.remove {
+			idx.remove(ref(m.entry.Type, m.entry.ID))
+		} else {
+			idx.upsert(m.entry)
+		}
+	}
+	b.finish()
+}
+
+// Abort ends the rebuild without changing the content of the index.
+func (b *Rebuild) Abort() {
+	b.idx.mu.Lock()
+	defer b.idx.mu.Unlock()
+	if !b.done {
+		b.finish()
+	}
+}
+
+// finish ends the rebuild and drops the journal once no rebuild needs it. The caller must hold the write lock.
+func (b *Rebuild) finish() {
+	b.done = true
+	b.idx.builds--
+	if b.idx.builds == 0 {
+		b.idx.journal = nil
+	}
+}
+
+// Upsert adds an entry to the index or replaces the entry with the same type and ID.
+// When an existing entry is replaced by one with a zero popularity, the previous popularity is kept:
+// popularity is usually only known when the whole index is rebuilt.
+func (idx *Index) Upsert(e Entry) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.builds > 0 {
+		idx.journal = append(idx.journal, mutation{entry: e})
+	}
+	idx.upsert(e)
+}
+
+// Remove removes the entry with the given type and ID from the index.
+func (idx *Index) Remove(entryType, id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.builds > 0 {
+		idx.journal = append(idx.journal, mutation{entry: Entry{Type: entryType, ID: id}, remove: true})
+	}
+	idx.remove(ref(entryType, id))
+}
+
+// upsert implements Upsert. The caller must hold the write lock.
+func (idx *Index) upsert(e Entry) {
+	r := ref(e.Type, e.ID)
+	if existing, ok := idx.entries[r]; ok {
+		if e.Popularity == 0 {
+			e.Popularity = existing.Popularity
+		}
+		idx.removeKeys(r, existing.Name)
+	}
+	idx.entries[r] = &e
+	for _, text := range suffixes(e.Name) {
+		k := key{text, r}
+		i := sort.Search(len(idx.keys), func(i int) bool { return !less(idx.keys[i], k) })
+		idx.keys = append(idx.keys, key{})
+		copy(idx.keys[i+1:], idx.keys[i:])
+		idx.keys[i] = k
+	}
+}
+
+// remove implements Remove. The caller must hold the write lock.
+func (idx *Index) remove(r string) {
+	if existing, ok := idx.entries[r]; ok {
+		idx.removeKeys(r, existing.Name)
+		delete(idx.entries, r)
+	}
+}
+
+// Len returns the number of entries in the index.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.entries)
+}
+
+// Search returns at most limit entries of the given type having a word that starts with the prefix,
+// most popular first and then alphabetically.
+func (idx *Index) Search(entryType, prefix string, limit int) []Entry {
+	prefix = normalize(prefix)
+	if prefix == "" || limit <= 0 {
+		return []Entry{}
+	}
+
+	idx.mu.RLock()
+	var matches []Entry
+	seen := map[string]bool{}
+	start := sort.Search(len(idx.keys), func(i int) bool { return idx.keys[i].text >= prefix })
+	for i := start; i < len(idx.keys) && strings.HasPrefix(idx.keys[i].text, prefix); i++ {
+		e := idx.entries[idx.keys[i].ref]
+		if e.Type != entryType || seen[idx.keys[i].ref] {
+			continue
+		}
+		seen[idx.keys[i].ref] = true
+		matches = append(matches, *e)
+	}
+	idx.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Popularity != matches[j].Popularity {
+			return matches[i].Popularity > matches[j].Popularity
+		}
+		return strings.ToLower(matches[i].Name) < strings.ToLower(matches[j].Name)
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	if matches == nil {
+		return []Entry{}
+	}
+	return matches
+}
+
+// removeKeys removes the keys of the entry with the given reference and name. The caller must hold the write lock.
+func (idx *Index) removeKeys(r, name string) {
+	for _, text := range suffixes(name) {
+		k := key{text, r}
+		i := sort.Search(len(idx.keys), func(i int) bool { return !less(idx.keys[i], k) })
+		if i < len(idx.keys) && idx.keys[i] == k {
+			idx.keys = append(idx.keys[:i], idx.keys[i+1:]...)
+		}
+	}
+}
+
+func less(a, b key) bool {
+	if a.text != b.text {
+		return a.text < b.text
+	}
+	return a.ref < b.ref
+}
+
+func ref(entryType, id string) string {
+	return entryType + ":" + id
+}
+
+// suffixes returns the normalized name starting at each of its words.
+func suffixes(name string) []string {
+	words := strings.Fields(normalize(name))
+	result := make([]string, 0, len(words))
+	for i := range words {
+		result = append(result, strings.Join(words[i:], " "))
+	}
+	return result
+}
+
+// normalize lower-cases the text, drops apostrophes and replaces other punctuation by single spaces.
+func normalize(text string) string {
+	text = strings.NewReplacer("'", "", "’", "").Replace(strings.ToLower(text))
+	return strings.Join(strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
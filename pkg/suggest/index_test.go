@@ -0,0 +1,101 @@
+package suggest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func names(entries []Entry) []string {
+	result := []string{}
+	for _, e := range entries {
+		result = append(result, e.Name)
+	}
+	return result
+}
+
+func TestIndex(t *testing.T) {
+	idx := NewIndex()
+	idx.Build([]Entry{
+		{Type: "business", ID: "1", Name: "Pizza Hut", Popularity: 10},
+		{Type: "business", ID: "2", Name: "Mama's Pizza", Popularity: 30},
+		{Type: "business", ID: "3", Name: "Pizzeria Roma"},
+		{Type: "business", ID: "4", Name: "Burger King", Popularity: 50},
+		{Type: "category", ID: "1", Name: "Pizza & Pasta"},
+	})
+	assert.Equal(t, 5, idx.Len())
+
+	assert.Equal(t, []string{"Mama's Pizza", "Pizza Hut", "Pizzeria Roma"}, names(idx.Search("business", "PIZ", 5)))
+	assert.Equal(t, []string{"Mama's Pizza", "Pizza Hut"}, names(idx.Search("business", "piz", 2)))
+	assert.Equal(t, []string{"Pizza Hut"}, names(idx.Search("business", "pizza h", 5)))
+	assert.Equal(t, []string{"Mama's Pizza"}, names(idx.Search("business", "mamas", 5)))
+	assert.Equal(t, []string{"Pizza & Pasta"}, names(idx.Search("category", "pizza pa", 5)))
+	assert.Empty(t, idx.Search("business", "sushi", 5))
+	assert.Empty(t, idx.Search("business", " ", 5))
+
+	// renaming keeps the popularity and drops the old name
+	idx.Upsert(Entry{Type: "business", ID: "2", Name: "Mama Put"})
+	assert.Equal(t, []string{"Pizza Hut", "Pizzeria Roma"}, names(idx.Search("business", "piz", 5)))
+	assert.Equal(t, float64(30), idx.Search("business", "mama", 5)[0].Popularity)
+
+	idx.Upsert(Entry{Type: "business", ID: "5", Name: "Pizza Express", Popularity: 20})
+	assert.Equal(t, []string{"Pizza Express", "Pizza Hut"}, names(idx.Search("business", "pizza", 5)))
+
+	idx.Remove("business", "1")
+	idx.Remove("business", "unknown")
+	assert.Equal(t, []string{"Pizza Express", "Pizzeria Roma"}, names(idx.Search("business", "pizz", 5)))
+	assert.Equal(t, 5, idx.Len())
+}
+
+func TestIndex_Concurrency(t *testing.T) {
+	idx := NewIndex()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			idx.Upsert(Entry{Type: "business", ID: string(rune('a' + i)), Name: "Shop"})
+		}(i)
+		go func() {
+			defer wg.Done()
+			idx.Search("business", "sh", 3)
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, idx.Search("business", "sh", 20), 10)
+}
+
+func TestIndex_Rebuild(t *testing.T) {
+	idx := NewIndex()
+	idx.Build([]Entry{
+		{Type: "business", ID: "1", Name: "Pizza Hut"},
+		{Type: "business", ID: "2", Name: "Burger King"},
+	})
+
+	// the snapshot is read before the changes below reach the data source
+	rebuild := idx.Rebuild()
+	snapshot := []Entry{
+		{Type: "business", ID: "1", Name: "Pizza Hut", Popularity: 10},
+		{Type: "business", ID: "2", Name: "Burger King", Popularity: 20},
+	}
+	idx.Upsert(Entry{Type: "business", ID: "3", Name: "Pizza Express"})
+	idx.Upsert(Entry{Type: "business", ID: "1", Name: "Pizza Hut Delivery"})
+	idx.Remove("business", "2")
+	rebuild.Commit(snapshot)
+	rebuild.Abort()
+
+	assert.Equal(t, 2, idx.Len())
+	assert.Equal(t, []string{"Pizza Hut Delivery", "Pizza Express"}, names(idx.Search("business", "pizza", 5)))
+	assert.Equal(t, float64(10), idx.Search("business", "delivery", 5)[0].Popularity)
+	assert.Empty(t, idx.Search("business", "burger", 5))
+	assert.Nil(t, idx.journal)
+
+	// an aborted rebuild keeps the content and stops journaling
+	rebuild = idx.Rebuild()
+	idx.Remove("business", "3")
+	rebuild.Abort()
+	rebuild.Commit(nil)
+	assert.Equal(t, 1, idx.Len())
+	assert.Nil(t, idx.journal)
+}
@@ -0,0 +1,68 @@
+package textfilter
+
+import "regexp"
+
+var (
+	emailRegexp = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)
+	// card numbers have 13 to 19 digits, optionally grouped with spaces or dashes
+	cardRegexp = regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`)
+	// phone numbers are sequences of digits separated by at most two spaces, dots, dashes or parentheses
+	phoneRegexp = regexp.MustCompile(`(?:\+|\b)\d(?:[ ().\-]{0,2}\d){6,16}\b`)
+)
+
+const (
+	minPhoneDigits = 9
+	maxPhoneDigits = 15
+)
+
+// scanPII finds the email addresses, card numbers and phone numbers in a text.
+func scanPII(text string) []Match {
+	var matches []Match
+	for _, loc := range cardRegexp.FindAllStringIndex(text, -1) {
+		if luhn(digits(text[loc[0]:loc[1]])) {
+			matches = append(matches, Match{Card, loc[0], loc[1], text[loc[0]:loc[1]]})
+		}
+	}
+	for _, loc := range emailRegexp.FindAllStringIndex(text, -1) {
+		m := Match{Email, loc[0], loc[1], text[loc[0]:loc[1]]}
+		if !overlaps(matches, m) {
+			matches = append(matches, m)
+		}
+	}
+	for _, loc := range phoneRegexp.FindAllStringIndex(text, -1) {
+		m := Match{Phone, loc[0], loc[1], text[loc[0]:loc[1]]}
+		if n := len(digits(m.Text)); n >= minPhoneDigits && n <= maxPhoneDigits && !overlaps(matches, m) {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// digits returns the decimal digits of a string.
+func digits(s string) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			b = append(b, s[i])
+		}
+	}
+	return string(b)
+}
+
+// luhn reports whether a string of digits has a valid Luhn check digit.
+func luhn(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return number != "" && sum%10 == 0
+}
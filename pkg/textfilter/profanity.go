@@ -0,0 +1,167 @@
+package textfilter
+
+import (
+	"strings"
+	"unicode"
+)
+
+// leet maps the digits and symbols commonly used to disguise letters.
+var leet = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+	'@': 'a', '$': 's', '!': 'i', '|': 'i',
+}
+
+// pattern is a normalized profanity list entry.
+type pattern struct {
+	word string
+	// collapsed is word without repeated letters, to match stretched spellings such as "shiiit".
+	collapsed string
+	prefix    bool
+}
+
+// newPattern normalizes a word list entry. False is returned for blank entries and comments.
+func newPattern(entry string) (pattern, bool) {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	if entry == "" || strings.HasPrefix(entry, "#") {
+		return pattern{}, false
+	}
+	p := pattern{prefix: strings.HasSuffix(entry, "*")}
+	p.word = strings.TrimSuffix(entry, "*")
+	p.collapsed = collapse(p.word)
+	return p, p.word != ""
+}
+
+// matches reports whether a normalized word matches the pattern.
+func (p pattern) matches(word string) bool {
+	if p.prefix {
+		return strings.HasPrefix(word, p.word) || strings.HasPrefix(collapse(word), p.collapsed)
+	}
+	// stretching may only add letters, so that "as" does not match "ass"
+	return word == p.word || collapse(word) == p.collapsed && len(word) >= len(p.word)
+}
+
+// token is a word of a text with its byte offsets.
+type token struct {
+	start, end int
+	text       string
+}
+
+// scanProfanity finds the words of a text that match the patterns, including words spelled with leetspeak,
+// stretched letters or letters separated by spaces or punctuation ("f.u.c.k").
+func (f *Filter) scanProfanity(text string, patterns []pattern) []Match {
+	if len(patterns) == 0 {
+		return nil
+	}
+	var matches []Match
+	find := func(start, end int, word string) bool {
+		for _, p := range patterns {
+			if word != "" && p.matches(word) {
+				matches = append(matches, Match{Profanity, start, end, text[start:end]})
+				return true
+			}
+		}
+		return false
+	}
+
+	tokens := tokenize(text)
+	for i := 0; i < len(tokens); i++ {
+		// letters separated by single separators are joined back into a word
+		if j := spelledOut(text, tokens, i); j-i >= 3 {
+			var word string
+			for _, t := range tokens[i:j] {
+				word += normalize(t.text)
+			}
+			if find(tokens[i].start, tokens[j-1].end, word) {
+				i = j - 1
+				continue
+			}
+		}
+		t := tokens[i]
+		if !hasLetter(t.text) {
+			continue
+		}
+		// symbols around a word are usually punctuation ("shit!"), but may also stand for letters ("a$$")
+		notAlnum := func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }
+		start := t.start + len(t.text) - len(strings.TrimLeftFunc(t.text, notAlnum))
+		end := t.start + len(strings.TrimRightFunc(t.text, notAlnum))
+		if !find(start, end, normalize(text[start:end])) {
+			find(t.start, t.end, normalize(t.text))
+		}
+	}
+	return matches
+}
+
+// spelledOut returns the index after the run of single-character tokens starting at i that are separated
+// by at most two separator characters.
+func spelledOut(text string, tokens []token, i int) int {
+	j := i
+	for j < len(tokens) && runeCount(tokens[j].text) == 1 {
+		if j > i {
+			gap := text[tokens[j-1].end:tokens[j].start]
+			if len(gap) > 2 || strings.TrimLeft(gap, " .-_*,") != "" {
+				break
+			}
+		}
+		j++
+	}
+	return j
+}
+
+// tokenize splits a text into runs of letters, digits and leetspeak symbols.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{start, i, text[start:i]})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{start, len(text), text[start:]})
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	_, ok := leet[r]
+	return ok || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func hasLetter(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize lowercases a word and replaces leetspeak characters by the letters they stand for.
+func normalize(word string) string {
+	return strings.Map(func(r rune) rune {
+		if l, ok := leet[r]; ok {
+			return l
+		}
+		return unicode.ToLower(r)
+	}, word)
+}
+
+// collapse removes consecutive repeated characters.
+func collapse(word string) string {
+	var b strings.Builder
+	var last rune = -1
+	for _, r := range word {
+		if r != last {
+			b.WriteRune(r)
+		}
+		last = r
+	}
+	return b.String()
+}
@@ -0,0 +1,214 @@
+// Package textfilter detects profanity and personal information in user-generated text.
+package textfilter
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kind is the kind of problem found in a text.
+type Kind string
+
+const (
+	// Profanity is a word from a profanity list, possibly obfuscated.
+	Profanity Kind = "profanity"
+	// Email is an email address.
+	Email Kind = "email"
+	// Phone is a phone number.
+	Phone Kind = "phone"
+	// Card is a payment card number that passes the Luhn check.
+	Card Kind = "card"
+)
+
+// Action is what to do with a text in which a problem is found.
+type Action string
+
+const (
+	// Allow keeps the text unchanged.
+	Allow Action = ""
+	// Reject refuses the text.
+	Reject Action = "reject"
+	// Mask hides the offending part of the text.
+	Mask Action = "mask"
+	// Queue keeps the text unchanged but holds it for moderation.
+	Queue Action = "queue"
+)
+
+// Policy tells which action to take for the problems found in a field.
+type Policy struct {
+	Profanity Action
+	// PII is the action taken for emails, phone numbers and card numbers.
+	PII Action
+}
+
+// action returns the action the policy takes for a kind of problem.
+func (p Policy) action(kind Kind) Action {
+	if kind == Profanity {
+		return p.Profanity
+	}
+	return p.PII
+}
+
+// Match is a problem found in a text. Start and End are byte offsets in the text.
+type Match struct {
+	Kind  Kind
+	Start int
+	End   int
+	Text  string
+}
+
+// Result is the outcome of checking a text against a policy.
+type Result struct {
+	// Text is the checked text with the masked parts hidden.
+	Text    string
+	Matches []Match
+	// NeedsModeration is true if a match must be reviewed by a moderator before the text is published.
+	NeedsModeration bool
+}
+
+// Reasons returns the distinct kinds of problems found, for display to moderators.
+func (r Result) Reasons() []string {
+	return kinds(r.Matches)
+}
+
+// RejectedError is returned when a text contains problems that the policy rejects.
+type RejectedError struct {
+	Kinds []string
+}
+
+// Error returns the error message.
+func (e RejectedError) Error() string {
+	return "must not contain " + strings.Join(e.Kinds, ", ")
+}
+
+// Filter checks texts for profanity and personal information.
+type Filter struct {
+	lists map[string][]pattern
+}
+
+// New creates a filter using the given profanity word lists, keyed by language code (e.g. "en").
+// A word ending with "*" also matches any word starting with it.
+func New(lists map[string][]string) *Filter {
+	f := &Filter{lists: map[string][]pattern{}}
+	for locale, words := range lists {
+		for _, w := range words {
+			if p, ok := newPattern(w); ok {
+				f.lists[language(locale)] = append(f.lists[language(locale)], p)
+			}
+		}
+	}
+	return f
+}
+
+// Scan returns the problems found in a text, ordered by position. Profanity is looked up in the list of the
+// given locale, or in all lists if the locale is empty or has no list.
+func (f *Filter) Scan(text, locale string) []Match {
+	matches := scanPII(text)
+	for _, m := range f.scanProfanity(text, f.patterns(locale)) {
+		if !overlaps(matches, m) {
+			matches = append(matches, m)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Start < matches[j].Start })
+	return matches
+}
+
+// Check scans a text and applies the policy to the problems found. A RejectedError is returned if the policy
+// rejects any of them.
+func (f *Filter) Check(text, locale string, policy Policy) (Result, error) {
+	result := Result{Text: text}
+	var rejected []Match
+	for _, m := range f.Scan(text, locale) {
+		switch policy.action(m.Kind) {
+		case Allow:
+			continue
+		case Reject:
+			rejected = append(rejected, m)
+		case Queue:
+			result.NeedsModeration = true
+		}
+		result.Matches = append(result.Matches, m)
+	}
+	if len(rejected) > 0 {
+		return Result{}, RejectedError{kinds(rejected)}
+	}
+	result.Text = mask(text, result.Matches, policy)
+	return result, nil
+}
+
+// patterns returns the profanity patterns used for a locale.
+func (f *Filter) patterns(locale string) []pattern {
+	if p, ok := f.lists[language(locale)]; ok {
+		return p
+	}
+	var all []pattern
+	for _, p := range f.lists {
+		all = append(all, p...)
+	}
+	return all
+}
+
+// mask hides the matches whose action is Mask. Profanity keeps its length, and personal information is
+// replaced by its kind.
+func mask(text string, matches []Match, policy Policy) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if policy.action(m.Kind) != Mask {
+			continue
+		}
+		b.WriteString(text[last:m.Start])
+		if m.Kind == Profanity {
+			for _, r := range m.Text {
+				if r == ' ' {
+					b.WriteRune(r)
+				} else {
+					b.WriteByte('*')
+				}
+			}
+		} else {
+			b.WriteString("[" + string(m.Kind) + " removed]")
+		}
+		last = m.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// kinds returns the distinct kinds of the matches in order of appearance.
+func kinds(matches []Match) []string {
+	var result []string
+	seen := map[Kind]bool{}
+	for _, m := range matches {
+		if !seen[m.Kind] {
+			seen[m.Kind] = true
+			result = append(result, string(m.Kind))
+		}
+	}
+	return result
+}
+
+// overlaps reports whether a match overlaps any of the given matches.
+func overlaps(matches []Match, m Match) bool {
+	for _, other := range matches {
+		if m.Start < other.End && other.Start < m.End {
+			return true
+		}
+	}
+	return false
+}
+
+// language returns the lowercase language part of a locale, e.g. "en" for "en-GB".
+func language(locale string) string {
+	locale = strings.ToLower(locale)
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	return locale
+}
+
+// runeCount is a shorthand for utf8.RuneCountInString.
+func runeCount(s string) int {
+	return utf8.RuneCountInString(s)
+}
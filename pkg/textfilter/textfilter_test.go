@@ -0,0 +1,93 @@
+package textfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func texts(matches []Match) []string {
+	var result []string
+	for _, m := range matches {
+		result = append(result, string(m.Kind)+":"+m.Text)
+	}
+	return result
+}
+
+func TestFilter_Scan_Profanity(t *testing.T) {
+	f := New(map[string][]string{"en": {"shit", "fuck*", "# comment", ""}, "fr": {"merde"}})
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"What a lovely shop", nil},
+		{"Total SHIT service!", []string{"profanity:SHIT"}},
+		{"sh1t and 5h!t", []string{"profanity:sh1t", "profanity:5h!t"}},
+		{"shiiiit", []string{"profanity:shiiiit"}},
+		{"fucking awful", []string{"profanity:fucking"}},
+		{"what the f u c k", []string{"profanity:f u c k"}},
+		{"f.u.c.k this", []string{"profanity:f.u.c.k"}},
+		{"a b c d", nil},
+		{"shitake mushrooms", nil},
+		{"c'est de la merde", []string{"profanity:merde"}},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, texts(f.Scan(tc.text, "")), tc.text)
+	}
+	assert.Equal(t, []string{"profanity:a$$hole"}, texts(New(DefaultWordLists()).Scan("You a$$hole!", "en")))
+
+	// a locale with a list only uses that list
+	assert.Nil(t, f.Scan("merde", "en-GB"))
+	assert.Len(t, f.Scan("merde", "fr"), 1)
+	assert.Len(t, f.Scan("merde", "de"), 1)
+}
+
+func TestFilter_Scan_PII(t *testing.T) {
+	f := New(nil)
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Email me at jane.doe+shop@example.co.uk please", []string{"email:jane.doe+shop@example.co.uk"}},
+		{"Call +234 803 123 4567 or (555) 123-4567", []string{"phone:+234 803 123 4567", "phone:555) 123-4567"}},
+		{"My card 4111 1111 1111 1111 was charged twice", []string{"card:4111 1111 1111 1111"}},
+		// too long for a phone number and failing the Luhn check
+		{"Order 4111-1111-1111-1112 is late", nil},
+		{"Opened in 2019, 5 stars, order 12345", nil},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, texts(f.Scan(tc.text, "")), tc.text)
+	}
+}
+
+func TestFilter_Check(t *testing.T) {
+	f := New(DefaultWordLists())
+	text := "Bullshit! Call me on 0803 123 4567"
+
+	result, err := f.Check(text, "en", Policy{})
+	assert.Nil(t, err)
+	assert.Equal(t, text, result.Text)
+	assert.Empty(t, result.Matches)
+
+	result, err = f.Check(text, "en", Policy{Profanity: Mask, PII: Mask})
+	assert.Nil(t, err)
+	assert.Equal(t, "********! Call me on [phone removed]", result.Text)
+	assert.False(t, result.NeedsModeration)
+
+	result, err = f.Check(text, "en", Policy{Profanity: Mask, PII: Queue})
+	assert.Nil(t, err)
+	assert.Equal(t, "********! Call me on 0803 123 4567", result.Text)
+	assert.True(t, result.NeedsModeration)
+	assert.Equal(t, []string{"profanity", "phone"}, result.Reasons())
+
+	_, err = f.Check(text, "en", Policy{Profanity: Reject, PII: Mask})
+	assert.Equal(t, RejectedError{[]string{"profanity"}}, err)
+	assert.Equal(t, "must not contain profanity", err.Error())
+}
+
+func Test_luhn(t *testing.T) {
+	assert.True(t, luhn("79927398713"))
+	assert.True(t, luhn("4111111111111111"))
+	assert.False(t, luhn("4111111111111112"))
+	assert.False(t, luhn(""))
+}
@@ -0,0 +1,38 @@
+package textfilter
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultWordLists returns the built-in profanity word lists. Entries ending with "*" match any word
+// starting with them.
+func DefaultWordLists() map[string][]string {
+	return map[string][]string{
+		"en": {
+			"arse", "arsehole*", "asshole*", "bastard*", "bitch*", "bollocks", "bullshit*", "cock", "cocksucker*",
+			"cunt*", "dick", "dickhead*", "fuck*", "motherfuck*", "nigger*", "piss", "pissed", "prick", "shit",
+			"shits", "shitty", "slut*", "twat*", "wank*", "whore*",
+		},
+	}
+}
+
+// LoadWordLists reads the profanity word lists from the "*.txt" files of a directory. Each file is named after
+// its locale (e.g. "fr.txt") and contains one word per line. Blank lines and lines starting with "#" are ignored.
+func LoadWordLists(dir string) (map[string][]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	lists := map[string][]string{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		locale := strings.TrimSuffix(filepath.Base(file), ".txt")
+		lists[locale] = append(lists[locale], strings.Split(string(data), "\n")...)
+	}
+	return lists, nil
+}
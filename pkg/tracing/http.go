@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/ysodiqakanni/trustank-api/pkg/response"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// propagator reads the W3C traceparent header of incoming requests.
+var propagator = propagation.TraceContext{}
+
+// Middleware starts a server span for each request matched by a gorilla/mux router, continuing the trace of the
+// traceparent header if the request has a valid one. The span is named after the method and the route template,
+// such as "GET /api/v1/businesses/{id}", and is marked as failed when the response status is 5xx.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		route := req.URL.Path
+		if current := mux.CurrentRoute(req); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		attributes := []attribute.KeyValue{
+			attribute.String("http.request.method", req.Method),
+			attribute.String("http.route", route),
+			attribute.String("url.path", req.URL.Path),
+		}
+		if ua := req.UserAgent(); ua != "" {
+			attributes = append(attributes, attribute.String("user_agent.original", ua))
+		}
+		ctx := propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := Start(ctx, req.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attributes...))
+		defer span.End()
+
+		rw := response.NewStatusWriter(w)
+		next.ServeHTTP(rw, req.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", rw.Status()))
+		if rw.Status() >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rw.Status()))
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MongoMonitor returns a command monitor recording a client span for each MongoDB command run within a recorded
+// span, then calling next, if it is not nil. Commands run outside of a span, such as the polling of background
+// workers, do not start traces of their own. The commands themselves are not recorded as they hold user data.
+func MongoMonitor(next *event.CommandMonitor) *event.CommandMonitor {
+	var mu sync.Mutex
+	spans := map[string]trace.Span{}
+	key := func(connectionID string, requestID int64) string {
+		return connectionID + "/" + strconv.FormatInt(requestID, 10)
+	}
+	finish := func(connectionID string, requestID int64, err error) {
+		mu.Lock()
+		k := key(connectionID, requestID)
+		span, ok := spans[k]
+		delete(spans, k)
+		mu.Unlock()
+		if ok {
+			RecordError(span, err)
+			span.End()
+		}
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			if trace.SpanFromContext(ctx).IsRecording() {
+				attributes := []attribute.KeyValue{
+					attribute.String("db.system", "mongodb"),
+					attribute.String("db.name", e.DatabaseName),
+					attribute.String("db.operation", e.CommandName),
+				}
+				if collection, ok := e.Command.Lookup(e.CommandName).StringValueOK(); ok {
+					attributes = append(attributes, attribute.String("db.mongodb.collection", collection))
+				}
+				_, span := Start(ctx, "mongodb."+e.CommandName, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+				mu.Lock()
+				spans[key(e.ConnectionID, e.RequestID)] = span
+				mu.Unlock()
+			}
+			if next != nil && next.Started != nil {
+				next.Started(ctx, e)
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finish(e.ConnectionID, e.RequestID, nil)
+			if next != nil && next.Succeeded != nil {
+				next.Succeeded(ctx, e)
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finish(e.ConnectionID, e.RequestID, errors.New(e.Failure))
+			if next != nil && next.Failed != nil {
+				next.Failed(ctx, e)
+			}
+		},
+	}
+}
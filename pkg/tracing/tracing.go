@@ -0,0 +1,54 @@
+// Package tracing records distributed traces with OpenTelemetry.
+//
+// Traces are propagated with the W3C traceparent header and exported by the tracer provider set up in main,
+// usually to an OpenTelemetry collector over OTLP. A span is started around a unit of work and ended once it
+// is done:
+//
+//	ctx, span := tracing.Start(ctx, "business.Register")
+//	defer span.End()
+//
+// Until a tracer provider is set, spans are propagated but not recorded.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer creating the spans of the application.
+const instrumentationName = "github.com/ysodiqakanni/trustank-api"
+
+// NewProvider creates a tracer provider exporting the spans of a service in batches. It records the given ratio
+// of the traces started by the service, from 0 to 1. The traces started by a caller are recorded if the caller
+// records them. The provider must be shut down to export the last spans.
+func NewProvider(exporter sdktrace.SpanExporter, ratio float64, service, version string) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", service),
+			attribute.String("service.version", version),
+		)),
+	)
+}
+
+// Start starts an internal span, child of the span of the context if there is one, with the global tracer
+// provider. The returned context holds the new span.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// RecordError records an error on a span and marks the span as failed. A nil error is ignored.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
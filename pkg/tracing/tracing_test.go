@@ -0,0 +1,161 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// setup sets a global tracer provider recording the given ratio of the traces and exporting the ended spans
+// to memory as soon as they end. The caller should reset it with teardown.
+func setup(ratio float64) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	))
+	return exporter
+}
+
+func teardown() {
+	otel.SetTracerProvider(noop.NewTracerProvider())
+}
+
+// attributes returns the attributes of a span as a map.
+func attributes(span tracetest.SpanStub) map[string]interface{} {
+	result := map[string]interface{}{}
+	for _, kv := range span.Attributes {
+		result[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	return result
+}
+
+func TestStart(t *testing.T) {
+	exporter := setup(1)
+	defer teardown()
+
+	ctx, parent := Start(context.Background(), "business.Register")
+	_, child := Start(ctx, "bcrypt.GenerateFromPassword")
+	child.SetAttributes(attribute.Int("cost", 12))
+	RecordError(child, errors.New("too slow"))
+	RecordError(parent, nil)
+	child.End()
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "bcrypt.GenerateFromPassword", spans[0].Name)
+		assert.Equal(t, trace.SpanKindInternal, spans[0].SpanKind)
+		assert.Equal(t, parent.SpanContext().TraceID(), spans[0].SpanContext.TraceID())
+		assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent.SpanID())
+		assert.Equal(t, int64(12), attributes(spans[0])["cost"])
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+		assert.Equal(t, "too slow", spans[0].Status.Description)
+		assert.Equal(t, codes.Unset, spans[1].Status.Code)
+		assert.False(t, spans[1].Parent.IsValid())
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewProvider(exporter, 1, "trustank-api", "1.0.0")
+	_, span := provider.Tracer("test").Start(context.Background(), "test")
+	span.End()
+	assert.Empty(t, exporter.GetSpans())
+
+	// flushing exports the pending batch
+	assert.Nil(t, provider.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 1) {
+		service, _ := spans[0].Resource.Set().Value("service.name")
+		assert.Equal(t, "trustank-api", service.AsString())
+	}
+	assert.Nil(t, provider.Shutdown(context.Background()))
+}
+
+func TestMiddleware(t *testing.T) {
+	// this service samples none of the traces it starts
+	exporter := setup(0)
+	defer teardown()
+
+	var inner trace.SpanContext
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/businesses/{id}", func(w http.ResponseWriter, req *http.Request) {
+		inner = trace.SpanContextFromContext(req.Context())
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("the response writer cannot be flushed")
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/businesses/1", nil))
+	assert.Empty(t, exporter.GetSpans())
+
+	// the caller samples the trace
+	req := httptest.NewRequest("GET", "/businesses/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "GET /businesses/{id}", spans[0].Name)
+		assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+		assert.Equal(t, inner.SpanID(), spans[0].SpanContext.SpanID())
+		assert.Equal(t, int64(http.StatusBadGateway), attributes(spans[0])["http.response.status_code"])
+		assert.Equal(t, "/businesses/1", attributes(spans[0])["url.path"])
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+		assert.Equal(t, "Bad Gateway", spans[0].Status.Description)
+	}
+}
+
+func TestMongoMonitor(t *testing.T) {
+	exporter := setup(1)
+	defer teardown()
+
+	var succeeded int
+	monitor := MongoMonitor(&event.CommandMonitor{
+		Succeeded: func(context.Context, *event.CommandSucceededEvent) { succeeded++ },
+	})
+	command, _ := bson.Marshal(bson.D{{Key: "find", Value: "businesses"}, {Key: "filter", Value: bson.D{{Key: "email", Value: "secret"}}}})
+
+	// outside of a span
+	monitor.Started(context.Background(), &event.CommandStartedEvent{Command: command, CommandName: "find", ConnectionID: "c1", RequestID: 1})
+	monitor.Succeeded(context.Background(), &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", ConnectionID: "c1", RequestID: 1}})
+
+	ctx, parent := Start(context.Background(), "business.Get")
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: command, DatabaseName: "trustank", CommandName: "find", ConnectionID: "c1", RequestID: 2})
+	monitor.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", ConnectionID: "c1", RequestID: 2}, Failure: "timeout"})
+	parent.End()
+
+	assert.Equal(t, 1, succeeded)
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "mongodb.find", spans[0].Name)
+		assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind)
+		assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent.SpanID())
+		assert.Equal(t, map[string]interface{}{
+			"db.system":             "mongodb",
+			"db.name":               "trustank",
+			"db.operation":          "find",
+			"db.mongodb.collection": "businesses",
+		}, attributes(spans[0]))
+		assert.Equal(t, "timeout", spans[0].Status.Description)
+	}
+}